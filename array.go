@@ -0,0 +1,216 @@
+package questdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	// arrayBinaryFormat is the ILP binary format type of an array value
+	arrayBinaryFormat byte = 14
+	// doubleElementType is the QuestDB column type of the elements of a double array
+	doubleElementType byte = 10
+	// maxArrayElements is the number of elements QuestDB accepts in an array
+	maxArrayElements = (1 << 28) - 1
+)
+
+// arrayDims func returns the number of dimensions of the array type qdbType, or 0 if it is not
+// an array type
+func arrayDims(qdbType QuestDBType) int {
+	switch qdbType {
+	case DoubleArray:
+		return 1
+	case DoubleArray2D:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// isDoubleArrayType func reports whether t is a slice nested dims deep with elements of a float
+// kind, e.g. []float64 or [][]float32 for 2 dims
+func isDoubleArrayType(t reflect.Type, dims int) bool {
+	for i := 0; i < dims; i++ {
+		if t.Kind() != reflect.Slice {
+			return false
+		}
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Float64 || t.Kind() == reflect.Float32
+}
+
+// flattenDoubleArray func returns the shape and the row major elements of v, a slice nested dims
+// deep of a float kind. It returns an error if the nested slices are ragged, as QuestDB arrays
+// are rectangular, or if v has more elements than QuestDB accepts.
+func flattenDoubleArray(v interface{}, qdbType QuestDBType) ([]int, []float64, error) {
+	dims := arrayDims(qdbType)
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || !isDoubleArrayType(rv.Type(), dims) {
+		return nil, nil, &incompatibleTypeError{v: v, qdbType: qdbType}
+	}
+
+	shape := make([]int, dims)
+	level := rv
+	for i := range shape {
+		shape[i] = level.Len()
+		if level.Len() == 0 {
+			break
+		}
+		level = level.Index(0)
+	}
+	size := 1
+	for _, n := range shape {
+		size *= n
+	}
+	if size > maxArrayElements {
+		return nil, nil, fmt.Errorf("array of %d elements exceeds the maximum of %d", size, maxArrayElements)
+	}
+
+	values := make([]float64, 0, size)
+	var flatten func(rv reflect.Value, dim int) error
+	flatten = func(rv reflect.Value, dim int) error {
+		if rv.Len() != shape[dim] {
+			return fmt.Errorf("ragged array: dimension %d has lengths %d and %d", dim+1, shape[dim], rv.Len())
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if dim == dims-1 {
+				values = append(values, rv.Index(i).Float())
+				continue
+			}
+			if err := flatten(rv.Index(i), dim+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := flatten(rv, 0); err != nil {
+		return nil, nil, err
+	}
+	return shape, values, nil
+}
+
+// encodeDoubleArray func returns the ILP binary format of the double array of shape holding
+// values: a second '=' after the column's, the array format and element types, the number of
+// dimensions, the length of each dimension as a little endian uint32 and then the row major
+// elements as little endian float64s. Only QuestDB 9.0 and later ingest the binary format.
+func encodeDoubleArray(shape []int, values []float64) string {
+	b := make([]byte, 4+4*len(shape)+8*len(values))
+	copy(b, []byte{'=', arrayBinaryFormat, doubleElementType, byte(len(shape))})
+	i := 4
+	for _, n := range shape {
+		binary.LittleEndian.PutUint32(b[i:], uint32(n))
+		i += 4
+	}
+	for _, v := range values {
+		binary.LittleEndian.PutUint64(b[i:], math.Float64bits(v))
+		i += 8
+	}
+	return string(b)
+}
+
+// doubleArrayIntermediate struct is a struct which implements the sql.Scanner interface for
+// double array fields. QuestDB returns arrays over the Postgres Wire Protocol in their text form
+// (i.e. "{{1.0,2.0},{3.0,4.0}}"), which doubleArrayIntermediate parses back into the field's
+// slice.
+type doubleArrayIntermediate struct {
+	v    reflect.Value
+	dims int
+}
+
+// newDoubleArrayIntermediate func returns *doubleArrayIntermediate given a pointer v to a slice
+// nested dims deep to scan into
+func newDoubleArrayIntermediate(v interface{}, dims int) *doubleArrayIntermediate {
+	return &doubleArrayIntermediate{
+		v:    reflect.ValueOf(v).Elem(),
+		dims: dims,
+	}
+}
+
+// Scan func is implementation of the sql.Scanner's Scan method which parses the text form of an
+// array src into doubleArrayIntermediate's (v) underlying slice. A null array scans as a nil
+// slice and null elements as NaN.
+func (d *doubleArrayIntermediate) Scan(src interface{}) error {
+	var text string
+	switch val := src.(type) {
+	case nil:
+		d.v.Set(reflect.Zero(d.v.Type()))
+		return nil
+	case string:
+		text = val
+	case []byte:
+		text = string(val)
+	default:
+		return fmt.Errorf("%T cannot be scanned into array field", val)
+	}
+	rv, rest, err := parseDoubleArray(strings.TrimSpace(text), d.v.Type(), d.dims)
+	if err != nil {
+		return fmt.Errorf("could not parse array '%s': %w", text, err)
+	}
+	if rest != "" {
+		return fmt.Errorf("could not parse array '%s': unexpected '%s'", text, rest)
+	}
+	d.v.Set(rv)
+	return nil
+}
+
+// parseDoubleArray func parses the leading array of s, nested dims deep, into a slice of type t
+// and returns it with the rest of s
+func parseDoubleArray(s string, t reflect.Type, dims int) (reflect.Value, string, error) {
+	if !strings.HasPrefix(s, "{") {
+		return reflect.Value{}, "", fmt.Errorf("expected '{' at '%s'", s)
+	}
+	s = s[1:]
+	out := reflect.MakeSlice(t, 0, 0)
+	if strings.HasPrefix(s, "}") {
+		return out, s[1:], nil
+	}
+	for {
+		var elem reflect.Value
+		if dims > 1 {
+			var err error
+			elem, s, err = parseDoubleArray(s, t.Elem(), dims-1)
+			if err != nil {
+				return reflect.Value{}, "", err
+			}
+		} else {
+			end := strings.IndexAny(s, ",}")
+			if end < 0 {
+				return reflect.Value{}, "", fmt.Errorf("expected '}' at '%s'", s)
+			}
+			f, err := parseArrayElement(s[:end])
+			if err != nil {
+				return reflect.Value{}, "", err
+			}
+			elem = reflect.New(t.Elem()).Elem()
+			elem.SetFloat(f)
+			s = s[end:]
+		}
+		out = reflect.Append(out, elem)
+
+		switch {
+		case strings.HasPrefix(s, ","):
+			s = s[1:]
+		case strings.HasPrefix(s, "}"):
+			return out, s[1:], nil
+		default:
+			return reflect.Value{}, "", fmt.Errorf("expected ',' or '}' at '%s'", s)
+		}
+	}
+}
+
+// parseArrayElement func parses a double array element, which is NaN if null
+func parseArrayElement(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, "null") {
+		return math.NaN(), nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid element '%s'", s)
+	}
+	return f, nil
+}
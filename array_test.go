@@ -0,0 +1,170 @@
+package questdb
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testEmbedding struct {
+	ID        string      `qdb:"id;symbol"`
+	Embedding []float64   `qdb:"embedding;double[]"`
+	Small     []float32   `qdb:"small;double[]"`
+	Matrix    [][]float64 `qdb:"matrix;double[][]"`
+}
+
+func (testEmbedding) TableName() string {
+	return "embeddings"
+}
+
+// testDoubleArray func returns the expected ILP binary format of an array of shape holding values
+func testDoubleArray(shape []int, values ...float64) string {
+	b := []byte{'=', 14, 10, byte(len(shape))}
+	for _, n := range shape {
+		b = append(b, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(b[len(b)-4:], uint32(n))
+	}
+	for _, v := range values {
+		b = append(b, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint64(b[len(b)-8:], math.Float64bits(v))
+	}
+	return string(b)
+}
+
+func TestSerializeValue_DoubleArray(t *testing.T) {
+	t.Run("should write arrays in the ILP binary format", func(t *testing.T) {
+		out, err := serializeValue([]float64{1.5, -2}, DoubleArray, lineFormat{})
+		assert.Nil(t, err)
+		assert.Equal(t, testDoubleArray([]int{2}, 1.5, -2), out)
+
+		out, err = serializeValue([]float32{0.5}, DoubleArray, lineFormat{})
+		assert.Nil(t, err)
+		assert.Equal(t, testDoubleArray([]int{1}, 0.5), out)
+
+		out, err = serializeValue([]float64{}, DoubleArray, lineFormat{})
+		assert.Nil(t, err)
+		assert.Equal(t, testDoubleArray([]int{0}), out)
+	})
+
+	t.Run("should write 2 dimensional arrays in row major order", func(t *testing.T) {
+		out, err := serializeValue([][]float64{{1, 2, 3}, {4, 5, 6}}, DoubleArray2D, lineFormat{})
+		assert.Nil(t, err)
+		assert.Equal(t, testDoubleArray([]int{2, 3}, 1, 2, 3, 4, 5, 6), out)
+	})
+
+	t.Run("should reject ragged arrays", func(t *testing.T) {
+		_, err := serializeValue([][]float64{{1, 2}, {3}}, DoubleArray2D, lineFormat{})
+		assert.EqualError(t, err, "ragged array: dimension 2 has lengths 2 and 1")
+	})
+
+	t.Run("should reject values of other types or dimensions", func(t *testing.T) {
+		_, err := serializeValue([]int64{1}, DoubleArray, lineFormat{})
+		assert.EqualError(t, err, "type []int64 is not compatible with double[]")
+		_, err = serializeValue([][]float64{{1}}, DoubleArray, lineFormat{})
+		assert.NotNil(t, err)
+		_, err = serializeValue([]float64{1}, DoubleArray2D, lineFormat{})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestModel_DoubleArray(t *testing.T) {
+	t.Run("should write array columns", func(t *testing.T) {
+		m, err := NewModel(&testEmbedding{ID: "a", Embedding: []float64{1, 2}})
+		assert.Nil(t, err)
+
+		line, err := m.marshalLine()
+		assert.Nil(t, err)
+		assert.Equal(t, "embeddings,id=a embedding="+testDoubleArray([]int{2}, 1, 2)+"\n", string(line))
+	})
+
+	t.Run("should declare array columns", func(t *testing.T) {
+		m, err := NewModel(testEmbedding{})
+		assert.Nil(t, err)
+		assert.Equal(t, `CREATE TABLE IF NOT EXISTS "embeddings" ( "id" symbol, "embedding" double[], "small" double[], "matrix" double[][], "timestamp" timestamp ) timestamp(timestamp) ;`, m.CreateTableIfNotExistStatement())
+	})
+
+	t.Run("should reject fields which are not float slices of the column's dimensions", func(t *testing.T) {
+		_, err := NewModel(struct {
+			Embedding []int64 `qdb:"embedding;double[]"`
+		}{})
+		assert.NotNil(t, err)
+
+		_, err = NewModel(struct {
+			Embedding [][][]float64 `qdb:"embedding;double[][]"`
+		}{})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("should scan arrays back into slices", func(t *testing.T) {
+		db := newTestDB(t, []string{"id", "embedding", "small", "matrix"},
+			[]driver.Value{"a", []byte("{1.5,-2.0,null}"), "{}", []byte("{{1.0,2.0},{3.0,4.0}}")},
+			[]driver.Value{"b", nil, "{0.5}", "{}"},
+		)
+
+		read := []testEmbedding{}
+		rows, err := db.Query("SELECT id, embedding, small, matrix FROM embeddings")
+		assert.Nil(t, err)
+		assert.Nil(t, ScanAll(rows, &read))
+		assert.Equal(t, 2, len(read))
+
+		assert.Equal(t, 1.5, read[0].Embedding[0])
+		assert.Equal(t, -2.0, read[0].Embedding[1])
+		assert.True(t, math.IsNaN(read[0].Embedding[2]))
+		assert.Equal(t, []float32{}, read[0].Small)
+		assert.Equal(t, [][]float64{{1, 2}, {3, 4}}, read[0].Matrix)
+
+		assert.Nil(t, read[1].Embedding)
+		assert.Equal(t, []float32{0.5}, read[1].Small)
+		assert.Equal(t, [][]float64{}, read[1].Matrix)
+	})
+
+	t.Run("should fail to scan malformed arrays", func(t *testing.T) {
+		var v []float64
+		assert.NotNil(t, newDoubleArrayIntermediate(&v, 1).Scan("{1,2"))
+		assert.NotNil(t, newDoubleArrayIntermediate(&v, 1).Scan("{1,x}"))
+		assert.NotNil(t, newDoubleArrayIntermediate(&v, 1).Scan("{1} trailing"))
+	})
+}
+
+func TestClient_DoubleArrayNewlineBytes(t *testing.T) {
+	// the binary format of a dimension of length 10, and of a value whose last byte is 10, hold
+	// newline bytes which do not end the line
+	ten := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	endsInNewline := math.Float64frombits(0x0a00000000000000)
+
+	t.Run("should count the lines of structs with arrays", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		assert.Nil(t, client.WriteBatch([]interface{}{testEmbedding{ID: "a", Embedding: ten}, testEmbedding{ID: "b", Embedding: ten}}))
+		line := "embeddings,id=%s embedding=" + testDoubleArray([]int{10}, ten...) + "\n"
+		expected := fmt.Sprintf(line, "a") + fmt.Sprintf(line, "b")
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+		assert.Equal(t, int64(2), client.Stats().LinesWritten)
+	})
+
+	t.Run("should keep a trailing newline byte of a line without a timestamp", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		l := NewLine("embeddings")
+		assert.Nil(t, l.AddColumn("embedding", DoubleArray, []float64{endsInNewline}))
+		expected := "embeddings embedding=" + testDoubleArray([]int{1}, endsInNewline) + "\n"
+		assert.Equal(t, expected, l.String())
+
+		assert.Nil(t, client.Write(l))
+		buf := client.NewLineBuffer()
+		assert.Nil(t, buf.AppendLine(l))
+		assert.Nil(t, buf.AppendStruct(testEmbedding{ID: "a", Embedding: ten}))
+		assert.Equal(t, 2, buf.Lines())
+		assert.Nil(t, client.WriteLineBuffer(buf))
+
+		expected += expected + "embeddings,id=a embedding=" + testDoubleArray([]int{10}, ten...) + "\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+		assert.Equal(t, int64(3), client.Stats().LinesWritten)
+	})
+}
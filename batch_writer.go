@@ -0,0 +1,165 @@
+package questdb
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultMaxQueueDepth is the number of rows a BatchWriter queues when Config.MaxQueueDepth is
+// not set
+const DefaultMaxQueueDepth = 10000
+
+// BatchWriter struct writes rows added to it from another goroutine, in batches, through
+// WriteFrom. Rows wait in a queue of at most Config.MaxQueueDepth rows, so producers which
+// outrun QuestDB are held back instead of buffering without bound: Add blocks while the queue is
+// full, or returns ErrQueueFull if the BatchWriter was made with WithNonBlockingAdd.
+type BatchWriter struct {
+	client      *Client
+	queue       chan interface{}
+	nonBlocking bool
+	// flushes receives the flush requests of Client.Pause
+	flushes chan chan error
+
+	// mu guards closed, and is held by Add while sending so Close cannot close the queue
+	// under it
+	mu     sync.RWMutex
+	closed bool
+
+	// done is closed once WriteFrom has returned, with its error in err
+	done chan struct{}
+	err  error
+}
+
+// NewBatchWriter func starts a BatchWriter writing the rows added to it (qdb tagged structs or
+// LineMarshalers) with options, which are those of WriteFrom plus WithNonBlockingAdd. The
+// BatchWriter stops when ctx is cancelled or a write fails, after which Add returns the error.
+// Close must be called to flush the queued rows and release the BatchWriter.
+func (c *Client) NewBatchWriter(ctx context.Context, options ...option) *BatchWriter {
+	depth := c.config.MaxQueueDepth
+	if depth <= 0 {
+		depth = DefaultMaxQueueDepth
+	}
+	w := &BatchWriter{
+		client:  c,
+		queue:   make(chan interface{}, depth),
+		flushes: make(chan chan error),
+		done:    make(chan struct{}),
+	}
+	for _, opt := range options {
+		if opt.nonBlocking {
+			w.nonBlocking = true
+		}
+	}
+
+	c.batchWritersMu.Lock()
+	if c.batchWriters == nil {
+		c.batchWriters = map[*BatchWriter]struct{}{}
+	}
+	c.batchWriters[w] = struct{}{}
+	c.batchWritersMu.Unlock()
+
+	go func() {
+		// WriteFrom only returns nil once Close has closed the queue
+		w.err = c.writeFrom(ctx, w.queue, w.flushes, options)
+		close(w.done)
+
+		c.batchWritersMu.Lock()
+		delete(c.batchWriters, w)
+		c.batchWritersMu.Unlock()
+	}()
+	return w
+}
+
+// Add func queues row to be written. It blocks while the queue is full, unless the BatchWriter
+// is non blocking in which case it returns ErrQueueFull. It returns ErrBatchWriterClosed after
+// Close, the error which stopped the BatchWriter, or ErrPaused while its Client is paused.
+func (w *BatchWriter) Add(row interface{}) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrBatchWriterClosed
+	}
+	if w.client.Paused() {
+		return ErrPaused
+	}
+	// a stopped BatchWriter may have room in its queue, which the selects below could pick
+	select {
+	case <-w.done:
+		return w.err
+	default:
+	}
+
+	if w.nonBlocking {
+		select {
+		case w.queue <- row:
+			return nil
+		case <-w.done:
+			return w.err
+		default:
+			return ErrQueueFull
+		}
+	}
+
+	select {
+	case w.queue <- row:
+		return nil
+	case <-w.done:
+		return w.err
+	}
+}
+
+// Depth func returns the number of rows waiting in the queue
+func (w *BatchWriter) Depth() int {
+	return len(w.queue)
+}
+
+// Close func stops accepting rows, waits for the queued rows to be written and returns the
+// first error the BatchWriter encountered, if any
+func (w *BatchWriter) Close() error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	<-w.done
+	return w.err
+}
+
+// flush func writes the queued and buffered rows of the BatchWriter, returning the error of
+// writing them, or of the BatchWriter having stopped
+func (w *BatchWriter) flush(ctx context.Context) error {
+	// wait out the Adds in progress, which may have queued their row before the Client started
+	// pausing, so the flush includes their rows
+	w.mu.Lock()
+	w.mu.Unlock()
+
+	reply := make(chan error, 1)
+	select {
+	case w.flushes <- reply:
+	case <-w.done:
+		return w.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-reply:
+		return err
+	case <-w.done:
+		return w.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// queueDepth func returns the number of rows waiting in the queues of the Client's BatchWriters
+func (c *Client) queueDepth() int64 {
+	c.batchWritersMu.Lock()
+	defer c.batchWritersMu.Unlock()
+	depth := 0
+	for w := range c.batchWriters {
+		depth += w.Depth()
+	}
+	return int64(depth)
+}
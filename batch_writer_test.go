@@ -0,0 +1,77 @@
+package questdb
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchWriter(t *testing.T) {
+	t.Run("should write the added rows", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		w := client.NewBatchWriter(context.Background(), WithBatchSize(2))
+		assert.Nil(t, w.Add(testRow{Name: "a", Value: 1}))
+		assert.Nil(t, w.Add(testRow{Name: "b", Value: 2}))
+		assert.Nil(t, w.Add(testRow{Name: "c", Value: 3}))
+		assert.Nil(t, w.Close())
+
+		expected := "test_rows,name=a value=1i\ntest_rows,name=b value=2i\ntest_rows,name=c value=3i\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+		assert.Equal(t, ErrBatchWriterClosed, w.Add(testRow{Name: "d", Value: 4}))
+	})
+
+	t.Run("should return ErrQueueFull when the server cannot keep up in non blocking mode", func(t *testing.T) {
+		client, err := New(Config{MaxQueueDepth: 1})
+		assert.Nil(t, err)
+		// nothing reads the other end of the pipe, so writes block
+		conn, peer := net.Pipe()
+		client.ilpConn = conn
+
+		w := client.NewBatchWriter(context.Background(), WithBatchSize(1), WithNonBlockingAdd())
+		assert.Nil(t, w.Add(testRow{Name: "a", Value: 1}))
+		// the first row is taken off the queue and blocks writing, the second waits in the queue
+		assert.Eventually(t, func() bool {
+			return w.Add(testRow{Name: "b", Value: 2}) == nil
+		}, time.Second, time.Millisecond)
+		assert.Equal(t, int64(1), client.Stats().QueueDepth)
+		assert.Equal(t, ErrQueueFull, w.Add(testRow{Name: "c", Value: 3}))
+
+		// failing the write stops the BatchWriter with the write's error
+		peer.Close()
+		assert.NotNil(t, w.Close())
+		assert.Equal(t, int64(0), client.Stats().QueueDepth)
+	})
+
+	t.Run("should unblock Add when the BatchWriter stops", func(t *testing.T) {
+		client, err := New(Config{MaxQueueDepth: 1})
+		assert.Nil(t, err)
+		conn, _ := net.Pipe()
+		client.ilpConn = conn
+
+		ctx, cancel := context.WithCancel(context.Background())
+		w := client.NewBatchWriter(ctx, WithBatchSize(1))
+		assert.Nil(t, w.Add(testRow{Name: "a", Value: 1}))
+
+		added := make(chan error)
+		go func() {
+			// fills the queue, then blocks on the queue or the stalled write
+			w.Add(testRow{Name: "b", Value: 2})
+			added <- w.Add(testRow{Name: "c", Value: 3})
+		}()
+		cancel()
+		conn.Close()
+
+		select {
+		case err := <-added:
+			assert.NotNil(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("Add did not unblock")
+		}
+		assert.NotNil(t, w.Close())
+	})
+}
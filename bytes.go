@@ -28,9 +28,14 @@ func (b Bytes) QDBValue() (Value, error) {
 	return b64Str, nil
 }
 
-// Scan func implements the sql.Scanner interface
+// Scan func implements the sql.Scanner interface. Bytes are stored in QuestDB as a base64 encoded
+// string, which the driver may return as either a string or a []byte, so both are base64 decoded
+// back into the original bytes.
 func (b *Bytes) Scan(src interface{}) error {
 	switch val := src.(type) {
+	case nil:
+		*b = nil
+		return nil
 	case string:
 		by, err := base64.StdEncoding.DecodeString(val)
 		if err != nil {
@@ -39,7 +44,12 @@ func (b *Bytes) Scan(src interface{}) error {
 		*b = by
 		return nil
 	case []byte:
-		*b = val
+		// DecodeString allocates, so the result does not alias the driver owned src
+		by, err := base64.StdEncoding.DecodeString(string(val))
+		if err != nil {
+			return fmt.Errorf("could not base64 decode src: %w", err)
+		}
+		*b = by
 		return nil
 	default:
 		return fmt.Errorf("%T cannot be scanned into Bytes", val)
@@ -0,0 +1,54 @@
+package questdb
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBytes_Scan(t *testing.T) {
+	type document struct {
+		Name string `qdb:"name;symbol"`
+		Body Bytes  `qdb:"body;binary"`
+	}
+
+	written := &document{Name: "a", Body: Bytes{0x00, 0xff, 0x10, 'h', 'i', '\n'}}
+	m, err := NewModel(written)
+	assert.Nil(t, err)
+	// the serialized ILP value is a quoted base64 string; QuestDB returns it unquoted
+	stored := strings.Trim(m.fields[1].valueSerialized, `"`)
+
+	t.Run("should recover the original bytes from a string column", func(t *testing.T) {
+		db := newTestDB(t, []string{"name", "body"}, []driver.Value{"a", stored})
+
+		read := &document{}
+		err := ScanInto(db.QueryRow("SELECT name, body FROM documents"), read)
+		assert.Nil(t, err)
+		assert.Equal(t, written, read)
+	})
+
+	t.Run("should recover the original bytes when the driver returns []byte", func(t *testing.T) {
+		db := newTestDB(t, []string{"name", "body"}, []driver.Value{"a", []byte(stored)})
+
+		read := &document{}
+		err := ScanInto(db.QueryRow("SELECT name, body FROM documents"), read)
+		assert.Nil(t, err)
+		assert.Equal(t, written, read)
+	})
+
+	t.Run("should scan NULL into nil", func(t *testing.T) {
+		db := newTestDB(t, []string{"name", "body"}, []driver.Value{"a", nil})
+
+		read := &document{Body: Bytes("old")}
+		err := ScanInto(db.QueryRow("SELECT name, body FROM documents"), read)
+		assert.Nil(t, err)
+		assert.Nil(t, read.Body)
+	})
+
+	t.Run("should return an error for values which are not base64", func(t *testing.T) {
+		b := Bytes{}
+		assert.NotNil(t, b.Scan("not base64!"))
+	})
+}
@@ -2,20 +2,28 @@ package questdb
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/tls"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"math/big"
 	"net"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // Config is a struct which holds Client's config fields
@@ -25,6 +33,172 @@ type Config struct {
 	ILPAuthKid        string
 	PGConnStr         string
 	TLSConfig         *tls.Config
+	// ILPAuthTimeout bounds how long Connect waits on the ILP auth handshake. If zero,
+	// DefaultILPAuthTimeout is used.
+	ILPAuthTimeout time.Duration
+	// LegacyIntFormat omits the `i` (integer) and `t` (timestamp) type suffixes from values
+	// written by Write, WriteBatch, WriteFrom and WriteLine. Every QuestDB release understands the
+	// suffixes, so this is only a compatibility escape hatch for proxies or downstream
+	// consumers of the raw ILP stream which cannot parse them. Note that QuestDB parses an
+	// unsuffixed number as a double, so the target table's columns should already exist
+	// with the intended types (e.g. via CreateTableIfNotExists) before writing in this format.
+	LegacyIntFormat bool
+	// ILPDialect, if set, is the Influx Line Protocol dialect (separators and type suffixes) of
+	// the lines written from structs, for QuestDB compatible sinks or proxies which expect
+	// variations of the format. Defaults to StandardILPDialect, the only dialect QuestDB itself
+	// ingests. LegacyIntFormat still removes the type suffixes of a dialect set here. Lines are
+	// written in it too unless they have their own, see Line.SetDialect, while raw messages are
+	// written as they are.
+	ILPDialect *ILPDialect
+	// TimestampResolution is the resolution timestamp columns are written at. int64 timestamp
+	// fields are taken to already be a count of this resolution. QuestDB timestamps are
+	// microsecond native, so NanosecondResolution does not store more precision, it only lets
+	// nanosecond values be written as is. Defaults to MicrosecondResolution.
+	TimestampResolution TimestampResolution
+	// Tracer, if set, is used to start a span around every struct/line write and PG query
+	// made through the Client. Defaults to a no-op Tracer.
+	Tracer Tracer
+	// MaxLineBytes, if greater than zero, is the maximum length in bytes (including the trailing
+	// newline) of a single ILP line written from a struct or Line. QuestDB drops lines longer than
+	// its configured maximum, so setting this to the server's limit turns a silent server side drop
+	// into an ErrILPLineTooLong error.
+	MaxLineBytes int
+	// TypeMapper, if set, maps field types to column types in the create table statements
+	// executed by the Client. Defaults to DefaultTypeMapper.
+	TypeMapper TypeMapper
+	// ILPLocalAddr, if set, is the local address the ILP connection is dialed from, which pins
+	// the egress interface on multi-homed hosts. ILPHost is then resolved to an address of the
+	// same family (IPv4 or IPv6) as ILPLocalAddr.
+	ILPLocalAddr *net.TCPAddr
+	// PGMaxOpenConns is the maximum number of open PG connections. If zero or negative the
+	// number is unlimited, the database/sql default.
+	PGMaxOpenConns int
+	// PGMaxIdleConns is the maximum number of idle PG connections kept for reuse. If zero the
+	// database/sql default of 2 is used, if negative no idle connections are kept. It is
+	// lowered to PGMaxOpenConns if that is set and smaller.
+	PGMaxIdleConns int
+	// PGConnMaxLifetime is the maximum time a PG connection is reused for before being closed,
+	// which lets stale connections (e.g. behind a load balancer) be replaced. If zero or
+	// negative connections are reused forever, the database/sql default.
+	PGConnMaxLifetime time.Duration
+	// MaxQueueDepth is the maximum number of rows a BatchWriter queues before Add blocks (or
+	// returns ErrQueueFull). If zero, DefaultMaxQueueDepth is used.
+	MaxQueueDepth int
+	// Clock, if set, returns the current time wherever the Client stamps one, e.g. rows written
+	// WithStampNowIfZero, the shard of WithShardedTable rows without a time and Stats' LastWriteTime, so tests
+	// can inject a fixed time. It does not affect network deadlines or flush intervals, which
+	// always use the real time. Defaults to time.Now.
+	Clock func() time.Time
+	// TableNamePrefix and TableNameSuffix, if set, are added to the table name of every struct
+	// the Client writes, creates or queries the table of, after it is resolved from the struct's
+	// name, its TableName method or WithTableName (e.g. a "staging_" prefix for users writes to
+	// staging_users). The tables of sharded writes are named from the affixed base, e.g.
+	// staging_events_2024_01. Lines and raw messages are written to the tables they name as is.
+	TableNamePrefix string
+	TableNameSuffix string
+	// TableNameTransformer, if set, maps the table name of every struct the Client writes,
+	// creates or queries the table of, as the final step of resolving it (e.g. to route tables by
+	// a hash of their name). Table names are resolved in this order:
+	//
+	//  1. the struct's snake cased name, or its TableName method if it is a TableNamer
+	//  2. WithTableName, or the shard base of WithShardedTable, if passed
+	//  3. TableNamePrefix and TableNameSuffix
+	//  4. the time bucket of sharded writes (e.g. _2024_01)
+	//  5. TableNameTransformer
+	//
+	// Lines and raw messages are written to the tables they name as is.
+	TableNameTransformer func(tableName string) string
+	// ConnectRetries is the number of times Connect retries a failed ILP dial and PG open, e.g.
+	// while QuestDB is still starting alongside the application. If zero, Connect fails on the
+	// first error.
+	ConnectRetries int
+	// ConnectRetryBackoff is the wait before Connect's first retry, doubled after each retry up
+	// to a minute. If zero, DefaultConnectRetryBackoff is used.
+	ConnectRetryBackoff time.Duration
+}
+
+const (
+	// DefaultILPAuthTimeout is the ILP auth handshake timeout used when Config.ILPAuthTimeout is
+	// not set
+	DefaultILPAuthTimeout = 10 * time.Second
+	// DefaultConnectRetryBackoff is the wait before Connect's first retry used when
+	// Config.ConnectRetryBackoff is not set
+	DefaultConnectRetryBackoff = time.Second
+	// connectMaxBackoff bounds the wait between Connect's retries
+	connectMaxBackoff = time.Minute
+)
+
+// Validate func checks the config for problems which would otherwise only surface when
+// connecting or querying, and returns an error listing all of them, or nil if there are none:
+// ILPHost, if set, must be a host:port address with a valid port, ILPAuthPrivateKey and
+// ILPAuthKid must be set together and the key must be a base64url encoded P-256 private key,
+// TLSConfig's minimum version must not exceed its maximum, PGConnStr, if set, must be a DSN
+// lib/pq can parse, and the counts and durations must not be negative. New calls Validate.
+func (c Config) Validate() error {
+	errs := []error{}
+
+	if c.ILPHost != "" {
+		if _, port, err := net.SplitHostPort(c.ILPHost); err != nil {
+			errs = append(errs, fmt.Errorf("ILPHost '%s' is not a host:port address: %v", c.ILPHost, err))
+		} else if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			errs = append(errs, fmt.Errorf("ILPHost '%s' does not have a valid port", c.ILPHost))
+		}
+	}
+
+	if c.ILPAuthPrivateKey != "" && c.ILPAuthKid == "" {
+		errs = append(errs, errors.New("ILPAuthPrivateKey is set without ILPAuthKid"))
+	}
+	if c.ILPAuthKid != "" && c.ILPAuthPrivateKey == "" {
+		errs = append(errs, errors.New("ILPAuthKid is set without ILPAuthPrivateKey"))
+	}
+	if c.ILPAuthPrivateKey != "" {
+		if key, err := base64.RawURLEncoding.DecodeString(c.ILPAuthPrivateKey); err != nil {
+			errs = append(errs, fmt.Errorf("ILPAuthPrivateKey is not base64url encoded: %v", err))
+		} else if len(key) != 32 {
+			errs = append(errs, fmt.Errorf("ILPAuthPrivateKey is %d bytes long, not the 32 bytes of a P-256 private key", len(key)))
+		}
+	}
+
+	if c.TLSConfig != nil && c.TLSConfig.MinVersion != 0 && c.TLSConfig.MaxVersion != 0 &&
+		c.TLSConfig.MinVersion > c.TLSConfig.MaxVersion {
+		errs = append(errs, fmt.Errorf("TLSConfig MinVersion %#x is greater than its MaxVersion %#x",
+			c.TLSConfig.MinVersion, c.TLSConfig.MaxVersion))
+	}
+
+	if c.PGConnStr != "" {
+		if _, err := pq.NewConnector(c.PGConnStr); err != nil {
+			errs = append(errs, fmt.Errorf("PGConnStr is not a valid postgres DSN: %v", err))
+		}
+	}
+
+	if c.TimestampResolution != MicrosecondResolution && c.TimestampResolution != NanosecondResolution {
+		errs = append(errs, fmt.Errorf("TimestampResolution %d is not a TimestampResolution", c.TimestampResolution))
+	}
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"ILPAuthTimeout", c.ILPAuthTimeout},
+		{"ConnectRetryBackoff", c.ConnectRetryBackoff},
+	} {
+		if d.value < 0 {
+			errs = append(errs, fmt.Errorf("%s %s is negative", d.name, d.value))
+		}
+	}
+	for _, n := range []struct {
+		name  string
+		value int
+	}{
+		{"MaxLineBytes", c.MaxLineBytes},
+		{"MaxQueueDepth", c.MaxQueueDepth},
+		{"ConnectRetries", c.ConnectRetries},
+	} {
+		if n.value < 0 {
+			errs = append(errs, fmt.Errorf("%s %d is negative", n.name, n.value))
+		}
+	}
+
+	return joinErrors(errs)
 }
 
 // Client struct represents a QuestDB client connection. This encompasses the InfluxDB Line
@@ -34,10 +208,39 @@ type Client struct {
 	config Config
 	// ilpConn is the TCP connection which allows Client to write data to QuestDB
 	ilpConn net.Conn
+	// ilpWatch detects the server closing ilpConn
+	ilpWatch *connWatch
+	// ilpMu guards ilpConn and ilpWatch, which Close clears while BatchWriters and WriteFrom
+	// may be writing
+	ilpMu sync.RWMutex
+	// writeMu serializes writes on the ILP connection, so the deadline of a write's ctx applies
+	// to it alone and lines are never interleaved
+	writeMu sync.Mutex
 	// pgSqlDB is the Postgres SQL DB connection which allows to read/query data from QuestDB
 	pgSqlDB *sql.DB
+	// stats holds the ILP connection statistics returned by Stats
+	stats stats
+	// stmts holds the open statements created by Prepare so they can be closed by Close
+	stmts   map[*Stmt]struct{}
+	stmtsMu sync.Mutex
+	// batchWriters holds the running BatchWriters so Stats can report their queue depth
+	batchWriters   map[*BatchWriter]struct{}
+	batchWritersMu sync.Mutex
+	// pauseState is the running, pausing or paused state of the Client's writes, see Pause. It is
+	// accessed atomically.
+	pauseState int32
 }
 
+const (
+	// writesRunning is the pauseState of a Client accepting writes
+	writesRunning int32 = iota
+	// writesPausing is the pauseState of a Client draining its BatchWriters for Pause, whose Add
+	// no longer accepts rows
+	writesPausing
+	// writesPaused is the pauseState of a paused Client, whose writes fail with ErrPaused
+	writesPaused
+)
+
 // Default func returns a *Client with the default config as specified by QuestDB docs
 func Default() *Client {
 	return &Client{
@@ -50,8 +253,12 @@ func Default() *Client {
 	}
 }
 
-// New func returns a *Client and an optional error given a Config
+// New func returns a *Client and an optional error given a Config. The error is an
+// ErrInvalidConfig error listing the problems Config.Validate found, if any.
 func New(config Config) (*Client, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
 	return &Client{
 		config: config,
 	}, nil
@@ -62,82 +269,287 @@ var (
 	ErrILPTLSDial           = errors.New("could not dial tls host")
 	ErrILPNetTCPAddrResolve = errors.New("could not resolve ilp host address")
 	ErrPGOpen               = errors.New("could not open postgres db")
+	ErrILPAuthTimeout       = errors.New("ILP auth: timed out waiting for server challenge")
+	ErrILPLineTooLong       = errors.New("ILP line too long")
+	ErrWriteNotConfirmed    = errors.New("write not confirmed")
+	ErrPGNotConfigured      = errors.New("no PG connection, PGConnStr is not configured or client is not connected")
+	ErrRowsNotInserted      = errors.New("rows not inserted")
+	ErrSchemaMismatch       = errors.New("model does not match table schema")
+	ErrNoFieldsToWrite      = errors.New("no fields to write")
+	ErrMissingPermissions   = errors.New("missing permissions")
+	ErrILPConnClosed        = errors.New("ilp conn closed")
+	ErrInvalidSymbol        = errors.New("invalid symbol")
+	ErrPaused               = errors.New("client is paused")
+	ErrInvalidConfig        = errors.New("invalid config")
+	ErrNotConnected         = errors.New("no ILP connection, client is not connected or was closed")
+	ErrILPConnBroken        = errors.New("ilp conn broken by a partially written line, reconnect with Connect")
+	ErrQueueFull            = errors.New("batch writer queue is full")
+	ErrBatchWriterClosed    = errors.New("batch writer is closed")
 )
 
 // Connect func dials and connects both the Influx line protocol TCP connection as well
-// as the underlying sql PG database connection.
+// as the underlying sql PG database connection. If the Client is already connected, its
+// existing connections are closed before dialing new ones, so Connect can be called again to
+// reconnect. The PG server, if PGConnStr is set, is pinged so that it not being up yet fails the
+// attempt like the ILP dial. A failed connection is retried up to Config.ConnectRetries times,
+// backing off between attempts, and the last attempt's error returned if all fail.
 func (c *Client) Connect() error {
-	tcpAddr, err := net.ResolveTCPAddr("tcp4", c.config.ILPHost)
+	return c.ConnectContext(context.Background())
+}
+
+// ConnectContext func is like Connect but takes a ctx which bounds the address lookup, the
+// dials, the PG ping and the retries:
+// once ctx is done Connect stops retrying and returns the last attempt's error.
+func (c *Client) ConnectContext(ctx context.Context) error {
+	backoff := c.config.ConnectRetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultConnectRetryBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		err := c.connect(ctx)
+		if err == nil || attempt > c.config.ConnectRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (gave up after %d attempts: %v)", err, attempt, ctx.Err())
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > connectMaxBackoff {
+			backoff = connectMaxBackoff
+		}
+	}
+}
+
+// connect func makes a single attempt at Connect
+func (c *Client) connect(ctx context.Context) error {
+	network := c.ilpNetwork()
+	tcpAddr, err := resolveTCPAddr(ctx, network, c.config.ILPHost)
 	if err != nil {
 		return fmt.Errorf("%w: %v", ErrILPNetTCPAddrResolve, err)
 	}
 
+	// close the connections of a previous Connect rather than leaking them. They may already be
+	// broken, which is often why Connect is called again, so errors closing them are ignored.
+	if conn, _ := c.ilp(); conn != nil || c.pgSqlDB != nil {
+		c.stats.recordReconnect()
+		c.Close()
+	}
+
+	var conn net.Conn
+
+	dialer := &net.Dialer{}
+	if c.config.ILPLocalAddr != nil {
+		dialer.LocalAddr = c.config.ILPLocalAddr
+	}
 	if c.config.TLSConfig != nil {
-		conn, err := tls.Dial("tcp", c.config.ILPHost, c.config.TLSConfig)
-		if err != nil {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: c.config.TLSConfig}
+		if conn, err = tlsDialer.DialContext(ctx, network, c.config.ILPHost); err != nil {
 			return fmt.Errorf("%w: %v", ErrILPTLSDial, err)
 		}
-		c.ilpConn = conn
 	} else {
-		conn, err := net.DialTCP("tcp", nil, tcpAddr)
-		if err != nil {
+		if conn, err = dialer.DialContext(ctx, network, tcpAddr.String()); err != nil {
 			return fmt.Errorf("%w: %v", ErrILPNetDial, err)
 		}
-		c.ilpConn = conn
 	}
 
 	if c.config.ILPAuthPrivateKey != "" {
-		if c.config.ILPAuthKid == "" {
-			return fmt.Errorf("cannot authenticate ilp without 'ILPAuthKid' set in config")
+		if err := c.authenticate(conn); err != nil {
+			conn.Close()
+			return err
 		}
+	}
+	// the server sends nothing once authenticated, so the connection can be watched for it
+	// being closed from then on
+	c.ilpMu.Lock()
+	c.ilpConn = conn
+	c.ilpWatch = watchConn(conn)
+	c.ilpMu.Unlock()
 
-		// Parse and create private key
-		keyRaw, err := base64.RawURLEncoding.DecodeString(c.config.ILPAuthPrivateKey)
-		if err != nil {
-			return fmt.Errorf("could not base64 decode ilp private key: %w", err)
+	// ILP only clients leave PGConnStr empty and have no PG connection
+	if c.config.PGConnStr == "" {
+		return nil
+	}
+
+	// sql.Open does not connect, so the PG server is pinged for a PG server which is not up yet
+	// to fail the attempt, like an ILP server which is not up yet does
+	db, err := sql.Open("postgres", c.config.PGConnStr)
+	if err == nil {
+		if err = db.PingContext(ctx); err != nil {
+			db.Close()
 		}
-		key := new(ecdsa.PrivateKey)
-		key.PublicKey.Curve = elliptic.P256()
-		key.PublicKey.X, key.PublicKey.Y = key.PublicKey.Curve.ScalarBaseMult(keyRaw)
-		key.D = new(big.Int).SetBytes(keyRaw)
+	}
+	if err != nil {
+		c.closeILP()
+		return fmt.Errorf("%w: %v", ErrPGOpen, err)
+	}
+	c.configurePGPool(db)
+
+	c.pgSqlDB = db
 
-		// send key ID
+	return nil
+}
 
-		reader := bufio.NewReader(c.ilpConn)
-		_, err = c.ilpConn.Write([]byte(c.config.ILPAuthKid + "\n"))
-		if err != nil {
-			return fmt.Errorf("could not write to ilp tcp conn: %w", err)
+// resolveTCPAddr func is like net.ResolveTCPAddr but looks the host of address up with ctx, so
+// a slow DNS lookup is bounded by it
+func resolveTCPAddr(ctx context.Context, network, address string) (*net.TCPAddr, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	portNum, err := net.DefaultResolver.LookupPort(ctx, network, port)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		return &net.TCPAddr{Port: portNum}, nil
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	// like net.ResolveTCPAddr, prefer an IPv4 address unless network requires IPv6
+	var found *net.IPAddr
+	for i, ip := range ips {
+		isIPv4 := ip.IP.To4() != nil
+		if (network == "tcp4" && !isIPv4) || (network == "tcp6" && isIPv4) {
+			continue
 		}
-
-		raw, err := reader.ReadBytes('\n')
-		if err != nil {
-			return fmt.Errorf("could not read from ilp conn: %w", err)
+		if found == nil || (network == "tcp" && isIPv4 && found.IP.To4() == nil) {
+			found = &ips[i]
 		}
-		// Remove the `\n` is last position
-		raw = raw[:len(raw)-1]
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no %s address found for host %s", network, host)
+	}
+	return &net.TCPAddr{IP: found.IP, Port: portNum, Zone: found.Zone}, nil
+}
 
-		// Hash the challenge with sha256
-		hash := crypto.SHA256.New()
-		hash.Write(raw)
-		hashed := hash.Sum(nil)
+// configurePGPool func applies the PG connection pool settings of the Client's config to db
+func (c *Client) configurePGPool(db *sql.DB) {
+	db.SetMaxOpenConns(c.config.PGMaxOpenConns)
+	if c.config.PGMaxIdleConns != 0 {
+		db.SetMaxIdleConns(c.config.PGMaxIdleConns)
+	}
+	db.SetConnMaxLifetime(c.config.PGConnMaxLifetime)
+}
 
-		a, b, err := ecdsa.Sign(rand.Reader, key, hashed)
-		if err != nil {
-			return fmt.Errorf("could not ecdsa sign key: %w", err)
-		}
-		stdSig := append(a.Bytes(), b.Bytes()...)
-		_, err = c.ilpConn.Write([]byte(base64.StdEncoding.EncodeToString(stdSig) + "\n"))
-		if err != nil {
-			return fmt.Errorf("could not write to ilp tcp conn: %w", err)
+// pgNotConfigured struct is a database/sql driver and connector which fails every connection
+// with ErrPGNotConfigured
+type pgNotConfigured struct{}
+
+// Open func implements the driver.Driver interface
+func (pgNotConfigured) Open(string) (driver.Conn, error) {
+	return nil, ErrPGNotConfigured
+}
+
+// Connect func implements the driver.Connector interface
+func (pgNotConfigured) Connect(context.Context) (driver.Conn, error) {
+	return nil, ErrPGNotConfigured
+}
+
+// Driver func implements the driver.Connector interface
+func (pgNotConfigured) Driver() driver.Driver {
+	return pgNotConfigured{}
+}
+
+// pgNotConfiguredDB is the *sql.DB used by the PG methods of clients without a PG connection,
+// so they return ErrPGNotConfigured rather than panic. It is opened on first use, as opening a
+// *sql.DB starts a goroutine which programs never using such a client should not pay for.
+var (
+	pgNotConfiguredDB     *sql.DB
+	pgNotConfiguredDBOnce sync.Once
+)
+
+// db func returns the PG sql DB of the client, or pgNotConfiguredDB if it has none
+func (c *Client) db() *sql.DB {
+	if c.pgSqlDB == nil {
+		pgNotConfiguredDBOnce.Do(func() {
+			pgNotConfiguredDB = sql.OpenDB(pgNotConfigured{})
+		})
+		return pgNotConfiguredDB
+	}
+	return c.pgSqlDB
+}
+
+// ilpNetwork func returns the network the ILP connection is dialed on: "tcp4" or "tcp6" to match
+// the family of a configured ILPLocalAddr, otherwise "tcp" so both IPv4 and IPv6 hosts resolve.
+func (c *Client) ilpNetwork() string {
+	if c.config.ILPLocalAddr == nil || c.config.ILPLocalAddr.IP == nil {
+		return "tcp"
+	}
+	if c.config.ILPLocalAddr.IP.To4() != nil {
+		return "tcp4"
+	}
+	return "tcp6"
+}
+
+// authenticate func performs the ILP challenge/response handshake over conn using
+// the configured ILPAuthKid and ILPAuthPrivateKey. The handshake is bounded by the
+// configured ILPAuthTimeout so a server that never sends a challenge cannot block forever.
+func (c *Client) authenticate(conn net.Conn) error {
+	if c.config.ILPAuthKid == "" {
+		return fmt.Errorf("cannot authenticate ilp without 'ILPAuthKid' set in config")
+	}
+
+	// Parse and create private key
+	keyRaw, err := base64.RawURLEncoding.DecodeString(c.config.ILPAuthPrivateKey)
+	if err != nil {
+		return fmt.Errorf("could not base64 decode ilp private key: %w", err)
+	}
+	key := new(ecdsa.PrivateKey)
+	key.PublicKey.Curve = elliptic.P256()
+	key.PublicKey.X, key.PublicKey.Y = key.PublicKey.Curve.ScalarBaseMult(keyRaw)
+	key.D = new(big.Int).SetBytes(keyRaw)
+
+	timeout := c.config.ILPAuthTimeout
+	if timeout <= 0 {
+		timeout = DefaultILPAuthTimeout
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return fmt.Errorf("could not set ilp conn deadline: %w", err)
+	}
+
+	// send key ID
+
+	reader := bufio.NewReader(conn)
+	_, err = conn.Write([]byte(c.config.ILPAuthKid + "\n"))
+	if err != nil {
+		return fmt.Errorf("could not write to ilp tcp conn: %w", err)
+	}
+
+	raw, err := reader.ReadBytes('\n')
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return fmt.Errorf("%w: %v", ErrILPAuthTimeout, err)
 		}
+		return fmt.Errorf("could not read from ilp conn: %w", err)
 	}
+	// Remove the `\n` is last position
+	raw = raw[:len(raw)-1]
 
-	db, err := sql.Open("postgres", c.config.PGConnStr)
+	// Hash the challenge with sha256
+	hash := crypto.SHA256.New()
+	hash.Write(raw)
+	hashed := hash.Sum(nil)
+
+	a, b, err := ecdsa.Sign(rand.Reader, key, hashed)
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrPGOpen, err)
+		return fmt.Errorf("could not ecdsa sign key: %w", err)
+	}
+	stdSig := append(a.Bytes(), b.Bytes()...)
+	_, err = conn.Write([]byte(base64.StdEncoding.EncodeToString(stdSig) + "\n"))
+	if err != nil {
+		return fmt.Errorf("could not write to ilp tcp conn: %w", err)
 	}
 
-	c.pgSqlDB = db
+	// clear the handshake deadline so it does not affect subsequent writes
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return fmt.Errorf("could not clear ilp conn deadline: %w", err)
+	}
 
 	return nil
 }
@@ -146,117 +558,1153 @@ func (c *Client) Connect() error {
 // the PG sql database connection
 func (c *Client) Close() error {
 	errs := []error{}
-	if err := c.pgSqlDB.Close(); err != nil {
-		errs = append(errs, fmt.Errorf("could not close pg sql db: %w", err))
+	if err := c.closeStmts(); err != nil {
+		errs = append(errs, fmt.Errorf("could not close prepared statements: %w", err))
 	}
-	if err := c.ilpConn.Close(); err != nil {
+	if c.pgSqlDB != nil {
+		if err := c.pgSqlDB.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("could not close pg sql db: %w", err))
+		}
+		c.pgSqlDB = nil
+	}
+	if err := c.closeILP(); err != nil {
 		errs = append(errs, fmt.Errorf("could not close ilp tcp conn: %w", err))
 	}
-	errStr := ""
-	for i, err := range errs {
-		if i > 0 {
-			errStr += " "
+
+	return joinErrors(errs)
+}
+
+// closeILP func closes the ILP connection, if any. Writes in progress on it fail, while later
+// ones return ErrNotConnected.
+func (c *Client) closeILP() error {
+	c.ilpMu.Lock()
+	conn := c.ilpConn
+	c.ilpConn = nil
+	c.ilpWatch = nil
+	c.ilpMu.Unlock()
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
+
+// ilp func returns the ILP connection and its watch, which are nil if the Client is not connected
+func (c *Client) ilp() (net.Conn, *connWatch) {
+	c.ilpMu.RLock()
+	defer c.ilpMu.RUnlock()
+	return c.ilpConn, c.ilpWatch
+}
+
+// Connected func returns whether the Client has connections open by Connect which have not been
+// closed by Close, and the server has not closed the ILP connection (e.g. as idle). It does not
+// check the PG connections are still alive.
+func (c *Client) Connected() bool {
+	conn, watch := c.ilp()
+	if watch != nil && watch.closedErr() != nil {
+		return false
+	}
+	return conn != nil || c.pgSqlDB != nil
+}
+
+// connWatch struct watches a connection the server sends nothing on for the server closing it
+type connWatch struct {
+	// closed is closed once the connection is closed, after err is set to the read error
+	closed chan struct{}
+	err    error
+}
+
+// watchConn func starts watching conn for the server closing it. A closed TCP connection can
+// still be written to, as the data is buffered, so without reading from it a write after the
+// server closed it would succeed and the data be silently lost.
+func watchConn(conn net.Conn) *connWatch {
+	w := &connWatch{closed: make(chan struct{})}
+	go func() {
+		b := make([]byte, 64)
+		for {
+			if _, err := conn.Read(b); err != nil {
+				w.err = err
+				close(w.closed)
+				return
+			}
 		}
-		errStr += fmt.Sprintf("%d: %s;", i, err)
+	}()
+	return w
+}
+
+// closedErr func returns the error which the connection was found closed with, or nil if it is
+// still open
+func (w *connWatch) closedErr() error {
+	select {
+	case <-w.closed:
+		return w.err
+	default:
+		return nil
 	}
+}
 
-	if errStr != "" {
-		return fmt.Errorf("%s", errStr)
+// write func writes b to the underlying InfluxDB line protocol connection. Every write method
+// on Client goes through write. ctx is checked for cancellation before writing and its deadline,
+// if any, bounds the write. Writes are serialized, and one which fails after writing part of b
+// closes the connection and returns ErrILPConnBroken, as the next line written would otherwise be
+// appended to the partial one. It returns ErrNotConnected if the Client has no ILP connection,
+// i.e. it never connected, its Connect failed or it was closed. lines is the number of lines in b,
+// which is counted where they are built as the binary values of double arrays may hold newline
+// bytes.
+func (c *Client) write(ctx context.Context, b []byte, lines int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if atomic.LoadInt32(&c.pauseState) == writesPaused {
+		return ErrPaused
+	}
+	conn, watch := c.ilp()
+	if conn == nil {
+		c.stats.recordWriteError(ErrNotConnected)
+		return ErrNotConnected
+	}
+	if watch != nil {
+		if err := watch.closedErr(); err != nil {
+			err = fmt.Errorf("%w: %v", ErrILPConnClosed, err)
+			c.stats.recordWriteError(err)
+			return err
+		}
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetWriteDeadline(deadline); err != nil {
+			return fmt.Errorf("could not set ilp conn write deadline: %w", err)
+		}
+		defer conn.SetWriteDeadline(time.Time{})
 	}
 
+	n, err := conn.Write(b)
+	if err != nil {
+		if n > 0 {
+			// QuestDB drops the partial line of a connection closed mid line
+			conn.Close()
+			err = fmt.Errorf("%w: %v", ErrILPConnBroken, err)
+		}
+		c.stats.recordWriteError(err)
+		return err
+	}
+	c.stats.recordWrite(lines, n, c.now())
 	return nil
 }
 
-// WriteMessage func takes a message and writes it to the underlying InfluxDB line protocol
+// now func returns the current time of the Client's Clock
+func (c *Client) now() time.Time {
+	if c.config.Clock != nil {
+		return c.config.Clock()
+	}
+	return time.Now()
+}
+
+// Stats func returns a snapshot of the client's ILP connection statistics
+func (c *Client) Stats() Stats {
+	s := c.stats.snapshot()
+	s.QueueDepth = c.queueDepth()
+	_, watch := c.ilp()
+	s.ILPConnClosed = watch != nil && watch.closedErr() != nil
+	return s
+}
+
+// WriteMessage func takes a message and writes it to the underlying InfluxDB line protocol. The
+// message is written ending with exactly one newline, which is added if missing, so its last line
+// is ingested right away. A message with nothing but newlines is not written. The message is
+// taken to be text in which every newline ends a line, so it must not hold double arrays, whose
+// binary values may contain newline bytes; write them with Write, WriteLine or
+// WriteLineBuffer instead.
 func (c *Client) WriteMessage(message []byte) error {
-	_, err := c.ilpConn.Write(message)
+	return c.WriteMessageContext(context.Background(), message)
+}
+
+// WriteMessageContext func is like WriteMessage but takes a ctx which bounds the write
+func (c *Client) WriteMessageContext(ctx context.Context, message []byte) error {
+	message = terminateLines(message)
+	if len(message) == 0 {
+		return nil
+	}
+	return c.write(ctx, message, bytes.Count(message, []byte{'\n'}))
+}
+
+// ILPWriter func returns an io.Writer which writes raw Influx Line Protocol text to the Client's
+// ILP connection, e.g. to io.Copy an existing ILP stream into QuestDB. Writes are buffered up to
+// the last newline so that only complete lines are written to the connection, even when the
+// text is split across writes, which keeps lines intact when other writes are made through the
+// Client. Text after the last newline is held until a later write completes its line. As every
+// newline is taken to end a line, the text must not hold double arrays, whose binary values may
+// contain newline bytes; write them with Write, WriteLine or WriteLineBuffer instead.
+func (c *Client) ILPWriter() io.Writer {
+	return &ilpWriter{client: c}
+}
+
+// ilpWriter struct is the io.Writer returned by Client.ILPWriter
+type ilpWriter struct {
+	client *Client
+	// pending holds the text of an incomplete line
+	pending []byte
+}
+
+// Write func implements the io.Writer interface
+func (w *ilpWriter) Write(p []byte) (int, error) {
+	i := bytes.LastIndexByte(p, '\n')
+	if i < 0 {
+		w.pending = append(w.pending, p...)
+		return len(p), nil
+	}
+
+	b := append(w.pending, p[:i+1]...)
+	if err := w.client.write(context.Background(), b, bytes.Count(b, []byte{'\n'})); err != nil {
+		return 0, err
+	}
+	w.pending = append(w.pending[:0], p[i+1:]...)
+	return len(p), nil
+}
+
+// WriteLine func takes a *Line and writes it to the underlying InfluxDB line protocol
+func (c *Client) WriteLine(l *Line) error {
+	return c.WriteLineContext(context.Background(), l)
+}
+
+// WriteLineContext func is like WriteLine but takes a ctx which bounds the write
+func (c *Client) WriteLineContext(ctx context.Context, l *Line) error {
+	line, err := c.appendLine(nil, l)
 	if err != nil {
 		return err
 	}
+	return c.traceWrite(ctx, "questdb.WriteLine", []string{l.tableName}, line, 1)
+}
+
+// WriteLines func takes a slice of *Line and writes them to the underlying InfluxDB line
+// protocol in a single write
+func (c *Client) WriteLines(lines []*Line) error {
+	return c.WriteLinesContext(context.Background(), lines)
+}
+
+// WriteLinesContext func is like WriteLines but takes a ctx which bounds the write
+func (c *Client) WriteLinesContext(ctx context.Context, lines []*Line) error {
+	var b []byte
+	tables := []string{}
+	for _, l := range lines {
+		var err error
+		if b, err = c.appendLine(b, l); err != nil {
+			return err
+		}
+		tables = append(tables, l.tableName)
+	}
+	return c.traceWrite(ctx, "questdb.WriteLines", tables, b, len(lines))
+}
+
+// lineFormat func returns the format the Client writes l in: the dialect set with SetDialect,
+// else the Client's ILPDialect, without type suffixes if LegacyIntFormat is set
+func (c *Client) lineFormat(l *Line) lineFormat {
+	format := l.format
+	if format.dialect == nil {
+		format.dialect = c.config.ILPDialect
+	}
+	format.legacyIntFormat = format.legacyIntFormat || c.config.LegacyIntFormat
+	return format
+}
+
+// appendLine func appends l, in the Client's format, to b, checking it against the configured
+// MaxLineBytes. On error b is returned as it was.
+func (c *Client) appendLine(b []byte, l *Line) ([]byte, error) {
+	start := len(b)
+	b, err := l.appendTo(b, c.lineFormat(l))
+	if err == nil {
+		err = c.checkLineLength(l.tableName, len(b)-start)
+	}
+	if err != nil {
+		return b[:start], err
+	}
+	return b, nil
+}
+
+// checkLineLength func returns an error if a line of size bytes (destined for table) exceeds the
+// configured MaxLineBytes
+func (c *Client) checkLineLength(table string, size int) error {
+	if c.config.MaxLineBytes > 0 && size > c.config.MaxLineBytes {
+		return fmt.Errorf("%w: ILP line for table '%s' exceeds %d bytes (%d bytes)", ErrILPLineTooLong, table, c.config.MaxLineBytes, size)
+	}
 	return nil
 }
 
-// Write takes a valid struct with qdb tags and writes it to the underlying InfluxDB line protocol
-func (c *Client) Write(a interface{}, options ...option) error {
+// marshalLine func returns the ILP line of m, or the lines of an exploded field, and their
+// number, checking each against the configured MaxLineBytes
+func (c *Client) marshalLine(m *Model) ([]byte, int, error) {
+	return c.appendLines(nil, m)
+}
+
+// appendLines func appends the ILP line of m, or the lines of an exploded field, to b, checking
+// each against the configured MaxLineBytes, and returns the number of lines appended. On error b
+// is returned as it was.
+func (c *Client) appendLines(b []byte, m *Model) ([]byte, int, error) {
+	start := len(b)
+	lines := 0
+	var lengthErr error
+	err := m.eachLine(func(parts lineParts) {
+		if lengthErr == nil {
+			lengthErr = c.checkLineLength(m.tableName, parts.size())
+		}
+		b = parts.appendTo(b)
+		lines++
+	})
+	if err == nil {
+		err = lengthErr
+	}
+	if err != nil {
+		return b[:start], 0, err
+	}
+	return b, lines, nil
+}
+
+// NewModel func is like the package's NewModel but applies options and the Client's Config, such
+// as its TableNamePrefix and TypeMapper, so the Model's statements (e.g. SampleByStatement and
+// CreateTableIfNotExistStatement) and lines match those of the Client's own methods.
+func (c *Client) NewModel(a interface{}, options ...option) (*Model, error) {
+	return c.newModel(a, options)
+}
+
+// newModel func returns the *Model of a with options and the client's config applied
+func (c *Client) newModel(a interface{}, options []option) (*Model, error) {
 	m, err := NewModel(a)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	m.clock = c.config.Clock
+	if err := applyOptions(m, options); err != nil {
+		return nil, err
+	}
+	// the affixes apply to the resolved name, whether it is the default, a TableNamer's or a
+	// WithTableName one
+	if c.config.TableNamePrefix != "" || c.config.TableNameSuffix != "" {
+		m.tableName = c.config.TableNamePrefix + m.tableName + c.config.TableNameSuffix
+		if m.shardBase != "" {
+			m.shardBase = c.config.TableNamePrefix + m.shardBase + c.config.TableNameSuffix
+			m.applyShard()
+		}
+	}
+	if c.config.TableNameTransformer != nil {
+		m.tableNameTransformer = c.config.TableNameTransformer
+		m.tableName = m.tableNameTransformer(m.tableName)
+		m.applyShard()
+	}
+	m.format.legacyIntFormat = c.config.LegacyIntFormat
+	m.format.dialect = c.config.ILPDialect
+	m.format.timestampResolution = c.config.TimestampResolution
+	m.typeMapper = c.config.TypeMapper
+	if c.config.TypeMapper != nil {
+		if err := joinErrors(m.symbolPlacementErrors()); err != nil {
+			return nil, err
+		}
 	}
+	return m, nil
+}
 
-	if len(options) > 0 {
-		for _, opt := range options {
-			// check and set all options here
-			if opt.tableName != "" {
-				m.tableName = opt.tableName
-			}
+// marshalRow func returns the table name, ILP line and number of lines of row. A row
+// implementing LineMarshaler is marshaled by its MarshalLine method (options do not apply to it),
+// any other row must be a valid struct with qdb tags and is marshaled by its Model. The line of a
+// *Line is always a single terminated line, which may hold the binary values of double arrays,
+// the lines of other LineMarshalers are taken to be text, see WriteMessage.
+func (c *Client) marshalRow(row interface{}, options []option) (string, []byte, int, error) {
+	if l, ok := row.(*Line); ok {
+		line, err := c.appendLine(nil, l)
+		if err != nil {
+			return "", nil, 0, err
+		}
+		return l.tableName, line, 1, nil
+	}
+	if lm, ok := row.(LineMarshaler); ok {
+		line, err := lm.MarshalLine()
+		if err != nil {
+			return "", nil, 0, err
+		}
+		line = terminateLines(line)
+		table := lineTableName(line)
+		if err := c.checkLineLength(table, len(line)); err != nil {
+			return "", nil, 0, err
 		}
+		return table, line, bytes.Count(line, []byte{'\n'}), nil
 	}
 
-	line := m.MarshalLine()
-	_, err = c.ilpConn.Write(line)
+	m, err := c.newModel(row, options)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	line, lines, err := c.marshalLine(m)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	return m.tableName, line, lines, nil
+}
+
+// Write takes a valid struct with qdb tags, or a LineMarshaler, and writes it to the underlying
+// InfluxDB line protocol
+func (c *Client) Write(a interface{}, options ...option) error {
+	return c.WriteContext(context.Background(), a, options...)
+}
+
+// WriteContext func is like Write but takes a ctx which bounds the write
+func (c *Client) WriteContext(ctx context.Context, a interface{}, options ...option) error {
+	table, line, lines, err := c.marshalRow(a, options)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	return c.traceWrite(ctx, "questdb.Write", []string{table}, line, lines)
+}
+
+// Upsert func writes v, a valid struct with qdb tags, as the new version of the row with the same
+// designated timestamp and key columns, e.g. after scanning the row with ScanInto and correcting
+// a field. ILP only appends rows: the row is only replaced if the table deduplicates on upsert
+// keys (i.e. it is a WAL table created or altered with DEDUP UPSERT KEYS(<designated timestamp>,
+// <keys>...)), otherwise a second row is appended. Upsert returns an error if v has no designated
+// timestamp value, as QuestDB would stamp the row with the current time instead. As the row
+// replaces the stored one as a whole, every field is written, including zero values, except nil
+// pointers which are written as null; scan nullable columns into pointer fields to keep their
+// nulls.
+func (c *Client) Upsert(v interface{}, options ...option) error {
+	return c.UpsertContext(context.Background(), v, options...)
 }
 
+// UpsertContext func is like Upsert but takes a ctx which bounds the write
+func (c *Client) UpsertContext(ctx context.Context, v interface{}, options ...option) error {
+	m, err := c.newModel(v, options)
+	if err != nil {
+		return err
+	}
+	if m.designatedTS == nil || (m.designatedTS.isZero && m.timestamp.IsZero()) {
+		return fmt.Errorf("upserting %s requires a designated timestamp value", m.tableName)
+	}
+	m.commitZeroValues = true
+
+	line, lines, err := c.marshalLine(m)
+	if err != nil {
+		return err
+	}
+	return c.traceWrite(ctx, "questdb.Upsert", []string{m.tableName}, line, lines)
+}
+
+// WriteBatch takes a slice of valid structs with qdb tags (or LineMarshalers) and writes them to the underlying InfluxDB
+// line protocol in a single write, preserving the order of rows.
 func (c *Client) WriteBatch(rows []interface{}, options ...option) error {
-	var models []*Model
+	return c.WriteBatchContext(context.Background(), rows, options...)
+}
+
+// WriteBatchContext func is like WriteBatch but takes a ctx which bounds the write
+func (c *Client) WriteBatchContext(ctx context.Context, rows []interface{}, options ...option) error {
+	var sb strings.Builder
+	tables := []string{}
+	lines := 0
 	for _, row := range rows {
-		m, err := NewModel(row)
+		table, line, n, err := c.marshalRow(row, options)
 		if err != nil {
 			return err
 		}
-		if len(options) > 0 {
-			for _, opt := range options {
-				// check and set all options here
-				if opt.tableName != "" {
-					m.tableName = opt.tableName
-				}
-			}
+		sb.Write(line)
+		tables = append(tables, table)
+		lines += n
+	}
+	return c.traceWrite(ctx, "questdb.WriteBatch", tables, []byte(sb.String()), lines)
+}
+
+// ValidateBatch func checks that every row of rows would be written cleanly by WriteBatch with
+// options, without writing anything. It returns one error per invalid row (prefixed with the row's
+// index) so every bad row can be reported at once, or nil if all rows are valid.
+func (c *Client) ValidateBatch(rows []interface{}, options ...option) []error {
+	var errs []error
+	for i, row := range rows {
+		if _, _, _, err := c.marshalRow(row, options); err != nil {
+			errs = append(errs, fmt.Errorf("row %d: %w", i, err))
+		}
+	}
+	return errs
+}
+
+// WriteBatchGrouped works like WriteBatch but groups the lines by table before writing them, so all
+// lines of the same table are contiguous. QuestDB ingests contiguous same-table lines more efficiently
+// when rows of several struct types (tables) are mixed. The order of rows within a table is preserved,
+// but the order of rows across different tables is not: tables are written in the order they first
+// appear in rows.
+func (c *Client) WriteBatchGrouped(rows []interface{}, options ...option) error {
+	return c.WriteBatchGroupedContext(context.Background(), rows, options...)
+}
+
+// WriteBatchGroupedContext func is like WriteBatchGrouped but takes a ctx which bounds the write
+func (c *Client) WriteBatchGroupedContext(ctx context.Context, rows []interface{}, options ...option) error {
+	tables := []string{}
+	lines := map[string]*strings.Builder{}
+	count := 0
+	for _, row := range rows {
+		table, line, n, err := c.marshalRow(row, options)
+		if err != nil {
+			return err
+		}
+		sb, ok := lines[table]
+		if !ok {
+			sb = &strings.Builder{}
+			lines[table] = sb
+			tables = append(tables, table)
 		}
-		models = append(models, m)
+		sb.Write(line)
+		count += n
 	}
 
 	var sb strings.Builder
-	for _, m := range models {
-		sb.Write(m.MarshalLine())
+	for _, table := range tables {
+		sb.WriteString(lines[table].String())
 	}
-	_, err := c.ilpConn.Write([]byte(sb.String()))
+	return c.traceWrite(ctx, "questdb.WriteBatchGrouped", tables, []byte(sb.String()), count)
+}
+
+// BatchStats struct describes what WriteBatchFunc wrote
+type BatchStats struct {
+	// Rows is the number of rows written
+	Rows int
+	// Bytes is the number of bytes written
+	Bytes int
+	// Flushes is the number of writes the rows were written in
+	Flushes int
+}
+
+// WriteBatchFunc func writes n rows, valid structs with qdb tags (or LineMarshalers), which are
+// pulled one at a time from gen(0) to gen(n-1), so a large batch can be streamed from a cursor or
+// file without first building a slice of all its rows. Rows are written in order, in chunks of
+// WithBatchSize rows (DefaultBatchSize by default) whose buffer is reused from chunk to chunk. On
+// error, which is prefixed with the index of the row that failed to marshal, the chunks already
+// flushed stay written and the returned BatchStats count them.
+func (c *Client) WriteBatchFunc(n int, gen func(i int) interface{}, options ...option) (BatchStats, error) {
+	return c.WriteBatchFuncContext(context.Background(), n, gen, options...)
+}
+
+// WriteBatchFuncContext func is like WriteBatchFunc but takes a ctx which bounds each write
+func (c *Client) WriteBatchFuncContext(ctx context.Context, n int, gen func(i int) interface{}, options ...option) (BatchStats, error) {
+	batchSize := DefaultBatchSize
+	for _, opt := range options {
+		if opt.batchSize > 0 {
+			batchSize = opt.batchSize
+		}
+	}
+
+	var stats BatchStats
+	var b []byte
+	tables := []string{}
+	buffered, lines := 0, 0
+	flush := func() error {
+		if buffered == 0 {
+			return nil
+		}
+		if err := c.traceWrite(ctx, "questdb.WriteBatchFunc", tables, b, lines); err != nil {
+			return err
+		}
+		stats.Rows += buffered
+		stats.Bytes += len(b)
+		stats.Flushes++
+		b = b[:0]
+		tables = tables[:0]
+		buffered, lines = 0, 0
+		return nil
+	}
+
+	for i := 0; i < n; i++ {
+		table, line, count, err := c.marshalRow(gen(i), options)
+		if err != nil {
+			return stats, fmt.Errorf("row %d: %w", i, err)
+		}
+		b = append(b, line...)
+		tables = append(tables, table)
+		buffered++
+		lines += count
+		if buffered >= batchSize {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+const (
+	// confirmMinBackoff and confirmMaxBackoff bound the wait between WriteConfirmed's polls
+	confirmMinBackoff = 50 * time.Millisecond
+	confirmMaxBackoff = time.Second
+	// ingestLagMinBackoff and ingestLagMaxBackoff bound the wait between MeasureIngestLag's
+	// polls, which are shorter than WriteConfirmed's to measure the lag more finely
+	ingestLagMinBackoff = 5 * time.Millisecond
+	ingestLagMaxBackoff = 100 * time.Millisecond
+)
+
+// WriteConfirmed func writes v, a valid struct with qdb tags, like Write and then polls the PG
+// wire until the row is queryable, returning nil once it is. As ILP has no acknowledgements,
+// this is the only way to know a row has been committed. The row is looked up by its key fields,
+// its designated timestamp and symbol values, so v must have a non zero designated timestamp and
+// together they should identify the row. Polling backs off up to a second between queries and
+// stops when ctx is done, so ctx should have a deadline: if the row does not appear before then,
+// an ErrWriteNotConfirmed error is returned.
+func (c *Client) WriteConfirmed(ctx context.Context, v interface{}) error {
+	m, err := c.newModel(v, nil)
 	if err != nil {
 		return err
 	}
-	return nil
+	_, err = c.writeConfirmed(ctx, "questdb.WriteConfirmed", m, confirmMinBackoff, confirmMaxBackoff)
+	return err
+}
+
+// MeasureIngestLag func writes v, a valid struct with qdb tags with a designated timestamp
+// field, as a probe row and returns the time between sending it and it being queryable over the
+// PG wire, e.g. to monitor an ingestion SLO or tune a table's commit lag. The probe is written
+// with the current time as its designated timestamp, whatever v's is, so each probe is a distinct
+// row in the newest partition; it is looked up by that timestamp and v's symbols, like
+// WriteConfirmed. The PG wire is polled at most every 100ms, which bounds the measurement's
+// precision. If the probe does not appear before ctx is done, an ErrWriteNotConfirmed error is
+// returned. Probes are real rows, so v should be of a table meant for them.
+func (c *Client) MeasureIngestLag(ctx context.Context, v interface{}) (time.Duration, error) {
+	m, err := c.newModel(v, nil)
+	if err != nil {
+		return 0, err
+	}
+	if m.designatedTS == nil {
+		return 0, fmt.Errorf("measuring ingest lag requires a designated timestamp field")
+	}
+	m.SetTimestamp(c.now())
+	return c.writeConfirmed(ctx, "questdb.MeasureIngestLag", m, ingestLagMinBackoff, ingestLagMaxBackoff)
+}
+
+// writeConfirmed func writes the line of m and polls the PG wire, backing off from minBackoff up
+// to maxBackoff between queries, until its row is queryable. It returns the time between the
+// write and the row being found.
+func (c *Client) writeConfirmed(ctx context.Context, spanName string, m *Model, minBackoff, maxBackoff time.Duration) (time.Duration, error) {
+	query, args, err := m.confirmQuery()
+	if err != nil {
+		return 0, err
+	}
+
+	line, lines, err := c.marshalLine(m)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := c.traceWrite(ctx, spanName, []string{m.tableName}, line, lines); err != nil {
+		return 0, err
+	}
+	sent := time.Now()
+
+	backoff := minBackoff
+	for {
+		var count int64
+		// errors are expected until QuestDB has created the table of a first write, so they
+		// only fail the confirmation if the row never appears
+		err := c.db().QueryRowContext(ctx, query, args...).Scan(&count)
+		if err == nil && count > 0 {
+			return time.Since(sent), nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if err == nil {
+				err = ctx.Err()
+			}
+			return 0, fmt.Errorf("%w: %v", ErrWriteNotConfirmed, err)
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+const (
+	// DefaultBatchSize is the number of rows WriteFrom buffers before flushing
+	DefaultBatchSize = 1000
+	// DefaultFlushInterval is the maximum time WriteFrom buffers rows before flushing
+	DefaultFlushInterval = time.Second
+)
+
+// WriteFrom func consumes qdb tagged structs (or LineMarshalers) from ch and writes them to the underlying InfluxDB
+// line protocol in batches. A batch is flushed once it holds WithBatchSize rows or when
+// WithFlushInterval has elapsed, whichever comes first. WriteFrom buffers at most one batch and
+// does not receive from ch while flushing, so a slow QuestDB holds back senders once ch's buffer
+// is full; see BatchWriter for a bounded queue with a non-blocking mode. WriteFrom returns once ch is closed
+// (after flushing any buffered rows) or ctx is cancelled (discarding any buffered rows), or with
+// the first error encountered.
+func (c *Client) WriteFrom(ctx context.Context, ch <-chan interface{}, options ...option) error {
+	return c.writeFrom(ctx, ch, nil, options)
+}
+
+// writeFrom func is WriteFrom which also flushes, along with every row queued in ch, when a flush
+// is requested on flushes. The result of the flush is sent on the requesting channel.
+func (c *Client) writeFrom(ctx context.Context, ch <-chan interface{}, flushes <-chan chan error, options []option) error {
+	batchSize := DefaultBatchSize
+	flushInterval := DefaultFlushInterval
+	for _, opt := range options {
+		if opt.batchSize > 0 {
+			batchSize = opt.batchSize
+		}
+		if opt.flushInterval > 0 {
+			flushInterval = opt.flushInterval
+		}
+	}
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var sb strings.Builder
+	tables := []string{}
+	buffered, lines := 0, 0
+	flush := func() error {
+		if buffered == 0 {
+			return nil
+		}
+		err := c.traceWrite(ctx, "questdb.WriteFrom", tables, []byte(sb.String()), lines)
+		sb.Reset()
+		tables = tables[:0]
+		buffered, lines = 0, 0
+		return err
+	}
+
+	add := func(row interface{}) error {
+		table, line, n, err := c.marshalRow(row, options)
+		if err != nil {
+			return err
+		}
+		sb.Write(line)
+		tables = append(tables, table)
+		buffered++
+		lines += n
+		if buffered >= batchSize {
+			return flush()
+		}
+		return nil
+	}
+	// drain func adds the rows already queued in ch and flushes them with the buffered rows
+	drain := func() error {
+		for {
+			select {
+			case row, ok := <-ch:
+				if !ok {
+					return flush()
+				}
+				if err := add(row); err != nil {
+					return err
+				}
+			default:
+				return flush()
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case row, ok := <-ch:
+			if !ok {
+				return flush()
+			}
+			if err := add(row); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		case reply := <-flushes:
+			err := drain()
+			reply <- err
+			if err != nil {
+				return err
+			}
+		}
+	}
 }
 
-// DB func returns the underlying *sql.DB struct for DB operations over the Postgres wire protocol
+// Pause func stops the Client accepting writes, e.g. for a QuestDB maintenance window, without
+// closing its connections. The rows queued in its BatchWriters are written first, then every
+// write fails with ErrPaused, as does adding rows to a BatchWriter, until Resume is called. While
+// the queued rows are being written, BatchWriters already reject rows but direct writes (Write,
+// WriteLine, WriteMessage...) are still sent, as the queued rows are written through the same
+// path. Pause returns the errors of writing the queued rows, if any. Pausing a paused Client does
+// nothing, and a Resume called before the queued rows are written cancels the Pause.
+func (c *Client) Pause() error {
+	return c.PauseContext(context.Background())
+}
+
+// PauseContext func is like Pause but takes a ctx which bounds the wait for the queued rows to be
+// written. The Client is paused even if ctx is done first.
+func (c *Client) PauseContext(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&c.pauseState, writesRunning, writesPausing) {
+		return nil
+	}
+	// a Resume while flushing has set the state back to running, which is kept
+	defer atomic.CompareAndSwapInt32(&c.pauseState, writesPausing, writesPaused)
+	return c.flushBatchWriters(ctx)
+}
+
+// flushBatchWriters func writes the rows queued in every BatchWriter of the Client, returning
+// the errors of writing them, if any
+func (c *Client) flushBatchWriters(ctx context.Context) error {
+	c.batchWritersMu.Lock()
+	writers := make([]*BatchWriter, 0, len(c.batchWriters))
+	for w := range c.batchWriters {
+		writers = append(writers, w)
+	}
+	c.batchWritersMu.Unlock()
+
+	errs := []error{}
+	for _, w := range writers {
+		if err := w.flush(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+// Resume func makes a paused Client accept writes again
+func (c *Client) Resume() {
+	atomic.StoreInt32(&c.pauseState, writesRunning)
+}
+
+// Paused func returns whether the Client is paused, see Pause
+func (c *Client) Paused() bool {
+	return atomic.LoadInt32(&c.pauseState) != writesRunning
+}
+
+// Commit func is a best-effort nudge for the rows written to tableName to become queryable. ILP
+// has no commit: QuestDB commits ingested rows eventually, per the table's maxUncommittedRows and
+// commitLag (see CreateTableOptions), and nothing sent over the PG wire forces it to. Commit
+// writes the rows queued in the Client's BatchWriters, for every table, so none are held back
+// client side, then returns the number of committed, i.e. queryable, rows of tableName. Rows
+// still uncommitted server side are not counted. Use WriteConfirmed to wait until a given row is
+// queryable.
+func (c *Client) Commit(ctx context.Context, tableName string) (int64, error) {
+	if err := c.flushBatchWriters(ctx); err != nil {
+		return 0, fmt.Errorf("could not write queued rows: %w", err)
+	}
+	var count int64
+	if err := c.db().QueryRowContext(ctx, "SELECT count() FROM "+QuoteIdentifier(unquoteIdentifier(tableName))).Scan(&count); err != nil {
+		return 0, fmt.Errorf("could not count committed rows of %s: %w", tableName, err)
+	}
+	return count, nil
+}
+
+// Ping func verifies the PG wire connection to QuestDB is alive. The ILP protocol has no
+// acknowledgements, so there is no equivalent check for the ILP connection.
+func (c *Client) Ping() error {
+	return c.PingContext(context.Background())
+}
+
+// PingContext func is like Ping but takes a ctx which bounds the check
+func (c *Client) PingContext(ctx context.Context) error {
+	return c.db().PingContext(ctx)
+}
+
+// Query func executes query with args over the PG wire and returns the resulting rows
+func (c *Client) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.QueryContext(context.Background(), query, args...)
+}
+
+// QueryContext func is like Query but takes a ctx which bounds the query
+func (c *Client) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, finish := c.tracer().StartSpan(ctx, "questdb.Query", Attribute{Key: AttributeStatement, Value: query})
+	rows, err := c.db().QueryContext(ctx, query, args...)
+	finish(err)
+	return rows, err
+}
+
+// QueryRow func executes query with args over the PG wire and returns at most one row
+func (c *Client) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.QueryRowContext(context.Background(), query, args...)
+}
+
+// QueryRowContext func is like QueryRow but takes a ctx which bounds the query
+func (c *Client) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, finish := c.tracer().StartSpan(ctx, "questdb.QueryRow", Attribute{Key: AttributeStatement, Value: query})
+	row := c.db().QueryRowContext(ctx, query, args...)
+	finish(row.Err())
+	return row
+}
+
+// QueryScalar func executes query with args over the PG wire and scans its single column
+// result into dest, such as a count or a max timestamp, without defining a struct. Besides the
+// types database/sql scans into, dest may be a *time.Time, which is set in UTC (NULL is the zero
+// time.Time), or any Scanner such as *Bytes, which base64 decodes binary values. It returns
+// sql.ErrNoRows if query returns no rows.
+func (c *Client) QueryScalar(ctx context.Context, query string, dest interface{}, args ...interface{}) error {
+	row := c.QueryRowContext(ctx, query, args...)
+
+	switch d := dest.(type) {
+	case *time.Time:
+		var t sql.NullTime
+		if err := row.Scan(&t); err != nil {
+			return err
+		}
+		*d = time.Time{}
+		if t.Valid {
+			*d = t.Time.UTC()
+		}
+		return nil
+	case Scanner:
+		return row.Scan(newIntermediate(d))
+	default:
+		return row.Scan(dest)
+	}
+}
+
+// DB func returns the underlying *sql.DB struct for DB operations over the Postgres wire protocol.
+// It returns nil if the client is not connected or PGConnStr is empty (an ILP only client), in
+// which case the Client's own PG methods return ErrPGNotConfigured.
 func (c *Client) DB() *sql.DB {
 	return c.pgSqlDB
 }
 
 // CreateTableIfNotExists func takes a valid 'qdb' tagged struct v and attempts to create the table
 // (via the PG wire) in QuestDB and returns an possible error. You can optionally pass a custom table name.
+// It is safe to call from many workers at once: an "already exists" error from a concurrent
+// creation counts as success, and transient table lock errors are retried a few times.
 func (c *Client) CreateTableIfNotExists(v interface{}, options ...option) error {
-	// make model from v
-	model, err := NewModel(v)
+	return c.CreateTableIfNotExistsContext(context.Background(), v, options...)
+}
+
+// AssertSchema func checks that the live table of v, a valid struct with qdb tags, has a column
+// of the expected type for every column of v's model, using the types the create table statement
+// would declare (i.e. after the Config's TypeMapper). It returns an error wrapping
+// ErrSchemaMismatch which lists every missing or mistyped column, or the table does not exist.
+// Table columns the model does not have are ignored, as writes only need the model's columns.
+// This catches schema drift, e.g. in CI against a test QuestDB, before ILP writes silently
+// coerce or drop mistyped values.
+func (c *Client) AssertSchema(v interface{}, options ...option) error {
+	return c.AssertSchemaContext(context.Background(), v, options...)
+}
+
+// AssertSchemaContext func is like AssertSchema but takes a ctx which bounds the query
+func (c *Client) AssertSchemaContext(ctx context.Context, v interface{}, options ...option) error {
+	m, err := c.newModel(v, options)
 	if err != nil {
 		return fmt.Errorf("could not make new model: %w", err)
 	}
 
-	if len(options) > 0 {
-		for _, opt := range options {
-			// check and set options here
-			if opt.tableName != "" {
-				model.tableName = opt.tableName
-			}
+	rows, err := c.QueryContext(ctx, fmt.Sprintf(`SELECT "column", "type" FROM table_columns(%s)`, quoteString(m.tableName)))
+	if err != nil {
+		return fmt.Errorf("could not query table columns: %w", err)
+	}
+	defer rows.Close()
+	live := map[string]string{}
+	for rows.Next() {
+		var column, typ string
+		if err := rows.Scan(&column, &typ); err != nil {
+			return fmt.Errorf("could not scan table columns: %w", err)
+		}
+		live[column] = typ
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("could not query table columns: %w", err)
+	}
+	if len(live) == 0 {
+		return fmt.Errorf("%w: table %s does not exist", ErrSchemaMismatch, m.tableName)
+	}
+
+	errs := []error{}
+	for _, column := range m.schemaColumns() {
+		typ, ok := live[column.name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("column '%s' is missing, expected %s", column.name, column.qdbType))
+			continue
+		}
+		if !strings.EqualFold(typ, string(column.qdbType)) {
+			errs = append(errs, fmt.Errorf("column '%s' is %s, expected %s", column.name, strings.ToLower(typ), column.qdbType))
 		}
 	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: table %s: %v", ErrSchemaMismatch, m.tableName, joinErrors(errs))
+	}
+	return nil
+}
+
+// CheckPermissions func checks that the PG user of the Client can select from the table of v, a
+// valid struct with qdb tags, and create tables, so a deployment lacking privileges fails at
+// startup with an actionable error rather than deep in a request. It returns an error wrapping
+// ErrMissingPermissions which lists every failed check with the server's reason. The table not
+// existing yet is not an error, as long as tables can be created.
+//
+// QuestDB has no side effect free way to check a user may create tables, so CheckPermissions is
+// not read only: creation is checked by creating an empty probe table named
+// questdb_go_permission_check_<unix nanos> and dropping it again, which needs the user to be able
+// to drop tables it created. The drop runs with its own context, so it still runs if ctx is done
+// in between; if it fails anyway the returned error names the probe table left behind. INSERT is
+// not checked: writes over ILP are authorized separately (see Config.ILPAuthKid).
+func (c *Client) CheckPermissions(v interface{}, options ...option) error {
+	return c.CheckPermissionsContext(context.Background(), v, options...)
+}
 
-	// execute create table if not exists statement
-	_, err = c.DB().Exec(model.CreateTableIfNotExistStatement())
+// CheckPermissionsContext func is like CheckPermissions but takes a ctx which bounds the
+// statements executed
+func (c *Client) CheckPermissionsContext(ctx context.Context, v interface{}, options ...option) error {
+	m, err := c.newModel(v, options)
 	if err != nil {
-		return fmt.Errorf("could not execute sql statement: %w", err)
+		return fmt.Errorf("could not make new model: %w", err)
+	}
+
+	errs := []error{}
+	rows, err := c.db().QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s LIMIT 0", QuoteIdentifier(m.tableName)))
+	if err == nil {
+		rows.Close()
+		err = rows.Err()
+	}
+	if err != nil && !isTableNotExistsError(err) {
+		errs = append(errs, fmt.Errorf("cannot select from %s: %v", m.tableName, err))
+	}
+
+	probe := QuoteIdentifier(fmt.Sprintf("questdb_go_permission_check_%d", time.Now().UnixNano()))
+	_, err = c.db().ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (x int)", probe))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("cannot create tables: %v", err))
+	}
+	// the probe is dropped if it was created, or may have been before ctx was done
+	if err == nil || ctx.Err() != nil {
+		dropCtx, cancel := context.WithTimeout(context.Background(), permissionProbeDropTimeout)
+		_, err := c.db().ExecContext(dropCtx, fmt.Sprintf("DROP TABLE IF EXISTS %s", probe))
+		cancel()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot drop probe table %s, which was left behind: %v", probe, err))
+		}
 	}
 
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %v", ErrMissingPermissions, joinErrors(errs))
+	}
 	return nil
 }
+
+// permissionProbeDropTimeout bounds the drop of CheckPermissions' probe table, which does not use
+// the caller's ctx
+const permissionProbeDropTimeout = 10 * time.Second
+
+// isTableNotExistsError func reports whether err is QuestDB reporting that a table does not exist
+func isTableNotExistsError(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "does not exist")
+}
+
+// CreateTableIfNotExistsContext func is like CreateTableIfNotExists but takes a ctx which bounds
+// the statement execution
+func (c *Client) CreateTableIfNotExistsContext(ctx context.Context, v interface{}, options ...option) error {
+	// make model from v
+	model, err := c.newModel(v, options)
+	if err != nil {
+		return fmt.Errorf("could not make new model: %w", err)
+	}
+	return c.createTable(ctx, model)
+}
+
+// createTable func executes the create table if not exists statement of m, retrying while a
+// concurrent creation of the same table holds its lock
+func (c *Client) createTable(ctx context.Context, m *Model) error {
+	statement := m.CreateTableIfNotExistStatement()
+	backoff := createTableMinBackoff
+	for attempt := 1; ; attempt++ {
+		_, err := c.db().ExecContext(ctx, statement)
+		if err == nil || isTableExistsError(err) {
+			return nil
+		}
+		if !isTableLockedError(err) || attempt == createTableAttempts {
+			return fmt.Errorf("could not execute sql statement: %w", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("could not execute sql statement: %w", err)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// TableExists func returns whether the table name exists, according to QuestDB's tables()
+// metadata. The name is matched exactly, as given to WithTableName.
+func (c *Client) TableExists(name string) (bool, error) {
+	return c.TableExistsContext(context.Background(), name)
+}
+
+// TableExistsContext func is like TableExists but takes a ctx which bounds the query
+func (c *Client) TableExistsContext(ctx context.Context, name string) (bool, error) {
+	var count int64
+	err := c.QueryRowContext(ctx, "SELECT count() FROM tables() WHERE table_name = $1", unquoteIdentifier(name)).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("could not query tables: %w", err)
+	}
+	return count > 0, nil
+}
+
+// EnsureTable func creates the table of v, a valid struct with qdb tags, like
+// CreateTableIfNotExists but only executes the create table statement if TableExists finds no
+// such table, which saves the DDL round trip when it already exists, e.g. on a restart. It
+// returns whether it executed the statement; a concurrent creation of the same table may still
+// have won the race, which is not an error.
+func (c *Client) EnsureTable(ctx context.Context, v interface{}, options ...option) (bool, error) {
+	m, err := c.newModel(v, options)
+	if err != nil {
+		return false, fmt.Errorf("could not make new model: %w", err)
+	}
+	exists, err := c.TableExistsContext(ctx, m.tableName)
+	if err != nil || exists {
+		return false, err
+	}
+	if err := c.createTable(ctx, m); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateTablesIfNotExist func is like CreateTableIfNotExists for each of vs, valid structs with
+// qdb tags, e.g. the tables a service owns at startup. QuestDB has no transactional DDL, so the
+// tables are created one statement at a time and a failure to create one does not stop the
+// others from being created. It returns the errors of every table which could not be created,
+// each prefixed with the type of its struct.
+func (c *Client) CreateTablesIfNotExist(vs ...interface{}) error {
+	return c.CreateTablesIfNotExistContext(context.Background(), vs...)
+}
+
+// CreateTablesIfNotExistContext func is like CreateTablesIfNotExist but takes a ctx which bounds
+// the statement executions
+func (c *Client) CreateTablesIfNotExistContext(ctx context.Context, vs ...interface{}) error {
+	errs := []error{}
+	for _, v := range vs {
+		if err := c.CreateTableIfNotExistsContext(ctx, v); err != nil {
+			errs = append(errs, fmt.Errorf("%T: %w", v, err))
+		}
+	}
+	return joinErrors(errs)
+}
+
+const (
+	// createTableAttempts is the number of times CreateTableIfNotExists executes its statement
+	// while the table is locked by a concurrent creation
+	createTableAttempts = 4
+	// createTableMinBackoff is the wait before CreateTableIfNotExists's first retry, doubled for
+	// every later one
+	createTableMinBackoff = 50 * time.Millisecond
+)
+
+// isTableExistsError func reports whether err is QuestDB reporting that a table already exists,
+// which a create racing another creation of the same table can return despite IF NOT EXISTS
+func isTableExistsError(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "already exists")
+}
+
+// isTableLockedError func reports whether err is QuestDB failing to lock a table, a transient
+// error while another statement, such as a concurrent creation, holds the lock
+func isTableLockedError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"could not lock", "table busy", "table is locked"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
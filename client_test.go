@@ -1,29 +1,1360 @@
 package questdb
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// testILPServer is a TCP listener standing in for the QuestDB ILP port which records
+// everything written to it.
+type testILPServer struct {
+	ln  net.Listener
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func newTestILPServer(t testing.TB) *testILPServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	s := &testILPServer{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				b := make([]byte, 4096)
+				for {
+					n, err := conn.Read(b)
+					s.mu.Lock()
+					s.buf.Write(b[:n])
+					s.mu.Unlock()
+					if err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+// client func returns a connected *Client writing to s
+func (s *testILPServer) client(t testing.TB) *Client {
+	client, err := New(Config{ILPHost: s.ln.Addr().String()})
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("could not connect client: %v", err)
+	}
+	return client
+}
+
+// waitFor func waits until at least n bytes have been received (or a second has passed)
+// and returns everything received so far.
+func (s *testILPServer) waitFor(n int) string {
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.mu.Lock()
+		out := s.buf.String()
+		s.mu.Unlock()
+		if len(out) >= n || time.Now().After(deadline) {
+			return out
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// newTestPGServer func starts a stand in for the QuestDB PG wire port which completes the
+// startup of any connection and answers every simple query, e.g. the pings of Connect, with an
+// empty response. It returns the DSN to connect to it with.
+func newTestPGServer(t testing.TB) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	go serveTestPG(ln)
+	t.Cleanup(func() { ln.Close() })
+	return testPGDSN(ln.Addr().String())
+}
+
+// testPGDSN func returns the DSN of a test PG server listening on addr
+func testPGDSN(addr string) string {
+	return fmt.Sprintf("postgresql://admin@%s/qdb?sslmode=disable", addr)
+}
+
+// serveTestPG func serves the PG wire protocol on ln, see newTestPGServer, until ln is closed
+func serveTestPG(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			// readInt32 func reads a big endian int32 from conn
+			readInt32 := func() (int, error) {
+				b := make([]byte, 4)
+				_, err := io.ReadFull(conn, b)
+				return int(binary.BigEndian.Uint32(b)), err
+			}
+			ready := []byte{'Z', 0, 0, 0, 5, 'I'}
+
+			// startup, refusing ssl
+			for {
+				size, err := readInt32()
+				if err != nil {
+					return
+				}
+				code, err := readInt32()
+				if err != nil {
+					return
+				}
+				if _, err := io.CopyN(io.Discard, conn, int64(size-8)); err != nil {
+					return
+				}
+				if code == 80877103 {
+					conn.Write([]byte{'N'})
+					continue
+				}
+				conn.Write(append([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0}, ready...))
+				break
+			}
+
+			for {
+				typ := make([]byte, 1)
+				if _, err := io.ReadFull(conn, typ); err != nil {
+					return
+				}
+				size, err := readInt32()
+				if err != nil {
+					return
+				}
+				if _, err := io.CopyN(io.Discard, conn, int64(size-4)); err != nil {
+					return
+				}
+				if typ[0] != 'Q' {
+					return
+				}
+				conn.Write(append([]byte{'I', 0, 0, 0, 4}, ready...))
+			}
+		}()
+	}
+}
+
 func TestNew(t *testing.T) {
 	t.Run("should return a client and no error if passed valid config", func(t *testing.T) {
 		client, err := New(Config{})
 		assert.Nil(t, err)
-		assert.NotNil(t, client)
+		assert.NotNil(t, client)
+	})
+}
+
+func TestClient_Connect(t *testing.T) {
+	t.Run("should successfully connect given proper config", func(t *testing.T) {
+		client := Default()
+
+		err := client.Connect()
+
+		assert.Nil(t, err)
+	})
+}
+
+func TestClient_Connect_AuthTimeout(t *testing.T) {
+	t.Run("should return a timeout error if the server never sends an auth challenge", func(t *testing.T) {
+		// a listener which accepts connections but never writes a challenge
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		defer ln.Close()
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+			}
+		}()
+
+		client, err := New(Config{
+			ILPHost:           ln.Addr().String(),
+			ILPAuthKid:        "testUser1",
+			ILPAuthPrivateKey: "5UjEMuA0Pj5pjK8a-fa24dyIf-Es5mYny3oE_Wmus48",
+			ILPAuthTimeout:    100 * time.Millisecond,
+		})
+		assert.Nil(t, err)
+
+		start := time.Now()
+		err = client.Connect()
+
+		assert.ErrorIs(t, err, ErrILPAuthTimeout)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+}
+
+func TestConfig_Validate(t *testing.T) {
+	t.Run("should accept the default and empty configs", func(t *testing.T) {
+		assert.Nil(t, Default().config.Validate())
+		assert.Nil(t, Config{}.Validate())
+		assert.Nil(t, Config{PGConnStr: "host=localhost port=8812 user=admin dbname=qdb sslmode=disable"}.Validate())
+	})
+
+	t.Run("should list every problem", func(t *testing.T) {
+		config := Config{
+			ILPHost:           "localhost:90o9",
+			ILPAuthPrivateKey: "5UjEMuA0Pj5pjK8a-fa24dyIf-Es5mYny3oE_Wmus48",
+			TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS13, MaxVersion: tls.VersionTLS12},
+			PGConnStr:         "postgresql://localhost:88l2/qdb",
+			MaxLineBytes:      -1,
+		}
+		err := config.Validate()
+		assert.NotNil(t, err)
+		for _, problem := range []string{
+			"ILPHost 'localhost:90o9' does not have a valid port",
+			"ILPAuthPrivateKey is set without ILPAuthKid",
+			"TLSConfig MinVersion 0x304 is greater than its MaxVersion 0x303",
+			"PGConnStr is not a valid postgres DSN",
+			"MaxLineBytes -1 is negative",
+		} {
+			assert.Contains(t, err.Error(), problem)
+		}
+
+		_, err = New(config)
+		assert.ErrorIs(t, err, ErrInvalidConfig)
+	})
+
+	t.Run("should check the ILP auth fields", func(t *testing.T) {
+		err := Config{ILPHost: "localhost", ILPAuthKid: "testUser1"}.Validate()
+		assert.Contains(t, err.Error(), "ILPHost 'localhost' is not a host:port address")
+		assert.Contains(t, err.Error(), "ILPAuthKid is set without ILPAuthPrivateKey")
+
+		err = Config{ILPAuthKid: "testUser1", ILPAuthPrivateKey: "not+base64url"}.Validate()
+		assert.Contains(t, err.Error(), "ILPAuthPrivateKey is not base64url encoded")
+
+		err = Config{ILPAuthKid: "testUser1", ILPAuthPrivateKey: "5UjEMuA0"}.Validate()
+		assert.EqualError(t, err, "ILPAuthPrivateKey is 6 bytes long, not the 32 bytes of a P-256 private key")
+	})
+}
+
+func TestClient_Connect_Retries(t *testing.T) {
+	// freeAddr func returns an address nothing listens on yet
+	freeAddr := func(t *testing.T) string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		addr := ln.Addr().String()
+		ln.Close()
+		return addr
+	}
+
+	t.Run("should retry until a delayed listener starts", func(t *testing.T) {
+		addr := freeAddr(t)
+		started := make(chan net.Listener)
+		go func() {
+			time.Sleep(150 * time.Millisecond)
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				close(started)
+				return
+			}
+			started <- ln
+		}()
+
+		client, err := New(Config{ILPHost: addr, ConnectRetries: 20, ConnectRetryBackoff: 10 * time.Millisecond})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+		assert.True(t, client.Connected())
+		assert.Nil(t, client.Close())
+
+		if ln, ok := <-started; ok {
+			ln.Close()
+		}
+	})
+
+	t.Run("should retry until a delayed PG server starts", func(t *testing.T) {
+		server := newTestILPServer(t)
+		addr := freeAddr(t)
+		started := make(chan net.Listener)
+		go func() {
+			time.Sleep(150 * time.Millisecond)
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				close(started)
+				return
+			}
+			go serveTestPG(ln)
+			started <- ln
+		}()
+
+		client, err := New(Config{
+			ILPHost:             server.ln.Addr().String(),
+			PGConnStr:           testPGDSN(addr),
+			ConnectRetries:      20,
+			ConnectRetryBackoff: 10 * time.Millisecond,
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+		assert.Nil(t, client.Ping())
+		assert.Nil(t, client.Close())
+
+		if ln, ok := <-started; ok {
+			ln.Close()
+		}
+	})
+
+	t.Run("should fail if the PG server is not up", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client, err := New(Config{ILPHost: server.ln.Addr().String(), PGConnStr: testPGDSN(freeAddr(t))})
+		assert.Nil(t, err)
+		assert.ErrorIs(t, client.Connect(), ErrPGOpen)
+		assert.False(t, client.Connected())
+	})
+
+	t.Run("should fail on the first error without retries", func(t *testing.T) {
+		client, err := New(Config{ILPHost: freeAddr(t)})
+		assert.Nil(t, err)
+		assert.ErrorIs(t, client.Connect(), ErrILPNetDial)
+	})
+
+	t.Run("should stop retrying once the context is done", func(t *testing.T) {
+		client, err := New(Config{ILPHost: freeAddr(t), ConnectRetries: 1000, ConnectRetryBackoff: 10 * time.Millisecond})
+		assert.Nil(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err = client.ConnectContext(ctx)
+		assert.ErrorIs(t, err, ErrILPNetDial)
+		assert.Less(t, time.Since(start), 5*time.Second)
+		assert.False(t, client.Connected())
+	})
+}
+
+func TestClient_WriteLine(t *testing.T) {
+	t.Run("should write a single line", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		l := NewLine("trades")
+		l.AddSymbol("pair", "BTC-USD")
+		assert.Nil(t, l.AddColumn("price", Double, 42.5))
+
+		err := client.WriteLine(l)
+		assert.Nil(t, err)
+
+		expected := l.String()
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+
+	t.Run("should write many lines in one write", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		a := NewLine("trades")
+		a.AddSymbol("pair", "BTC-USD")
+		b := NewLine("trades")
+		b.AddSymbol("pair", "ETH-USD")
+
+		err := client.WriteLines([]*Line{a, b})
+		assert.Nil(t, err)
+
+		expected := "trades,pair=BTC-USD\ntrades,pair=ETH-USD\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+}
+
+type testRow struct {
+	Name  string `qdb:"name;symbol"`
+	Value int64  `qdb:"value;long"`
+}
+
+func TestClient_WriteFrom(t *testing.T) {
+	t.Run("should write every row and flush the remainder when the channel closes", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		ch := make(chan interface{})
+		go func() {
+			for i := 1; i <= 5; i++ {
+				ch <- testRow{Name: "a", Value: int64(i)}
+			}
+			close(ch)
+		}()
+
+		err := client.WriteFrom(context.Background(), ch, WithBatchSize(2), WithFlushInterval(time.Hour))
+		assert.Nil(t, err)
+
+		expected := "test_rows,name=a value=1i\ntest_rows,name=a value=2i\ntest_rows,name=a value=3i\n" +
+			"test_rows,name=a value=4i\ntest_rows,name=a value=5i\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+
+	t.Run("should flush buffered rows once the flush interval elapses", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		ch := make(chan interface{}, 1)
+		ch <- testRow{Name: "a", Value: 1}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- client.WriteFrom(ctx, ch, WithFlushInterval(10*time.Millisecond))
+		}()
+
+		expected := "test_rows,name=a value=1i\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+
+	t.Run("should return the first error encountered", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		ch := make(chan interface{}, 1)
+		ch <- "not a struct"
+
+		err := client.WriteFrom(context.Background(), ch)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestClient_Write_LegacyIntFormat(t *testing.T) {
+	t.Run("should omit integer suffixes when LegacyIntFormat is set", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client, err := New(Config{ILPHost: server.ln.Addr().String(), LegacyIntFormat: true})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+
+		err = client.Write(testRow{Name: "a", Value: 1})
+		assert.Nil(t, err)
+
+		expected := "test_rows,name=a value=1\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+
+	t.Run("should keep integer suffixes by default", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		err := client.Write(testRow{Name: "a", Value: 1})
+		assert.Nil(t, err)
+
+		expected := "test_rows,name=a value=1i\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+}
+
+func TestClient_Write_ILPDialect(t *testing.T) {
+	dialect := ILPDialect{SymbolSeparator: ";", FieldSeparator: "\t", ColumnSeparator: "&", IntSuffix: "L", TimestampSuffix: "us"}
+
+	t.Run("should write lines in the configured dialect", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client, err := New(Config{ILPHost: server.ln.Addr().String(), ILPDialect: &dialect})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+
+		err = client.Write(testEvent{Name: "a", Received: time.Unix(2, 0), TS: time.Unix(1, 0)})
+		assert.Nil(t, err)
+		err = client.Write(testService{Latency: 5})
+		assert.Nil(t, err)
+
+		expected := "test_events;name=a\treceived=2000000us\t1000000000\n" +
+			"test_services;env=prod;service=api\\ gateway\tlatency=5L\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+
+	t.Run("should measure lines in the configured dialect", func(t *testing.T) {
+		client, err := New(Config{ILPDialect: &dialect})
+		assert.Nil(t, err)
+		m, err := client.NewModel(&testTrade{Pair: "BTC-USD", Price: 1, TS: time.Unix(1, 0)})
+		assert.Nil(t, err)
+
+		size, err := m.LineSize()
+		assert.Nil(t, err)
+		assert.Equal(t, len(m.MarshalLine()), size)
+	})
+
+	t.Run("should write the legacy dialect like LegacyIntFormat", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client, err := New(Config{ILPHost: server.ln.Addr().String(), ILPDialect: &LegacyILPDialect})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+
+		err = client.Write(testRow{Name: "a", Value: 1})
+		assert.Nil(t, err)
+
+		expected := "test_rows,name=a value=1\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+
+	t.Run("should write Lines in the configured dialect unless they have their own", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client, err := New(Config{ILPHost: server.ln.Addr().String(), ILPDialect: &dialect})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+
+		newLine := func(name string) *Line {
+			l := NewLine("trades")
+			l.AddSymbol("pair", name)
+			assert.Nil(t, l.AddColumn("amount", Long, int64(3)))
+			assert.Nil(t, l.AddColumn("at", Timestamp, time.Unix(2, 0)))
+			return l
+		}
+		own := newLine("c")
+		own.SetDialect(StandardILPDialect)
+
+		assert.Nil(t, client.WriteLine(newLine("a")))
+		assert.Nil(t, client.WriteLines([]*Line{newLine("b"), own}))
+		b := client.NewLineBuffer()
+		assert.Nil(t, b.AppendLine(newLine("d")))
+		assert.Nil(t, client.WriteLineBuffer(b))
+
+		expected := "trades;pair=a\tamount=3L&at=2000000us\n" +
+			"trades;pair=b\tamount=3L&at=2000000us\ntrades,pair=c amount=3i,at=2000000t\n" +
+			"trades;pair=d\tamount=3L&at=2000000us\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+
+	t.Run("should write Lines without type suffixes with LegacyIntFormat", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client, err := New(Config{ILPHost: server.ln.Addr().String(), LegacyIntFormat: true})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+
+		l := NewLine("trades")
+		assert.Nil(t, l.AddColumn("amount", Long, int64(3)))
+		assert.Nil(t, client.WriteLine(l))
+
+		expected := "trades amount=3\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+}
+
+type testEvent struct {
+	Name     string    `qdb:"name;symbol"`
+	Received time.Time `qdb:"received;timestamp"`
+	TS       time.Time `qdb:"ts;timestamp;designatedTS:true"`
+}
+
+func (testEvent) TableName() string {
+	return "test_events"
+}
+
+func TestClient_Write_TimestampResolution(t *testing.T) {
+	ev := testEvent{Name: "a", Received: time.Unix(1, 1001), TS: time.Unix(2, 1)}
+
+	t.Run("should write timestamp columns in microseconds by default", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		assert.Nil(t, client.Write(ev))
+
+		expected := "test_events,name=a received=1000001t 2000000001\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+
+	t.Run("should write timestamp columns in nanoseconds with NanosecondResolution", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client, err := New(Config{ILPHost: server.ln.Addr().String(), TimestampResolution: NanosecondResolution})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+
+		assert.Nil(t, client.Write(ev))
+
+		expected := "test_events,name=a received=1000001001n 2000000001\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+}
+
+func TestClient_Stats(t *testing.T) {
+	t.Run("should count lines and bytes written", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		before := time.Now()
+		assert.Nil(t, client.Write(testRow{Name: "a", Value: 1}))
+		assert.Nil(t, client.WriteBatch([]interface{}{testRow{Name: "b", Value: 2}, testRow{Name: "c", Value: 3}}))
+		assert.Nil(t, client.WriteMessage([]byte("test_rows,name=d value=4i\n")))
+
+		// every line written is 26 bytes long
+		written := server.waitFor(4 * 26)
+
+		stats := client.Stats()
+		assert.Equal(t, int64(4), stats.LinesWritten)
+		assert.Equal(t, int64(len(written)), stats.BytesWritten)
+		assert.Equal(t, int64(0), stats.Reconnects)
+		assert.Nil(t, stats.LastWriteError)
+		assert.False(t, stats.LastWriteTime.Before(before))
+	})
+
+	t.Run("should record the last write error", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+		client.ilpConn.Close()
+
+		err := client.WriteMessage([]byte("test_rows,name=a value=1i\n"))
+		assert.NotNil(t, err)
+
+		stats := client.Stats()
+		assert.Equal(t, err, stats.LastWriteError)
+		assert.Equal(t, int64(0), stats.LinesWritten)
+	})
+
+	t.Run("should count reconnects", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		assert.Nil(t, client.Connect())
+
+		assert.Equal(t, int64(1), client.Stats().Reconnects)
+	})
+}
+
+func TestClient_ILPConnClosed(t *testing.T) {
+	// closingServer accepts ILP connections and closes them right away, as QuestDB does idle ones
+	closingServer := func(t *testing.T) net.Listener {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				conn.Close()
+			}
+		}()
+		t.Cleanup(func() { ln.Close() })
+		return ln
+	}
+
+	t.Run("should fail writes once the server closed the connection", func(t *testing.T) {
+		client, err := New(Config{ILPHost: closingServer(t).Addr().String()})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+
+		assert.Eventually(t, func() bool { return !client.Connected() }, time.Second, time.Millisecond)
+		assert.True(t, client.Stats().ILPConnClosed)
+
+		err = client.Write(testRow{Name: "a", Value: 1})
+		assert.True(t, errors.Is(err, ErrILPConnClosed))
+		assert.Equal(t, err, client.Stats().LastWriteError)
+	})
+
+	t.Run("should write again once reconnected", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+		// the server side of the connection closing
+		client.ilpConn.(*net.TCPConn).CloseRead()
+		assert.Eventually(t, func() bool { return client.Stats().ILPConnClosed }, time.Second, time.Millisecond)
+
+		assert.Nil(t, client.Connect())
+		assert.True(t, client.Connected())
+		assert.False(t, client.Stats().ILPConnClosed)
+		assert.Nil(t, client.Write(testRow{Name: "a", Value: 1}))
+		assert.Equal(t, int64(1), client.Stats().Reconnects)
+	})
+
+	t.Run("should stay connected while the server keeps the connection open", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		time.Sleep(10 * time.Millisecond)
+		assert.True(t, client.Connected())
+		assert.False(t, client.Stats().ILPConnClosed)
+	})
+}
+
+func TestClient_Clock(t *testing.T) {
+	now := time.Date(2024, time.January, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("should stamp times from the configured clock", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+		client.config.Clock = func() time.Time { return now }
+
+		assert.Nil(t, client.Write(testTrade{Pair: "BTC-USD", Price: 1}, WithStampNowIfZero()))
+		assert.Nil(t, client.Write(testEvent{Name: "a"}, WithShardedTable("events", "received")))
+
+		expected := "test_trades,pair=BTC-USD price=1 1704164645000000000\nevents_2024_01,name=a\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+		assert.Equal(t, now, client.Stats().LastWriteTime)
+	})
+
+	t.Run("should stamp zero designated timestamps of copied rows from the configured clock", func(t *testing.T) {
+		client, err := New(Config{Clock: func() time.Time { return now }})
+		assert.Nil(t, err)
+		var args []driver.Value
+		db, _ := newTestExecDB(t, func(query string, a []driver.Value) error {
+			args = a
+			return nil
+		})
+		client.pgSqlDB = db
+
+		_, err = client.CopyInsert(context.Background(), []interface{}{testTrade{Pair: "BTC-USD", Price: 1}},
+			WithCopyMode(CopyBatchedInsert))
+		assert.Nil(t, err)
+		assert.Equal(t, []driver.Value{"BTC-USD", 1.0, now}, args)
+	})
+}
+
+func TestClient_TableNameAffixes(t *testing.T) {
+	newClient := func(t *testing.T, server *testILPServer) *Client {
+		client, err := New(Config{ILPHost: server.ln.Addr().String(), TableNamePrefix: "staging_", TableNameSuffix: "_v2"})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+		return client
+	}
+
+	t.Run("should affix default, TableNamer and WithTableName names in writes", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := newClient(t, server)
+
+		assert.Nil(t, client.Write(testRow{Name: "a", Value: 1}))
+		assert.Nil(t, client.Write(testEvent{Name: "b"}))
+		assert.Nil(t, client.Write(testRow{Name: "c", Value: 2}, WithTableName("users")))
+		assert.Nil(t, client.Write(testEvent{Name: "d", Received: time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)},
+			WithShardedTable("events", "received")))
+
+		expected := "staging_test_rows_v2,name=a value=1i\nstaging_test_events_v2,name=b\nstaging_users_v2,name=c value=2i\n" +
+			"staging_events_v2_2024_01,name=d received=1704153600000000t\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+
+	t.Run("should affix the table of create table statements and selects", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := newClient(t, server)
+		db, result := newTestExecDB(t, nil)
+		client.pgSqlDB = db
+
+		assert.Nil(t, client.CreateTableIfNotExists(testRow{}, WithTableName("users")))
+		assert.Equal(t, []string{`CREATE TABLE IF NOT EXISTS "staging_users_v2" ( "name" symbol, "value" long, "timestamp" timestamp ) timestamp(timestamp) ;`}, result.executed())
+
+		m, err := client.NewModel(&testQuote{}, WithTableName("quotes"))
+		assert.Nil(t, err)
+		stmt, err := m.SampleByStatement("1h", map[string]string{"bid_price": "avg"})
+		assert.Nil(t, err)
+		assert.Equal(t, `SELECT avg(bid_price) bid_price, ts FROM "staging_quotes_v2" SAMPLE BY 1h`, stmt)
+	})
+}
+
+func TestClient_TableNameTransformer(t *testing.T) {
+	newClient := func(t *testing.T, server *testILPServer) *Client {
+		client, err := New(Config{
+			ILPHost:              server.ln.Addr().String(),
+			TableNamePrefix:      "staging_",
+			TableNameTransformer: strings.ToUpper,
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+		return client
+	}
+
+	t.Run("should transform the resolved table name of writes last", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := newClient(t, server)
+
+		assert.Nil(t, client.Write(testRow{Name: "a", Value: 1}))
+		assert.Nil(t, client.Write(testRow{Name: "b", Value: 2}, WithTableName("users")))
+		assert.Nil(t, client.Write(testEvent{Name: "c", Received: time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)},
+			WithShardedTable("events", "received")))
+
+		expected := "STAGING_TEST_ROWS,name=a value=1i\nSTAGING_USERS,name=b value=2i\n" +
+			"STAGING_EVENTS_2024_01,name=c received=1704153600000000t\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+
+	t.Run("should transform the table of create table statements and selects", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := newClient(t, server)
+		db, result := newTestExecDB(t, nil)
+		client.pgSqlDB = db
+
+		assert.Nil(t, client.CreateTableIfNotExists(testRow{}))
+		assert.Equal(t, []string{`CREATE TABLE IF NOT EXISTS "STAGING_TEST_ROWS" ( "name" symbol, "value" long, "timestamp" timestamp ) timestamp(timestamp) ;`}, result.executed())
+
+		m, err := client.NewModel(&testQuote{})
+		assert.Nil(t, err)
+		stmt, err := m.SampleByStatement("1h", map[string]string{"bid_price": "avg"})
+		assert.Nil(t, err)
+		assert.Equal(t, `SELECT avg(bid_price) bid_price, ts FROM "STAGING_TEST_QUOTES" SAMPLE BY 1h`, stmt)
+	})
+}
+
+func TestClient_PGPool(t *testing.T) {
+	t.Run("should apply the PG pool config", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client, err := New(Config{
+			ILPHost:           server.ln.Addr().String(),
+			PGConnStr:         newTestPGServer(t),
+			PGMaxOpenConns:    5,
+			PGConnMaxLifetime: time.Minute,
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+		defer client.Close()
+
+		assert.Equal(t, 5, client.DB().Stats().MaxOpenConnections)
+	})
+
+	t.Run("should keep the database/sql defaults by default", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client, err := New(Config{ILPHost: server.ln.Addr().String(), PGConnStr: newTestPGServer(t)})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+		defer client.Close()
+
+		assert.Equal(t, 0, client.DB().Stats().MaxOpenConnections)
+	})
+}
+
+func TestClient_ConnectTwice(t *testing.T) {
+	t.Run("should close the previous connections when connecting again", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client, err := New(Config{ILPHost: server.ln.Addr().String(), PGConnStr: newTestPGServer(t)})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+		oldILPConn, oldPGSqlDB := client.ilpConn, client.pgSqlDB
+
+		assert.Nil(t, client.Connect())
+		assert.True(t, client.Connected())
+
+		_, err = oldILPConn.Write([]byte("test_rows,name=a value=1i\n"))
+		assert.NotNil(t, err)
+		assert.NotNil(t, oldPGSqlDB.Ping())
+
+		assert.Nil(t, client.WriteMessage([]byte("test_rows,name=b value=2i\n")))
+		assert.Equal(t, "test_rows,name=b value=2i\n", server.waitFor(26))
+	})
+
+	t.Run("should not be connected after close", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		assert.Nil(t, client.Close())
+		assert.False(t, client.Connected())
+		assert.Nil(t, client.Close())
+	})
+
+	t.Run("should not be connected before connect", func(t *testing.T) {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+		assert.False(t, client.Connected())
+	})
+}
+
+func TestClient_WriteBatchGrouped(t *testing.T) {
+	t.Run("should write lines grouped by table preserving per table order", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		rows := []interface{}{
+			testRow{Name: "a", Value: 1},
+			testTrade{Pair: "BTC-USD", Price: 1},
+			testRow{Name: "b", Value: 2},
+			testTrade{Pair: "ETH-USD", Price: 2},
+			testRow{Name: "c", Value: 3},
+		}
+		err := client.WriteBatchGrouped(rows)
+		assert.Nil(t, err)
+
+		expected := "test_rows,name=a value=1i\ntest_rows,name=b value=2i\ntest_rows,name=c value=3i\n" +
+			"test_trades,pair=BTC-USD price=1\ntest_trades,pair=ETH-USD price=2\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+}
+
+func TestClient_WriteBatchFunc(t *testing.T) {
+	t.Run("should write the generated rows in chunks", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		stats, err := client.WriteBatchFunc(5, func(i int) interface{} {
+			return testRow{Name: "a", Value: int64(i + 1)}
+		}, WithBatchSize(2))
+		assert.Nil(t, err)
+
+		expected := "test_rows,name=a value=1i\ntest_rows,name=a value=2i\ntest_rows,name=a value=3i\n" +
+			"test_rows,name=a value=4i\ntest_rows,name=a value=5i\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+		assert.Equal(t, BatchStats{Rows: 5, Bytes: len(expected), Flushes: 3}, stats)
+	})
+
+	t.Run("should stop at the first invalid row keeping the flushed chunks", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		stats, err := client.WriteBatchFunc(5, func(i int) interface{} {
+			if i == 3 {
+				return testRow{}
+			}
+			return testRow{Name: "a", Value: int64(i + 1)}
+		}, WithBatchSize(2))
+		assert.True(t, errors.Is(err, ErrNoFieldsToWrite))
+		assert.Contains(t, err.Error(), "row 3")
+
+		expected := "test_rows,name=a value=1i\ntest_rows,name=a value=2i\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+		assert.Equal(t, BatchStats{Rows: 2, Bytes: len(expected), Flushes: 1}, stats)
+	})
+}
+
+func TestClient_Pause(t *testing.T) {
+	t.Run("should drain the batch writers and reject writes until resumed", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		w := client.NewBatchWriter(context.Background(), WithBatchSize(100), WithFlushInterval(time.Hour))
+		assert.Nil(t, w.Add(testRow{Name: "a", Value: 1}))
+		assert.Nil(t, w.Add(testRow{Name: "b", Value: 2}))
+
+		assert.Nil(t, client.Pause())
+		assert.True(t, client.Paused())
+		expected := "test_rows,name=a value=1i\ntest_rows,name=b value=2i\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+
+		assert.ErrorIs(t, client.Write(testRow{Name: "c", Value: 3}), ErrPaused)
+		assert.ErrorIs(t, client.WriteMessage([]byte("test_rows,name=c value=3i\n")), ErrPaused)
+		assert.ErrorIs(t, w.Add(testRow{Name: "c", Value: 3}), ErrPaused)
+		assert.True(t, client.Connected())
+		assert.Nil(t, client.Pause())
+
+		client.Resume()
+		assert.False(t, client.Paused())
+		assert.Nil(t, client.Write(testRow{Name: "d", Value: 4}))
+		assert.Nil(t, w.Add(testRow{Name: "e", Value: 5}))
+		assert.Nil(t, w.Close())
+
+		expected += "test_rows,name=d value=4i\ntest_rows,name=e value=5i\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+
+	t.Run("should stop waiting for the batch writers once the context is done", func(t *testing.T) {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+		// nothing reads the other end of the pipe, so writes block
+		conn, peer := net.Pipe()
+		defer peer.Close()
+		client.ilpConn = conn
+
+		w := client.NewBatchWriter(context.Background(), WithBatchSize(100), WithFlushInterval(time.Hour))
+		assert.Nil(t, w.Add(testRow{Name: "a", Value: 1}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, client.PauseContext(ctx), context.DeadlineExceeded)
+		assert.True(t, client.Paused())
+	})
+
+	t.Run("should stay running if resumed while draining the batch writers", func(t *testing.T) {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+		// nothing reads the other end of the pipe until the Client is resumed, so Pause blocks
+		conn, peer := net.Pipe()
+		defer peer.Close()
+		client.ilpConn = conn
+
+		w := client.NewBatchWriter(context.Background(), WithBatchSize(100), WithFlushInterval(time.Hour))
+		defer w.Close()
+		assert.Nil(t, w.Add(testRow{Name: "a", Value: 1}))
+
+		paused := make(chan error)
+		go func() { paused <- client.Pause() }()
+		for !client.Paused() {
+			time.Sleep(time.Millisecond)
+		}
+		assert.ErrorIs(t, w.Add(testRow{Name: "b", Value: 2}), ErrPaused)
+
+		client.Resume()
+		go io.Copy(io.Discard, peer)
+		assert.Nil(t, <-paused)
+		assert.False(t, client.Paused())
+		assert.Nil(t, client.Write(testRow{Name: "c", Value: 3}))
+	})
+}
+
+func TestClient_Commit(t *testing.T) {
+	t.Run("should write the queued rows and count the committed ones", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+		var mu sync.Mutex
+		queries := []string{}
+		client.pgSqlDB = openTestDB(t, &testResult{
+			columns: []string{"count"},
+			rows:    [][]driver.Value{{int64(2)}},
+			queryErr: func(query string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				queries = append(queries, query)
+				return nil
+			},
+		})
+
+		w := client.NewBatchWriter(context.Background(), WithBatchSize(100), WithFlushInterval(time.Hour))
+		defer w.Close()
+		assert.Nil(t, w.Add(testRow{Name: "a", Value: 1}))
+
+		count, err := client.Commit(context.Background(), `"test_rows"`)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), count)
+		expected := "test_rows,name=a value=1i\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, []string{`SELECT count() FROM "test_rows"`}, queries)
+	})
+
+	t.Run("should return an error if the table cannot be read", func(t *testing.T) {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+		client.pgSqlDB = openTestDB(t, &testResult{queryErr: func(query string) error {
+			return errors.New("table does not exist [table=test_rows]")
+		}})
+
+		_, err = client.Commit(context.Background(), "test_rows")
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "could not count committed rows of test_rows")
+	})
+}
+
+// benchmarkRows func returns n rows alternating between two tables
+func benchmarkRows(n int) []interface{} {
+	rows := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		if i%2 == 0 {
+			rows = append(rows, testRow{Name: "a", Value: int64(i)})
+		} else {
+			rows = append(rows, testTrade{Pair: "BTC-USD", Price: float64(i)})
+		}
+	}
+	return rows
+}
+
+// The WriteBatch benchmarks write to a local listener, so they only measure the client side
+// cost of grouping. The ingestion gain of contiguous table lines has to be measured against
+// a running QuestDB instance.
+func BenchmarkClient_WriteBatch(b *testing.B) {
+	client := newTestILPServer(b).client(b)
+	rows := benchmarkRows(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := client.WriteBatch(rows); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestClient_Write_NoFields(t *testing.T) {
+	t.Run("should not write a row without fields", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		err := client.Write(testRow{})
+		assert.True(t, errors.Is(err, ErrNoFieldsToWrite))
+		assert.Nil(t, client.Write(testRow{Name: "a"}))
+
+		expected := "test_rows,name=a\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+}
+
+func TestClient_Write_Explode(t *testing.T) {
+	t.Run("should write a line per element", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		assert.Nil(t, client.Write(testReading{Device: "d1", Sensors: []string{"a", "b"}, TS: time.Unix(1, 0)}))
+
+		expected := "test_readings,device=d1,sensor=a 1000000000\ntest_readings,device=d1,sensor=b 1000000000\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+		assert.Equal(t, int64(2), client.Stats().LinesWritten)
+	})
+
+	t.Run("should check the length of each line", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+		client.config.MaxLineBytes = len("test_readings,device=d1,sensor=a 1000000000\n")
+
+		assert.Nil(t, client.Write(testReading{Device: "d1", Sensors: []string{"a", "b"}, TS: time.Unix(1, 0)}))
+		err := client.Write(testReading{Device: "d1", Sensors: []string{"a", "bb"}, TS: time.Unix(1, 0)})
+		assert.True(t, errors.Is(err, ErrILPLineTooLong))
+	})
+}
+
+func TestClient_Upsert(t *testing.T) {
+	type position struct {
+		Account  string    `qdb:"account;symbol"`
+		Symbol   string    `qdb:"symbol;symbol"`
+		Quantity int64     `qdb:"quantity;long"`
+		Price    float64   `qdb:"price;double"`
+		Note     *string   `qdb:"note;string"`
+		TS       time.Time `qdb:"ts;timestamp;designatedTS:true"`
+	}
+
+	t.Run("should rewrite a scanned and corrected row with its timestamp and keys", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+		db := newTestDB(t, []string{"account", "symbol", "quantity", "price", "note", "ts"},
+			[]driver.Value{"a1", "BTC", int64(3), 0.0, nil, time.Unix(1, 0).UTC()})
+
+		p := &position{}
+		assert.Nil(t, ScanInto(db.QueryRow("SELECT * FROM positions WHERE account = 'a1'"), p))
+		p.Quantity = 0
+		p.Price = 1.5
+		assert.Nil(t, client.Upsert(p))
+
+		expected := "positions,account=a1,symbol=BTC quantity=0i,price=1.5 1000000000\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+
+	t.Run("should return an error without a designated timestamp value", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		assert.NotNil(t, client.Upsert(position{Account: "a1"}))
+		assert.NotNil(t, client.Upsert(testRow{Name: "a"}))
+	})
+}
+
+func TestClient_WriteBatchGrouped_Sharded(t *testing.T) {
+	t.Run("should write lines grouped by shard", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		jan := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)
+		feb := time.Date(2024, time.February, 2, 0, 0, 0, 0, time.UTC)
+		rows := []interface{}{
+			testEvent{Name: "a", Received: jan},
+			testEvent{Name: "b", Received: feb},
+			testEvent{Name: "c", Received: jan},
+		}
+		err := client.WriteBatchGrouped(rows, WithShardedTable("events", "received"))
+		assert.Nil(t, err)
+
+		expected := "events_2024_01,name=a received=1704153600000000t\nevents_2024_01,name=c received=1704153600000000t\n" +
+			"events_2024_02,name=b received=1706832000000000t\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+}
+
+func TestClient_WriteBatch_Sharded(t *testing.T) {
+	jan := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2024, time.February, 2, 0, 0, 0, 0, time.UTC)
+	rows := []interface{}{
+		testEvent{Name: "a", Received: jan},
+		testEvent{Name: "b", Received: feb},
+		testEvent{Name: "c", Received: jan},
+	}
+
+	t.Run("should write each line of a batch to the shard of its row", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		assert.Nil(t, client.WriteBatch(rows, WithShardedTable("events", "received")))
+
+		expected := "events_2024_01,name=a received=1704153600000000t\nevents_2024_02,name=b received=1706832000000000t\n" +
+			"events_2024_01,name=c received=1704153600000000t\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+
+	t.Run("should append each row of a line buffer to the shard of its row", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		b := client.NewLineBuffer(WithShardedTable("events", "received"))
+		for _, row := range rows {
+			assert.Nil(t, b.AppendStruct(row))
+		}
+		assert.Nil(t, client.WriteLineBuffer(b))
+
+		expected := "events_2024_01,name=a received=1704153600000000t\nevents_2024_02,name=b received=1706832000000000t\n" +
+			"events_2024_01,name=c received=1704153600000000t\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+}
+
+func BenchmarkClient_WriteBatchGrouped(b *testing.B) {
+	client := newTestILPServer(b).client(b)
+	rows := benchmarkRows(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := client.WriteBatchGrouped(rows); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestClient_WriteContext(t *testing.T) {
+	t.Run("should not write anything if ctx is already cancelled", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := client.WriteContext(ctx, testRow{Name: "a", Value: 1})
+		assert.ErrorIs(t, err, context.Canceled)
+
+		err = client.WriteBatchContext(ctx, []interface{}{testRow{Name: "a", Value: 1}})
+		assert.ErrorIs(t, err, context.Canceled)
+
+		err = client.WriteMessageContext(ctx, []byte("test_rows,name=a value=1i\n"))
+		assert.ErrorIs(t, err, context.Canceled)
+
+		assert.Equal(t, int64(0), client.Stats().LinesWritten)
+	})
+
+	t.Run("should write within the ctx deadline", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		err := client.WriteContext(ctx, testRow{Name: "a", Value: 1})
+		assert.Nil(t, err)
+
+		expected := "test_rows,name=a value=1i\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+
+	t.Run("should close the connection after a partial write", func(t *testing.T) {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+		conn, peer := net.Pipe()
+		client.ilpConn = conn
+
+		// the peer reads the start of the line and then stops, so the write times out part way
+		read := make(chan []byte)
+		go func() {
+			b := make([]byte, 5)
+			n, _ := peer.Read(b)
+			read <- b[:n]
+			rest, _ := io.ReadAll(peer)
+			read <- rest
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err = client.WriteContext(ctx, testRow{Name: "a", Value: 1})
+		assert.ErrorIs(t, err, ErrILPConnBroken)
+		assert.Equal(t, "test_", string(<-read))
+		// the connection was closed rather than left holding the partial line
+		assert.Empty(t, <-read)
+		assert.NotNil(t, client.Write(testRow{Name: "b", Value: 2}))
+	})
+
+	t.Run("should keep each write's deadline to itself", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				assert.Nil(t, client.WriteContext(ctx, testRow{Name: "a", Value: int64(i + 1)}))
+			}(i)
+		}
+		wg.Wait()
+		assert.Equal(t, int64(20), client.Stats().LinesWritten)
 	})
 }
 
-func TestClient_Connect(t *testing.T) {
-	t.Run("should successfully connect given proper config", func(t *testing.T) {
-		client := Default()
+func TestClient_PingContext(t *testing.T) {
+	t.Run("should ping the pg wire connection", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+		client.pgSqlDB = newTestDB(t, nil)
 
-		err := client.Connect()
+		assert.Nil(t, client.PingContext(context.Background()))
+	})
+}
+
+func TestClient_MaxLineBytes(t *testing.T) {
+	t.Run("should return an error naming the table if a line is too long", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client, err := New(Config{ILPHost: server.ln.Addr().String(), MaxLineBytes: 20})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+
+		err = client.Write(testRow{Name: "a", Value: 1})
+		assert.ErrorIs(t, err, ErrILPLineTooLong)
+		assert.Contains(t, err.Error(), "table 'test_rows' exceeds 20 bytes")
+
+		err = client.WriteBatch([]interface{}{testRow{Name: "a", Value: 1}})
+		assert.ErrorIs(t, err, ErrILPLineTooLong)
 
+		l := NewLine("test_rows")
+		l.AddSymbol("name", "a very long symbol value")
+		err = client.WriteLine(l)
+		assert.ErrorIs(t, err, ErrILPLineTooLong)
+
+		assert.Equal(t, int64(0), client.Stats().LinesWritten)
+	})
+
+	t.Run("should write lines within the limit", func(t *testing.T) {
+		server := newTestILPServer(t)
+		expected := "test_rows,name=a value=1i\n"
+		client, err := New(Config{ILPHost: server.ln.Addr().String(), MaxLineBytes: len(expected)})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+
+		err = client.Write(testRow{Name: "a", Value: 1})
+		assert.Nil(t, err)
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+}
+
+func TestClient_ValidateBatch(t *testing.T) {
+	t.Run("should return an error for every invalid row without writing", func(t *testing.T) {
+		client, err := New(Config{MaxLineBytes: 30})
+		assert.Nil(t, err)
+
+		rows := []interface{}{
+			testRow{Name: "a", Value: 1},
+			"not a struct",
+			testRow{Name: "a much longer symbol value", Value: 2},
+			testRow{Name: "b", Value: 3},
+		}
+
+		errs := client.ValidateBatch(rows)
+		assert.Len(t, errs, 2)
+		assert.Contains(t, errs[0].Error(), "row 1: ")
+		assert.Contains(t, errs[1].Error(), "row 2: ")
+		assert.ErrorIs(t, errs[1], ErrILPLineTooLong)
+	})
+
+	t.Run("should return nil if every row is valid", func(t *testing.T) {
+		client, err := New(Config{})
 		assert.Nil(t, err)
+
+		errs := client.ValidateBatch([]interface{}{testRow{Name: "a", Value: 1}})
+		assert.Nil(t, errs)
 	})
 }
 
@@ -41,15 +1372,63 @@ func TestClient_Close(t *testing.T) {
 	})
 }
 
+func TestClient_WriteNotConnected(t *testing.T) {
+	t.Run("should return ErrNotConnected after Close", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+		assert.Nil(t, client.Write(testRow{Name: "a", Value: 1}))
+		assert.Nil(t, client.Close())
+
+		assert.ErrorIs(t, client.Write(testRow{Name: "b", Value: 2}), ErrNotConnected)
+		assert.ErrorIs(t, client.WriteMessage([]byte("test_rows,name=b value=2i\n")), ErrNotConnected)
+		_, err := client.ILPWriter().Write([]byte("test_rows,name=b value=2i\n"))
+		assert.ErrorIs(t, err, ErrNotConnected)
+	})
+
+	t.Run("should return ErrNotConnected if never connected", func(t *testing.T) {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+		assert.ErrorIs(t, client.Write(testRow{Name: "a", Value: 1}), ErrNotConnected)
+		assert.ErrorIs(t, client.Stats().LastWriteError, ErrNotConnected)
+	})
+
+	t.Run("should not race a Close made while writing in the background", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		w := client.NewBatchWriter(context.Background(), WithBatchSize(1))
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 1000; i++ {
+				if w.Add(testRow{Name: "a", Value: int64(i)}) != nil {
+					return
+				}
+			}
+		}()
+		time.Sleep(time.Millisecond)
+		assert.Nil(t, client.Close())
+		<-done
+		w.Close()
+
+		assert.ErrorIs(t, client.Write(testRow{Name: "b", Value: 2}), ErrNotConnected)
+	})
+}
+
 func TestClientWriteDataThenRead(t *testing.T) {
 	client := Default()
 
+	// without a QuestDB to connect to there is nothing to read, so stop rather than query a nil DB
 	err := client.Connect()
-	assert.Nil(t, err)
+	if !assert.Nil(t, err) {
+		return
+	}
 
 	now := time.Now()
 	err = client.WriteMessage([]byte(fmt.Sprintf("table_abc,symbol_a=abcd1234 col_a=42323532i,col_b=f,ts=%dt %d\n", now.UnixMicro(), now.UnixNano())))
-	assert.Nil(t, err)
+	if !assert.Nil(t, err) {
+		return
+	}
 
 	row := client.DB().QueryRowContext(context.Background(), "SELECT col_a FROM table_abc WHERE symbol_a = 'abcd1234'")
 
@@ -64,3 +1443,600 @@ func TestClientWriteDataThenRead(t *testing.T) {
 	assert.Equal(t, 42323532, someInt)
 
 }
+
+func TestClient_WriteLineMarshaler(t *testing.T) {
+	t.Run("should write line marshalers as is alongside structs", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		record := MapRecord{Table: "events", Symbols: map[string]string{"kind": "click"}, Columns: map[string]interface{}{"count": 1}}
+		assert.Nil(t, client.Write(record))
+		assert.Nil(t, client.WriteBatchGrouped([]interface{}{testRow{Name: "a", Value: 1}, record, testRow{Name: "b", Value: 2}}))
+
+		expected := "events,kind=click count=1i\n" +
+			"test_rows,name=a value=1i\ntest_rows,name=b value=2i\n" +
+			"events,kind=click count=1i\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+
+	t.Run("should return the marshaler's error", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		errs := client.ValidateBatch([]interface{}{MapRecord{Table: "events"}, MapRecord{}})
+		assert.Len(t, errs, 1)
+	})
+}
+
+func TestClient_WriteConfirmed(t *testing.T) {
+	trade := testTrade{Pair: "BTC-USD", Price: 1, TS: time.Unix(1, 0)}
+
+	t.Run("should return once the row is queryable", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+		client.pgSqlDB = newTestDB(t, []string{"count"}, []driver.Value{int64(1)})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		assert.Nil(t, client.WriteConfirmed(ctx, trade))
+		assert.Equal(t, "test_trades,pair=BTC-USD price=1 1000000000\n", server.waitFor(51))
+	})
+
+	t.Run("should return an error if the row never appears", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+		client.pgSqlDB = newTestDB(t, []string{"count"}, []driver.Value{int64(0)})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		err := client.WriteConfirmed(ctx, trade)
+		assert.True(t, errors.Is(err, ErrWriteNotConfirmed))
+	})
+
+	t.Run("should return an error without a designated timestamp value", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		assert.NotNil(t, client.WriteConfirmed(context.Background(), testTrade{Pair: "BTC-USD"}))
+		assert.NotNil(t, client.WriteConfirmed(context.Background(), testRow{Name: "a"}))
+	})
+}
+
+func TestClient_MeasureIngestLag(t *testing.T) {
+	now := time.Date(2024, time.January, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("should write a probe stamped now and return the lag until it is queryable", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+		client.config.Clock = func() time.Time { return now }
+		polls := 0
+		client.pgSqlDB = openTestDB(t, &testResult{
+			columns: []string{"count"},
+			rows:    [][]driver.Value{{int64(1)}},
+			queryErr: func(query string) error {
+				assert.Equal(t, `SELECT count() FROM "test_trades" WHERE "ts" = $1 AND "pair" = $2`, query)
+				polls++
+				if polls < 3 {
+					return errors.New("pq: table does not exist")
+				}
+				return nil
+			},
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		lag, err := client.MeasureIngestLag(ctx, testTrade{Pair: "BTC-USD", Price: 1, TS: time.Unix(1, 0)})
+		assert.Nil(t, err)
+		assert.True(t, lag >= ingestLagMinBackoff+2*ingestLagMinBackoff)
+		assert.Equal(t, 3, polls)
+
+		expected := "test_trades,pair=BTC-USD price=1 1704164645000000000\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+
+	t.Run("should return an error if the probe never appears", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+		client.pgSqlDB = newTestDB(t, []string{"count"}, []driver.Value{int64(0)})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := client.MeasureIngestLag(ctx, testTrade{Pair: "BTC-USD"})
+		assert.True(t, errors.Is(err, ErrWriteNotConfirmed))
+	})
+
+	t.Run("should return an error without a designated timestamp field", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		_, err := client.MeasureIngestLag(context.Background(), testRow{Name: "a"})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestClient_ILPLocalAddr(t *testing.T) {
+	t.Run("should dial from the configured local address", func(t *testing.T) {
+		server := newTestILPServer(t)
+		localAddr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}
+		client, err := New(Config{ILPHost: server.ln.Addr().String(), ILPLocalAddr: localAddr})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+		defer client.Close()
+
+		assert.Equal(t, "127.0.0.1", client.ilpConn.LocalAddr().(*net.TCPAddr).IP.String())
+	})
+
+	t.Run("should resolve the host in the family of the local address", func(t *testing.T) {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+		assert.Equal(t, "tcp", client.ilpNetwork())
+
+		client.config.ILPLocalAddr = &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}
+		assert.Equal(t, "tcp4", client.ilpNetwork())
+
+		client.config.ILPLocalAddr = &net.TCPAddr{IP: net.ParseIP("::1")}
+		assert.Equal(t, "tcp6", client.ilpNetwork())
+	})
+}
+
+func TestClient_ILPWriter(t *testing.T) {
+	t.Run("should write complete lines copied into it", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		stream := "test_rows,name=a value=1i\ntest_rows,name=b value=2i\n"
+		n, err := io.Copy(client.ILPWriter(), strings.NewReader(stream))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(len(stream)), n)
+		assert.Equal(t, stream, server.waitFor(len(stream)))
+		assert.Equal(t, int64(2), client.Stats().LinesWritten)
+	})
+
+	t.Run("should hold incomplete lines until they are completed", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+		w := client.ILPWriter()
+
+		_, err := w.Write([]byte("test_rows,name=a value=1i\ntest_rows,"))
+		assert.Nil(t, err)
+		assert.Equal(t, "test_rows,name=a value=1i\n", server.waitFor(26))
+
+		assert.Nil(t, client.WriteMessage([]byte("test_rows,name=c value=3i\n")))
+
+		_, err = w.Write([]byte("name=b value=2i\n"))
+		assert.Nil(t, err)
+
+		expected := "test_rows,name=a value=1i\ntest_rows,name=c value=3i\ntest_rows,name=b value=2i\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+}
+
+func TestClient_ILPOnly(t *testing.T) {
+	t.Run("should not set up a PG connection without a PGConnStr", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		assert.Nil(t, client.DB())
+		assert.Nil(t, client.Write(testRow{Name: "a", Value: 1}))
+		assert.Equal(t, "test_rows,name=a value=1i\n", server.waitFor(26))
+
+		assert.True(t, errors.Is(client.Ping(), ErrPGNotConfigured))
+		_, err := client.Query("SELECT 1")
+		assert.True(t, errors.Is(err, ErrPGNotConfigured))
+		assert.True(t, errors.Is(client.QueryRow("SELECT 1").Scan(), ErrPGNotConfigured))
+		assert.True(t, errors.Is(client.CreateTableIfNotExists(testRow{}), ErrPGNotConfigured))
+
+		assert.Nil(t, client.Close())
+	})
+}
+
+func TestClient_CreateTableIfNotExists_Concurrent(t *testing.T) {
+	newClient := func(t *testing.T, execErr func(query string, args []driver.Value) error) (*Client, *testResult) {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+		db, result := newTestExecDB(t, execErr)
+		client.pgSqlDB = db
+		return client, result
+	}
+
+	t.Run("should classify table exists and lock errors", func(t *testing.T) {
+		assert.True(t, isTableExistsError(errors.New("pq: table already exists")))
+		assert.False(t, isTableExistsError(errors.New("pq: could not lock 'test_rows'")))
+		assert.True(t, isTableLockedError(errors.New("pq: could not lock 'test_rows' [reason='create']")))
+		assert.True(t, isTableLockedError(errors.New("pq: Table busy [reason=insert]")))
+		assert.False(t, isTableLockedError(errors.New("pq: invalid column type")))
+	})
+
+	t.Run("should succeed for every worker when the others created the table", func(t *testing.T) {
+		var mu sync.Mutex
+		created := false
+		client, _ := newClient(t, func(query string, args []driver.Value) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if created {
+				return errors.New("pq: table already exists")
+			}
+			created = true
+			return nil
+		})
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- client.CreateTableIfNotExists(testRow{})
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			assert.Nil(t, err)
+		}
+	})
+
+	t.Run("should retry while the table is locked", func(t *testing.T) {
+		attempts := 0
+		client, result := newClient(t, func(query string, args []driver.Value) error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("pq: could not lock 'test_rows'")
+			}
+			return nil
+		})
+
+		assert.Nil(t, client.CreateTableIfNotExists(testRow{}))
+		assert.Equal(t, 3, len(result.executed()))
+	})
+
+	t.Run("should give up on a lock that is not released", func(t *testing.T) {
+		client, result := newClient(t, func(query string, args []driver.Value) error {
+			return errors.New("pq: could not lock 'test_rows'")
+		})
+
+		assert.NotNil(t, client.CreateTableIfNotExists(testRow{}))
+		assert.Equal(t, createTableAttempts, len(result.executed()))
+	})
+
+	t.Run("should not retry other errors", func(t *testing.T) {
+		client, result := newClient(t, func(query string, args []driver.Value) error {
+			return errors.New("pq: invalid column type")
+		})
+
+		assert.NotNil(t, client.CreateTableIfNotExists(testRow{}))
+		assert.Equal(t, 1, len(result.executed()))
+	})
+}
+
+func TestClient_CreateTableIfNotExists_Options(t *testing.T) {
+	t.Run("should create tables with the struct's CreateTableOptions", func(t *testing.T) {
+		client, err := New(Config{TableNamePrefix: "staging_"})
+		assert.Nil(t, err)
+		db, result := newTestExecDB(t, nil)
+		client.pgSqlDB = db
+
+		assert.Nil(t, client.CreateTableIfNotExists(testQuote{}, WithTableName("quotes")))
+		assert.Nil(t, client.CreateTablesIfNotExist(&testQuote{}))
+		assert.Equal(t, []string{
+			`CREATE TABLE IF NOT EXISTS "staging_quotes" ( "pair" symbol, "exchange" symbol, "bid_price" double, "ts" timestamp ) , index(pair) timestamp(ts) PARTITION BY DAY ;`,
+			`CREATE TABLE IF NOT EXISTS "staging_test_quotes" ( "pair" symbol, "exchange" symbol, "bid_price" double, "ts" timestamp ) , index(pair) timestamp(ts) PARTITION BY DAY ;`,
+		}, result.executed())
+	})
+}
+
+func TestClient_CreateTablesIfNotExist(t *testing.T) {
+	t.Run("should create every table", func(t *testing.T) {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+		db, result := newTestExecDB(t, nil)
+		client.pgSqlDB = db
+
+		assert.Nil(t, client.CreateTablesIfNotExist(testRow{}, testTrade{}, &testEvent{}))
+		executed := result.executed()
+		assert.Equal(t, 3, len(executed))
+		assert.Contains(t, executed[1], `"test_trades"`)
+	})
+
+	t.Run("should create the other tables and return the error of each failed one", func(t *testing.T) {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+		db, result := newTestExecDB(t, func(query string, args []driver.Value) error {
+			if strings.Contains(query, `"test_rows"`) {
+				return errors.New("pq: invalid column type")
+			}
+			return nil
+		})
+		client.pgSqlDB = db
+
+		err = client.CreateTablesIfNotExist(testRow{}, "not a struct", testTrade{})
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "questdb.testRow: could not execute sql statement")
+		assert.Contains(t, err.Error(), "string: could not make new model")
+		assert.Equal(t, 2, len(result.executed()))
+	})
+}
+
+func TestClient_EnsureTable(t *testing.T) {
+	newClient := func(t *testing.T, count int64) (*Client, *testResult) {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+		result := &testResult{columns: []string{"count"}, rows: [][]driver.Value{{count}}}
+		client.pgSqlDB = openTestDB(t, result)
+		return client, result
+	}
+
+	t.Run("should not create an existing table", func(t *testing.T) {
+		client, result := newClient(t, 1)
+		exists, err := client.TableExists("test_rows")
+		assert.Nil(t, err)
+		assert.True(t, exists)
+
+		created, err := client.EnsureTable(context.Background(), testRow{})
+		assert.Nil(t, err)
+		assert.False(t, created)
+		assert.Equal(t, 0, len(result.executed()))
+	})
+
+	t.Run("should create an absent table", func(t *testing.T) {
+		client, result := newClient(t, 0)
+		created, err := client.EnsureTable(context.Background(), testRow{})
+		assert.Nil(t, err)
+		assert.True(t, created)
+		executed := result.executed()
+		assert.Equal(t, 1, len(executed))
+		assert.Contains(t, executed[0], `CREATE TABLE IF NOT EXISTS "test_rows"`)
+	})
+
+	t.Run("should return the error of the existence query", func(t *testing.T) {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+		result := &testResult{queryErr: func(query string) error { return errors.New("pq: connection refused") }}
+		client.pgSqlDB = openTestDB(t, result)
+
+		created, err := client.EnsureTable(context.Background(), testRow{})
+		assert.NotNil(t, err)
+		assert.False(t, created)
+		assert.Equal(t, 0, len(result.executed()))
+	})
+}
+
+func TestClient_AssertSchema(t *testing.T) {
+	newClient := func(t *testing.T, rows ...[]driver.Value) *Client {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+		client.pgSqlDB = newTestDB(t, []string{"column", "type"}, rows...)
+		return client
+	}
+
+	t.Run("should pass when every column has the expected type", func(t *testing.T) {
+		client := newClient(t,
+			[]driver.Value{"pair", "SYMBOL"},
+			[]driver.Value{"price", "DOUBLE"},
+			[]driver.Value{"ts", "TIMESTAMP"},
+			[]driver.Value{"extra", "LONG"},
+		)
+		assert.Nil(t, client.AssertSchema(testTrade{}))
+	})
+
+	t.Run("should list every missing and mistyped column", func(t *testing.T) {
+		client := newClient(t,
+			[]driver.Value{"pair", "STRING"},
+			[]driver.Value{"ts", "TIMESTAMP"},
+		)
+		err := client.AssertSchema(testTrade{})
+		assert.True(t, errors.Is(err, ErrSchemaMismatch))
+		assert.Contains(t, err.Error(), "column 'pair' is string, expected symbol")
+		assert.Contains(t, err.Error(), "column 'price' is missing, expected double")
+	})
+
+	t.Run("should fail for a table which does not exist", func(t *testing.T) {
+		client := newClient(t)
+		err := client.AssertSchema(testTrade{})
+		assert.True(t, errors.Is(err, ErrSchemaMismatch))
+		assert.Contains(t, err.Error(), "does not exist")
+	})
+}
+
+type testActiveUser struct {
+	UserID string    `qdb:"UserID;symbol"`
+	Visits int64     `qdb:"visits;long"`
+	TS     time.Time `qdb:"ts;timestamp;designatedTS:true"`
+}
+
+func TestClient_CheckPermissions(t *testing.T) {
+	newClient := func(t *testing.T, result *testResult) *Client {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+		client.pgSqlDB = openTestDB(t, result)
+		return client
+	}
+
+	t.Run("should pass when the user can select and create", func(t *testing.T) {
+		result := &testResult{}
+		client := newClient(t, result)
+
+		assert.Nil(t, client.CheckPermissions(testRow{}))
+		executed := result.executed()
+		assert.Equal(t, 2, len(executed))
+		assert.True(t, strings.HasPrefix(executed[0], `CREATE TABLE "questdb_go_permission_check_`))
+		assert.True(t, strings.HasPrefix(executed[1], `DROP TABLE IF EXISTS "questdb_go_permission_check_`))
+	})
+
+	t.Run("should pass when the table does not exist yet", func(t *testing.T) {
+		client := newClient(t, &testResult{queryErr: func(query string) error {
+			return errors.New("pq: table does not exist [table=test_rows]")
+		}})
+
+		assert.Nil(t, client.CheckPermissions(testRow{}))
+	})
+
+	t.Run("should list every missing permission", func(t *testing.T) {
+		client := newClient(t, &testResult{
+			queryErr: func(query string) error {
+				assert.Equal(t, `SELECT * FROM "test_rows" LIMIT 0`, query)
+				return errors.New("pq: permission denied [SELECT]")
+			},
+			execErr: func(query string, args []driver.Value) error {
+				return errors.New("pq: permission denied [CREATE TABLE]")
+			},
+		})
+
+		err := client.CheckPermissions(testRow{})
+		assert.True(t, errors.Is(err, ErrMissingPermissions))
+		assert.EqualError(t, err, "missing permissions: 0: cannot select from test_rows: pq: permission denied [SELECT]; "+
+			"1: cannot create tables: pq: permission denied [CREATE TABLE];")
+	})
+
+	t.Run("should report a probe table which cannot be dropped", func(t *testing.T) {
+		client := newClient(t, &testResult{execErr: func(query string, args []driver.Value) error {
+			if strings.HasPrefix(query, "DROP") {
+				return errors.New("pq: permission denied [DROP TABLE]")
+			}
+			return nil
+		}})
+
+		err := client.CheckPermissions(testRow{})
+		assert.True(t, errors.Is(err, ErrMissingPermissions))
+		assert.Contains(t, err.Error(), "cannot drop probe table")
+		assert.Contains(t, err.Error(), "left behind")
+	})
+
+	t.Run("should drop the probe table even if the context is done after creating it", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		result := &testResult{execErr: func(query string, args []driver.Value) error {
+			if strings.HasPrefix(query, "CREATE") {
+				cancel()
+			}
+			return nil
+		}}
+		client := newClient(t, result)
+
+		assert.Nil(t, client.CheckPermissionsContext(ctx, testRow{}))
+		executed := result.executed()
+		assert.Equal(t, 2, len(executed))
+		assert.True(t, strings.HasPrefix(executed[1], `DROP TABLE IF EXISTS "questdb_go_permission_check_`))
+	})
+}
+
+func TestClient_MixedCaseTableName(t *testing.T) {
+	for _, tableName := range []string{"ActiveUsers", `"ActiveUsers"`} {
+		t.Run("should keep the case of table name "+tableName+" throughout", func(t *testing.T) {
+			server := newTestILPServer(t)
+			client := server.client(t)
+			db, result := newTestExecDB(t, nil)
+			client.pgSqlDB = db
+			u := testActiveUser{UserID: "u1", Visits: 2, TS: time.Unix(1, 0)}
+
+			assert.Nil(t, client.CreateTableIfNotExists(u, WithTableName(tableName)))
+			assert.Equal(t, []string{`CREATE TABLE IF NOT EXISTS "ActiveUsers" ( "UserID" symbol, "visits" long, "ts" timestamp ) timestamp(ts) ;`}, result.executed())
+
+			assert.Nil(t, client.Write(u, WithTableName(tableName)))
+			expected := "ActiveUsers,UserID=u1 visits=2i 1000000000\n"
+			assert.Equal(t, expected, server.waitFor(len(expected)))
+
+			m, err := NewModel(u)
+			assert.Nil(t, err)
+			assert.Nil(t, applyOptions(m, []option{WithTableName(tableName)}))
+			assert.Equal(t, `SELECT UserID, visits, ts FROM "ActiveUsers"`, "SELECT "+m.Columns()+" FROM "+QuoteIdentifier(m.tableName))
+			latest, err := m.LatestOnStatement("UserID")
+			assert.Nil(t, err)
+			assert.Equal(t, `SELECT UserID, visits, ts FROM "ActiveUsers" LATEST ON ts PARTITION BY UserID`, latest)
+		})
+	}
+}
+
+func TestClient_QueryScalar(t *testing.T) {
+	newClient := func(t *testing.T, v driver.Value) *Client {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+		client.pgSqlDB = newTestDB(t, []string{"value"}, []driver.Value{v})
+		return client
+	}
+	ctx := context.Background()
+
+	t.Run("should scan a count", func(t *testing.T) {
+		var count int64
+		assert.Nil(t, newClient(t, int64(42)).QueryScalar(ctx, "SELECT count() FROM trades", &count))
+		assert.Equal(t, int64(42), count)
+	})
+
+	t.Run("should scan a timestamp in UTC", func(t *testing.T) {
+		ts := time.Date(2022, 1, 1, 12, 0, 0, 0, time.FixedZone("NZDT", 13*60*60))
+		var max time.Time
+		assert.Nil(t, newClient(t, ts).QueryScalar(ctx, "SELECT max(ts) FROM trades", &max))
+		assert.Equal(t, time.UTC, max.Location())
+		assert.True(t, ts.Equal(max))
+	})
+
+	t.Run("should scan a NULL timestamp as the zero time", func(t *testing.T) {
+		max := time.Now()
+		assert.Nil(t, newClient(t, nil).QueryScalar(ctx, "SELECT max(ts) FROM trades", &max))
+		assert.True(t, max.IsZero())
+	})
+
+	t.Run("should base64 decode binary values into Bytes", func(t *testing.T) {
+		var b Bytes
+		assert.Nil(t, newClient(t, "aGk=").QueryScalar(ctx, "SELECT body FROM docs LIMIT 1", &b))
+		assert.Equal(t, Bytes("hi"), b)
+	})
+
+	t.Run("should return sql.ErrNoRows without rows", func(t *testing.T) {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+		client.pgSqlDB = newTestDB(t, []string{"value"})
+
+		var count int64
+		assert.Equal(t, sql.ErrNoRows, client.QueryScalar(ctx, "SELECT count() FROM trades", &count))
+	})
+}
+
+func TestClient_WriteMessage_Newlines(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{"add a missing newline", "test_rows,name=a value=1i", "test_rows,name=a value=1i\n"},
+		{"collapse doubled newlines", "test_rows,name=a value=1i\n\n\n", "test_rows,name=a value=1i\n"},
+		{"keep a single newline", "test_rows,name=a value=1i\ntest_rows,name=b value=2i\n", "test_rows,name=a value=1i\ntest_rows,name=b value=2i\n"},
+	}
+	for _, tt := range tests {
+		t.Run("should "+tt.name, func(t *testing.T) {
+			server := newTestILPServer(t)
+			client := server.client(t)
+
+			assert.Nil(t, client.WriteMessage([]byte(tt.message)))
+			// a marker line shows nothing else was written before it
+			assert.Nil(t, client.WriteMessage([]byte("marker")))
+			expected := tt.want + "marker\n"
+			assert.Equal(t, expected, server.waitFor(len(expected)))
+		})
+	}
+
+	t.Run("should not write messages of only newlines", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		assert.Nil(t, client.WriteMessage([]byte("\n\n")))
+		assert.Nil(t, client.WriteMessage(nil))
+		assert.Equal(t, int64(0), client.Stats().BytesWritten)
+	})
+}
+
+type testRawLine string
+
+func (l testRawLine) MarshalLine() ([]byte, error) {
+	return []byte(l), nil
+}
+
+func TestClient_Write_LineMarshalerNewline(t *testing.T) {
+	server := newTestILPServer(t)
+	client := server.client(t)
+
+	assert.Nil(t, client.Write(testRawLine("raw_lines value=1i")))
+	assert.Nil(t, client.Write(testRawLine("raw_lines value=2i\n\n")))
+	expected := "raw_lines value=1i\nraw_lines value=2i\n"
+	assert.Equal(t, expected, server.waitFor(len(expected)))
+}
@@ -0,0 +1,286 @@
+package questdb
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// CopyMode is how CopyInsert loads rows over the PG wire
+type CopyMode int
+
+const (
+	// CopyAtomic loads all rows with a single COPY ... FROM STDIN within a transaction. Any
+	// bad row aborts the COPY, so either every row is inserted or none are. This is the default.
+	CopyAtomic CopyMode = iota
+	// CopyBatchedInsert loads rows with multi-row INSERT statements of WithCopyBatchSize rows
+	// each, so a bad row only fails the rows of its own statement.
+	CopyBatchedInsert
+)
+
+// DefaultCopyBatchSize is the number of rows per INSERT statement in CopyBatchedInsert mode
+const DefaultCopyBatchSize = 10
+
+// CopyOption is an option of CopyInsert, built by the WithCopy funcs
+type CopyOption struct {
+	mode      CopyMode
+	batchSize int
+}
+
+// WithCopyMode func sets how CopyInsert loads rows. Defaults to CopyAtomic.
+func WithCopyMode(mode CopyMode) CopyOption {
+	return CopyOption{
+		mode: mode,
+	}
+}
+
+// WithCopyBatchSize func sets the number of rows per INSERT statement in CopyBatchedInsert
+// mode. Defaults to DefaultCopyBatchSize.
+func WithCopyBatchSize(n int) CopyOption {
+	return CopyOption{
+		batchSize: n,
+	}
+}
+
+// CopyInsert func inserts rows, valid structs with qdb tags of the same type (or pointers to
+// them), into their table over the PG wire rather than the ILP port. Unlike the ILP writes,
+// the table must already exist and failures are reported back.
+//
+// In CopyAtomic mode (the default) the returned map is always nil and the error is that of the
+// first failure, in which case no rows are inserted. In CopyBatchedInsert mode the returned map
+// holds the error of every row which was not inserted, by its index in rows, and the error
+// wraps ErrRowsNotInserted if there are any. A row whose values are invalid fails alone, a
+// row failing on the server fails every row of its statement. Other errors, such as an invalid
+// first row or a canceled ctx, stop CopyInsert and are returned as is.
+func (c *Client) CopyInsert(ctx context.Context, rows []interface{}, opts ...CopyOption) (map[int]error, error) {
+	mode, batchSize := CopyAtomic, DefaultCopyBatchSize
+	for _, opt := range opts {
+		if opt.mode != CopyAtomic {
+			mode = opt.mode
+		}
+		if opt.batchSize > 0 {
+			batchSize = opt.batchSize
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	m, err := c.newModel(rows[0], nil)
+	if err != nil {
+		return nil, err
+	}
+	if m.exploded != nil {
+		return nil, fmt.Errorf("%s: copying exploded fields is not supported", m.exploded.name)
+	}
+
+	if mode == CopyBatchedInsert {
+		return c.batchedInsert(ctx, m, rows, batchSize)
+	}
+	return nil, c.copyIn(ctx, m, rows)
+}
+
+// copyIn func inserts rows of m's type with a single COPY within a transaction
+func (c *Client) copyIn(ctx context.Context, m *Model, rows []interface{}) (err error) {
+	stmtSQL := pq.CopyIn(m.tableName, m.copyColumns()...)
+	ctx, finish := c.tracer().StartSpan(ctx, "questdb.CopyInsert", Attribute{Key: AttributeStatement, Value: stmtSQL})
+	defer func() { finish(err) }()
+
+	tx, err := c.db().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, stmtSQL)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, row := range rows {
+		values, err := m.copyRow(row)
+		if err != nil {
+			return fmt.Errorf("row %d: %w", i, err)
+		}
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return fmt.Errorf("row %d: %w", i, err)
+		}
+	}
+	// an Exec without arguments ends the COPY
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// batchedInsert func inserts rows of m's type with multi-row INSERT statements of batchSize
+// rows each and returns the errors of the rows which were not inserted
+func (c *Client) batchedInsert(ctx context.Context, m *Model, rows []interface{}, batchSize int) (map[int]error, error) {
+	columns := m.copyColumns()
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = QuoteIdentifier(column)
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", QuoteIdentifier(m.tableName), strings.Join(quoted, ", "))
+
+	rowErrs := map[int]error{}
+	for start := 0; start < len(rows); start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return rowErrs, err
+		}
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		var sb strings.Builder
+		args := []interface{}{}
+		batch := []int{}
+		for i := start; i < end; i++ {
+			values, err := m.copyRow(rows[i])
+			if err != nil {
+				rowErrs[i] = err
+				continue
+			}
+			placeholders := make([]string, len(values))
+			for j := range values {
+				placeholders[j] = fmt.Sprintf("$%d", len(args)+j+1)
+			}
+			if len(batch) > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString("(" + strings.Join(placeholders, ", ") + ")")
+			args = append(args, values...)
+			batch = append(batch, i)
+		}
+		if len(batch) == 0 {
+			continue
+		}
+
+		query := prefix + sb.String()
+		spanCtx, finish := c.tracer().StartSpan(ctx, "questdb.CopyInsert", Attribute{Key: AttributeStatement, Value: query})
+		_, err := c.db().ExecContext(spanCtx, query, args...)
+		finish(err)
+		if err != nil {
+			for _, i := range batch {
+				rowErrs[i] = err
+			}
+		}
+	}
+
+	if len(rowErrs) > 0 {
+		return rowErrs, fmt.Errorf("%w: %d of %d rows failed", ErrRowsNotInserted, len(rowErrs), len(rows))
+	}
+	return nil, nil
+}
+
+// copyColumns func returns the names of the columns CopyInsert inserts: every field's column
+// followed by the default symbols
+func (m *Model) copyColumns() []string {
+	columns := make([]string, 0, len(m.fields)+len(m.defaultSymbols))
+	for _, field := range m.fields {
+		columns = append(columns, field.qdbName)
+	}
+	return append(columns, m.defaultSymbolNames()...)
+}
+
+// copyRow func binds the Model to row and returns its values in the order of copyColumns. Values
+// MarshalLine would leave out are NULL, and a zero designated timestamp is the current time,
+// just as QuestDB stamps ILP lines without one.
+func (m *Model) copyRow(row interface{}) ([]interface{}, error) {
+	if err := m.Bind(row); err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, 0, len(m.fields)+len(m.defaultSymbols))
+	for _, field := range m.fields {
+		if field == m.designatedTS && (field.isNull || field.isZero) {
+			values = append(values, m.now().UTC())
+			continue
+		}
+		if !m.emits(field) {
+			values = append(values, nil)
+			continue
+		}
+
+		fieldValue := field.value
+		if fieldValue.Kind() == reflect.Ptr {
+			fieldValue = fieldValue.Elem()
+		}
+		v, err := field.storedValue(fieldValue.Interface())
+		if err != nil {
+			return nil, err
+		}
+		v, err = m.format.sqlValue(v, field.columnType())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.name, err)
+		}
+		values = append(values, v)
+	}
+	for _, name := range m.defaultSymbolNames() {
+		values = append(values, m.defaultSymbols[name])
+	}
+	return values, nil
+}
+
+// sqlValue func returns v, a value stored in a column of qdbType, as the query argument holding
+// the same value the ILP line does: binary and json values are base64 encoded strings, long256
+// values are hex and integer dates and timestamps are converted to times.
+func (f lineFormat) sqlValue(v interface{}, qdbType QuestDBType) (interface{}, error) {
+	switch qdbType {
+	case Char:
+		if val, ok := v.(rune); ok {
+			return string(val), nil
+		}
+	case Date:
+		if val, ok := v.(int64); ok {
+			return time.UnixMilli(val).UTC(), nil
+		}
+	case Timestamp:
+		if val, ok := v.(int64); ok {
+			if f.timestampResolution == NanosecondResolution {
+				return time.Unix(0, val).UTC(), nil
+			}
+			return time.UnixMicro(val).UTC(), nil
+		}
+	case Binary:
+		switch val := v.(type) {
+		case Bytes:
+			return base64.StdEncoding.EncodeToString(val), nil
+		case []byte:
+			return base64.StdEncoding.EncodeToString(val), nil
+		case string:
+			return base64.StdEncoding.EncodeToString([]byte(val)), nil
+		}
+	case JSON:
+		by, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("could not json marshal %T: %w", v, err)
+		}
+		return base64.StdEncoding.EncodeToString(by), nil
+	case Long256:
+		if val, ok := v.(Long256Value); ok {
+			return val.String(), nil
+		}
+	case DoubleArray, DoubleArray2D:
+		if _, _, err := flattenDoubleArray(v, qdbType); err != nil {
+			return nil, err
+		}
+		return pq.Array(v), nil
+	}
+	return v, nil
+}
@@ -0,0 +1,112 @@
+package questdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_CopyInsert(t *testing.T) {
+	newClient := func(t *testing.T, execErr func(query string, args []driver.Value) error) (*Client, *testResult) {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+		db, result := newTestExecDB(t, execErr)
+		client.pgSqlDB = db
+		return client, result
+	}
+	copyStmt := `COPY "test_rows" ("name", "value") FROM STDIN`
+
+	t.Run("should copy all rows within a transaction", func(t *testing.T) {
+		client, result := newClient(t, nil)
+
+		rowErrs, err := client.CopyInsert(context.Background(), []interface{}{
+			testRow{Name: "a", Value: 1},
+			&testRow{Name: "b", Value: 2},
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, rowErrs)
+		assert.Equal(t, []string{"BEGIN", copyStmt, copyStmt, copyStmt, "COMMIT"}, result.executed())
+	})
+
+	t.Run("should roll back every row when one fails in CopyAtomic mode", func(t *testing.T) {
+		client, result := newClient(t, func(query string, args []driver.Value) error {
+			if len(args) > 0 && args[0] == "bad" {
+				return errors.New("bad row")
+			}
+			return nil
+		})
+
+		rowErrs, err := client.CopyInsert(context.Background(), []interface{}{
+			testRow{Name: "a", Value: 1},
+			testRow{Name: "bad", Value: 2},
+			testRow{Name: "c", Value: 3},
+		})
+		assert.EqualError(t, err, "row 1: bad row")
+		assert.Nil(t, rowErrs)
+		assert.Equal(t, []string{"BEGIN", copyStmt, copyStmt, "ROLLBACK"}, result.executed())
+	})
+
+	t.Run("should only fail the batch of a bad row in CopyBatchedInsert mode", func(t *testing.T) {
+		client, result := newClient(t, func(query string, args []driver.Value) error {
+			for _, arg := range args {
+				if arg == "bad" {
+					return errors.New("bad row")
+				}
+			}
+			return nil
+		})
+
+		rowErrs, err := client.CopyInsert(context.Background(), []interface{}{
+			testRow{Name: "a", Value: 1},
+			testRow{Name: "b", Value: 2},
+			testRow{Name: "bad", Value: 3},
+			testRow{Name: "d", Value: 4},
+			testRow{Name: "e", Value: 5},
+		}, WithCopyMode(CopyBatchedInsert), WithCopyBatchSize(2))
+		assert.True(t, errors.Is(err, ErrRowsNotInserted))
+		assert.Equal(t, 2, len(rowErrs))
+		assert.EqualError(t, rowErrs[2], "bad row")
+		assert.EqualError(t, rowErrs[3], "bad row")
+
+		insert := `INSERT INTO "test_rows" ("name", "value") VALUES ($1, $2), ($3, $4)`
+		assert.Equal(t, []string{insert, insert, `INSERT INTO "test_rows" ("name", "value") VALUES ($1, $2)`}, result.executed())
+	})
+
+	t.Run("should fail an invalid row alone in CopyBatchedInsert mode", func(t *testing.T) {
+		client, result := newClient(t, nil)
+
+		rowErrs, err := client.CopyInsert(context.Background(), []interface{}{
+			testRow{Name: "a", Value: 1},
+			testTrade{Pair: "b"},
+			testRow{Name: "c", Value: 3},
+		}, WithCopyMode(CopyBatchedInsert))
+		assert.True(t, errors.Is(err, ErrRowsNotInserted))
+		assert.Equal(t, 1, len(rowErrs))
+		assert.NotNil(t, rowErrs[1])
+		assert.Equal(t, []string{`INSERT INTO "test_rows" ("name", "value") VALUES ($1, $2), ($3, $4)`}, result.executed())
+	})
+
+	t.Run("should insert values left out of the ILP line as NULL", func(t *testing.T) {
+		var inserted []driver.Value
+		client, _ := newClient(t, func(query string, args []driver.Value) error {
+			inserted = args
+			return nil
+		})
+
+		rowErrs, err := client.CopyInsert(context.Background(), []interface{}{testRow{Name: "a"}}, WithCopyMode(CopyBatchedInsert))
+		assert.Nil(t, err)
+		assert.Nil(t, rowErrs)
+		assert.Equal(t, []driver.Value{"a", nil}, inserted)
+	})
+
+	t.Run("should return ErrPGNotConfigured without a PG connection", func(t *testing.T) {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+
+		_, err = client.CopyInsert(context.Background(), []interface{}{testRow{Name: "a", Value: 1}})
+		assert.True(t, errors.Is(err, ErrPGNotConfigured))
+	})
+}
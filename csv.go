@@ -0,0 +1,277 @@
+package questdb
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CSVOption is an option of ImportCSV, built by the WithCSV funcs
+type CSVOption struct {
+	comma     rune
+	batchSize int
+}
+
+// WithCSVComma func sets the field delimiter of the imported CSV, e.g. '\t' to import TSV.
+// Defaults to ','.
+func WithCSVComma(comma rune) CSVOption {
+	return CSVOption{
+		comma: comma,
+	}
+}
+
+// WithCSVBatchSize func sets the number of rows ImportCSV buffers before writing them.
+// Defaults to DefaultBatchSize.
+func WithCSVBatchSize(n int) CSVOption {
+	return CSVOption{
+		batchSize: n,
+	}
+}
+
+// ImportCSV func reads CSV from r and writes each record as a row of prototype's model, a valid
+// struct with qdb tags (or a pointer to one). The first record is the header, whose names are
+// matched against the model's column names; a header name which is not a column is an error.
+// Each cell is parsed into its column's field according to the field's QuestDBType:
+//
+//	boolean                              strconv.ParseBool
+//	byte, short, int, long               base 10 integer
+//	float, double                        strconv.ParseFloat
+//	char, symbol, string                 as is (a char must be one character)
+//	uuid                                 as is into a string, hyphenated hex into [16]byte
+//	date, timestamp                      RFC 3339 time, or an integer count of milliseconds
+//	                                     (date) or microseconds (timestamp) since the epoch
+//	binary                               base64 encoded bytes
+//	json                                 JSON
+//	long256                              0x prefixed hex
+//
+// Empty cells leave their field at its zero value. Rows are written in batches of
+// WithCSVBatchSize rows. ImportCSV returns the number of rows written, and stops at the first
+// error, which names the CSV line it occurred on. Rows buffered when an error occurs are not
+// written.
+func (c *Client) ImportCSV(ctx context.Context, r io.Reader, prototype interface{}, opts ...CSVOption) (int, error) {
+	batchSize := DefaultBatchSize
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	for _, opt := range opts {
+		if opt.comma != 0 {
+			reader.Comma = opt.comma
+		}
+		if opt.batchSize > 0 {
+			batchSize = opt.batchSize
+		}
+	}
+
+	m, err := c.newModel(prototype, nil)
+	if err != nil {
+		return 0, err
+	}
+	structType := m.typ
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not read csv header: %w", err)
+	}
+	// records are reused by the reader, so keep a copy of the header
+	header = append([]string{}, header...)
+	fields := make([]*field, len(header))
+	for i, name := range header {
+		fields[i] = m.fieldByColumn(name)
+		if fields[i] == nil {
+			return 0, fmt.Errorf("csv column '%s' is not a column of %s", name, m.tableName)
+		}
+	}
+
+	var sb strings.Builder
+	written, buffered, lines := 0, 0, 0
+	flush := func() error {
+		if buffered == 0 {
+			return nil
+		}
+		if err := c.traceWrite(ctx, "questdb.ImportCSV", []string{m.tableName}, []byte(sb.String()), lines); err != nil {
+			return err
+		}
+		sb.Reset()
+		written += buffered
+		buffered, lines = 0, 0
+		return nil
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return written, fmt.Errorf("could not read csv: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		elem := reflect.New(structType)
+		m.bind(elem)
+		for i, cell := range record {
+			if cell == "" {
+				continue
+			}
+			if err := parseCSVCell(cell, fields[i], elem); err != nil {
+				return written, fmt.Errorf("csv line %d: column '%s': %w", line, header[i], err)
+			}
+		}
+
+		b, n, err := c.marshalLine(m)
+		if err != nil {
+			return written, fmt.Errorf("csv line %d: %w", line, err)
+		}
+		sb.Write(b)
+		buffered++
+		lines += n
+		if buffered >= batchSize {
+			if err := flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return written, err
+	}
+	return written, nil
+}
+
+// parseCSVCell func parses cell according to f's QuestDBType and sets it as f's value within
+// the struct pointed to by root
+func parseCSVCell(cell string, f *field, root reflect.Value) error {
+	v := allocFieldByIndex(root, f.index)
+	if !v.IsValid() {
+		return fmt.Errorf("cannot set field %s", f.name)
+	}
+	// allocate pointer fields
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case f.qdbType == Char && v.Kind() == reflect.Int32:
+		if utf8.RuneCountInString(cell) != 1 {
+			return fmt.Errorf("'%s' must be exactly one character long to be a %s", cell, f.qdbType)
+		}
+		r, _ := utf8.DecodeRuneInString(cell)
+		v.SetInt(int64(r))
+		return nil
+	case f.tagOptions.timeFormat != "" || v.Kind() == reflect.String:
+		v.SetString(cell)
+		return nil
+	}
+
+	switch f.qdbType {
+	case Boolean:
+		b, err := strconv.ParseBool(cell)
+		if err != nil {
+			return err
+		}
+		if v.Kind() != reflect.Bool {
+			break
+		}
+		v.SetBool(b)
+		return nil
+	case Byte, Short, Int, Long:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(cell, 10, v.Type().Bits())
+			if err != nil {
+				return err
+			}
+			if f.tagOptions.durationUnit > 0 {
+				n *= int64(f.tagOptions.durationUnit)
+			}
+			v.SetInt(n)
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n, err := strconv.ParseUint(cell, 10, v.Type().Bits())
+			if err != nil {
+				return err
+			}
+			v.SetUint(n)
+			return nil
+		}
+	case Float, Double:
+		if v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64 {
+			n, err := strconv.ParseFloat(cell, v.Type().Bits())
+			if err != nil {
+				return err
+			}
+			v.SetFloat(n)
+			return nil
+		}
+	case Date, Timestamp:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			t, err := parseCSVTime(cell, f.qdbType)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(t))
+			return nil
+		}
+	case Binary:
+		by, err := base64.StdEncoding.DecodeString(cell)
+		if err != nil {
+			return fmt.Errorf("could not base64 decode: %w", err)
+		}
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(by)
+			return nil
+		}
+	case JSON:
+		return json.Unmarshal([]byte(cell), v.Addr().Interface())
+	case UUID:
+		if isUUIDType(v.Type()) {
+			u, err := parseUUID(cell)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(u).Convert(v.Type()))
+			return nil
+		}
+	case Long256:
+		if l, ok := v.Addr().Interface().(*Long256Value); ok {
+			parsed, err := ParseLong256(cell)
+			if err != nil {
+				return err
+			}
+			*l = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot parse %s into %s field of type %s", f.qdbType, f.name, v.Type())
+}
+
+// parseCSVTime func parses cell as an RFC 3339 time or, failing that, as an integer count of
+// milliseconds (date) or microseconds (timestamp) since the Unix epoch
+func parseCSVTime(cell string, qdbType QuestDBType) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, cell)
+	if err == nil {
+		return t, nil
+	}
+	n, intErr := strconv.ParseInt(cell, 10, 64)
+	if intErr != nil {
+		return time.Time{}, err
+	}
+	if qdbType == Date {
+		return time.UnixMilli(n), nil
+	}
+	return time.UnixMicro(n), nil
+}
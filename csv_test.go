@@ -0,0 +1,110 @@
+package questdb
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_ImportCSV(t *testing.T) {
+	t.Run("should write every csv row as a line in batches", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		csv := "pair,price,ts\n" +
+			"BTC-USD,1.5,2022-01-01T00:00:00Z\n" +
+			"ETH-USD,2.5,1640995201000000\n" +
+			"SOL-USD,,\n"
+		n, err := client.ImportCSV(context.Background(), strings.NewReader(csv), testTrade{}, WithCSVBatchSize(2))
+		assert.Nil(t, err)
+		assert.Equal(t, 3, n)
+
+		expected := "test_trades,pair=BTC-USD price=1.5 1640995200000000000\n" +
+			"test_trades,pair=ETH-USD price=2.5 1640995201000000000\n" +
+			"test_trades,pair=SOL-USD\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+
+	t.Run("should import tsv", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		n, err := client.ImportCSV(context.Background(), strings.NewReader("value\tname\n1\ta\n"), &testRow{}, WithCSVComma('\t'))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, "test_rows,name=a value=1i\n", server.waitFor(26))
+	})
+
+	t.Run("should return parse errors with their line number", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		csv := "name,value\na,1\nb,two\n"
+		n, err := client.ImportCSV(context.Background(), strings.NewReader(csv), testRow{}, WithCSVBatchSize(1))
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "csv line 3: column 'value'")
+		assert.Equal(t, 1, n)
+	})
+
+	t.Run("should return an error for unknown header columns", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		_, err := client.ImportCSV(context.Background(), strings.NewReader("name,volume\n"), testRow{})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestParseCSVCell(t *testing.T) {
+	type row struct {
+		Flag    bool           `qdb:"flag;boolean"`
+		Small   int8           `qdb:"small;byte"`
+		Letter  rune           `qdb:"letter;char"`
+		Day     time.Time      `qdb:"day;date"`
+		Elapsed time.Duration  `qdb:"elapsed;long;durationUnit:ms"`
+		Body    Bytes          `qdb:"body;binary"`
+		Meta    map[string]int `qdb:"meta;json"`
+		Hash    Long256Value   `qdb:"hash;long256"`
+		Price   *float64       `qdb:"price;double"`
+		ID      testUUID       `qdb:"id;uuid"`
+	}
+
+	m, err := NewModel(&row{})
+	assert.Nil(t, err)
+
+	r := &row{}
+	root := reflect.ValueOf(r)
+	for column, cell := range map[string]string{
+		"flag":    "true",
+		"small":   "-8",
+		"letter":  "x",
+		"day":     "1000",
+		"elapsed": "1500",
+		"body":    "aGk=",
+		"meta":    `{"a":1}`,
+		"hash":    "0x1f",
+		"price":   "1.25",
+		"id":      "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11",
+	} {
+		assert.Nil(t, parseCSVCell(cell, m.fieldByColumn(column), root), column)
+	}
+
+	assert.True(t, r.Flag)
+	assert.Equal(t, int8(-8), r.Small)
+	assert.Equal(t, 'x', r.Letter)
+	assert.True(t, time.UnixMilli(1000).Equal(r.Day))
+	assert.Equal(t, 1500*time.Millisecond, r.Elapsed)
+	assert.Equal(t, Bytes("hi"), r.Body)
+	assert.Equal(t, map[string]int{"a": 1}, r.Meta)
+	assert.Equal(t, "0x1f", r.Hash.String())
+	assert.Equal(t, 1.25, *r.Price)
+	assert.Equal(t, "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", formatUUID(r.ID))
+
+	assert.NotNil(t, parseCSVCell("300", m.fieldByColumn("small"), root))
+	assert.NotNil(t, parseCSVCell("xy", m.fieldByColumn("letter"), root))
+	assert.NotNil(t, parseCSVCell("a0eebc99", m.fieldByColumn("id"), root))
+}
@@ -0,0 +1,93 @@
+package questdb
+
+// ILPDialect struct holds the separators and type suffixes of the Influx Line Protocol dialect
+// a line is written in:
+//
+//	<table name>,<symbol>,<symbol> <column>,<column> <timestamp>
+//	           ^ SymbolSeparator  ^ FieldSeparator ^ ColumnSeparator
+//
+// QuestDB only ingests StandardILPDialect. Other dialects are for QuestDB compatible sinks or
+// proxies which expect variations of the format, and the lines they produce may be rejected or
+// misread by QuestDB itself.
+type ILPDialect struct {
+	// SymbolSeparator comes before each symbol, after the table name or the previous symbol
+	SymbolSeparator string
+	// FieldSeparator separates the table name and symbols, the columns and the timestamp
+	FieldSeparator string
+	// ColumnSeparator separates a column from the previous one
+	ColumnSeparator string
+	// IntSuffix is appended to integer values
+	IntSuffix string
+	// TimestampSuffix is appended to timestamp column values written at MicrosecondResolution
+	TimestampSuffix string
+	// NanosecondTimestampSuffix is appended to timestamp column values written at
+	// NanosecondResolution
+	NanosecondTimestampSuffix string
+}
+
+// StandardILPDialect is the Influx Line Protocol dialect QuestDB ingests, which is the default
+var StandardILPDialect = ILPDialect{
+	SymbolSeparator:           ",",
+	FieldSeparator:            " ",
+	ColumnSeparator:           ",",
+	IntSuffix:                 "i",
+	TimestampSuffix:           "t",
+	NanosecondTimestampSuffix: "n",
+}
+
+// LegacyILPDialect is the dialect of InfluxDB 1.x era consumers, which do not know the type
+// suffixes of integer and timestamp values. Setting it as Config.ILPDialect writes the same lines
+// as setting Config.LegacyIntFormat.
+var LegacyILPDialect = ILPDialect{
+	SymbolSeparator: ",",
+	FieldSeparator:  " ",
+	ColumnSeparator: ",",
+}
+
+// lineSize func returns the length in bytes of the line the dialect writes for a table name,
+// symbols, columns and timestamp (all already serialized), including the trailing newline
+func (d ILPDialect) lineSize(tableName string, symbols, columns []lineEntry, timestamp string) int {
+	size := len(tableName) + 1
+	for _, symbol := range symbols {
+		size += len(d.SymbolSeparator) + len(symbol.name) + 1 + len(symbol.value)
+	}
+	for i, column := range columns {
+		if i == 0 {
+			size += len(d.FieldSeparator)
+		} else {
+			size += len(d.ColumnSeparator)
+		}
+		size += len(column.name) + 1 + len(column.value)
+	}
+	if timestamp != "" {
+		size += len(d.FieldSeparator) + len(timestamp)
+	}
+	return size
+}
+
+// appendLine func appends to b the line the dialect writes for a table name, symbols, columns and
+// timestamp (all already serialized), including the trailing newline
+func (d ILPDialect) appendLine(b []byte, tableName string, symbols, columns []lineEntry, timestamp string) []byte {
+	b = append(b, tableName...)
+	for _, symbol := range symbols {
+		b = append(b, d.SymbolSeparator...)
+		b = append(b, symbol.name...)
+		b = append(b, '=')
+		b = append(b, symbol.value...)
+	}
+	for i, column := range columns {
+		if i == 0 {
+			b = append(b, d.FieldSeparator...)
+		} else {
+			b = append(b, d.ColumnSeparator...)
+		}
+		b = append(b, column.name...)
+		b = append(b, '=')
+		b = append(b, column.value...)
+	}
+	if timestamp != "" {
+		b = append(b, d.FieldSeparator...)
+		b = append(b, timestamp...)
+	}
+	return append(b, '\n')
+}
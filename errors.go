@@ -0,0 +1,64 @@
+package questdb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// multiError is a list of errors which is itself an error. It is used wherever several
+// independent problems are collected and reported at once.
+type multiError []error
+
+// Error func implements the error interface
+func (e multiError) Error() string {
+	var sb strings.Builder
+	for i, err := range e {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(fmt.Sprintf("%d: %s;", i, err))
+	}
+	return sb.String()
+}
+
+// Unwrap func returns the errors in e, for errors.Is and errors.As from Go 1.20 which follow
+// an Unwrap() []error method
+func (e multiError) Unwrap() []error {
+	return e
+}
+
+// Is func reports whether any of the errors in e matches target, so errors.Is matches them on Go
+// releases which do not follow Unwrap() []error
+func (e multiError) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As func sets target to the first of the errors in e which matches it, so errors.As matches
+// them on Go releases which do not follow Unwrap() []error
+func (e multiError) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinErrors func returns nil if errs is empty, the only error if errs holds exactly one
+// error, or a multiError holding all of errs.
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return multiError(errs)
+	}
+}
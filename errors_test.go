@@ -0,0 +1,35 @@
+package questdb
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiError(t *testing.T) {
+	typeErr := &incompatibleTypeError{v: 1, qdbType: String}
+	err := joinErrors([]error{
+		errors.New("first"),
+		fmt.Errorf("could not close pg sql db: %w", ErrNotConnected),
+		typeErr,
+	})
+
+	t.Run("should match the sentinels of any of its errors", func(t *testing.T) {
+		assert.True(t, err.(multiError).Is(ErrNotConnected))
+		assert.False(t, err.(multiError).Is(ErrPGOpen))
+		assert.True(t, errors.Is(err, ErrNotConnected))
+		assert.True(t, errors.Is(fmt.Errorf("could not close: %w", err), ErrNotConnected))
+	})
+
+	t.Run("should set the first of its errors of the target type", func(t *testing.T) {
+		var target *incompatibleTypeError
+		assert.True(t, err.(multiError).As(&target))
+		assert.Equal(t, typeErr, target)
+
+		target = nil
+		assert.True(t, errors.As(err, &target))
+		assert.Equal(t, typeErr, target)
+	})
+}
@@ -0,0 +1,60 @@
+package questdb
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// RawJSON is an encoded JSON value for json columns whose shape is not known up front or is
+// decoded later, like json.RawMessage. It is written verbatim, rather than marshalled from a Go
+// value, and implements the Scanner interface, so ScanInto, ScanRows and QueryScalar base64
+// decode the stored column back into the raw JSON. A NULL column scans as a nil RawJSON.
+type RawJSON []byte
+
+// MarshalJSON func implements the json.Marshaler interface, returning r itself, or null if r is
+// nil
+func (r RawJSON) MarshalJSON() ([]byte, error) {
+	if r == nil {
+		return []byte("null"), nil
+	}
+	return r, nil
+}
+
+// UnmarshalJSON func implements the json.Unmarshaler interface, setting r to a copy of data
+func (r *RawJSON) UnmarshalJSON(data []byte) error {
+	*r = append((*r)[0:0], data...)
+	return nil
+}
+
+// Decode func json unmarshals r into v
+func (r RawJSON) Decode(v interface{}) error {
+	return json.Unmarshal(r, v)
+}
+
+// QDBScan func implements the Scanner interface. json values are stored in QuestDB as base64
+// encoded strings, which the driver may return as either a string or a []byte, so src is base64
+// decoded and checked to be valid JSON.
+func (r *RawJSON) QDBScan(src interface{}) error {
+	var encoded string
+	switch val := src.(type) {
+	case nil:
+		*r = nil
+		return nil
+	case string:
+		encoded = val
+	case []byte:
+		encoded = string(val)
+	default:
+		return fmt.Errorf("%T cannot be scanned into RawJSON", val)
+	}
+	by, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("could not base64 decode src: %w", err)
+	}
+	if !json.Valid(by) {
+		return fmt.Errorf("'%s' is not valid json", by)
+	}
+	*r = by
+	return nil
+}
@@ -0,0 +1,68 @@
+package questdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRawJSON_QDBScan(t *testing.T) {
+	type order struct {
+		ID    string  `qdb:"id;symbol"`
+		Attrs RawJSON `qdb:"attrs;json"`
+	}
+
+	written := &order{ID: "a", Attrs: RawJSON(`{"side":"buy","qty":3}`)}
+	m, err := NewModel(written)
+	assert.Nil(t, err)
+	// the serialized ILP value is a quoted base64 string; QuestDB returns it unquoted
+	stored := strings.Trim(m.fields[1].valueSerialized, `"`)
+
+	t.Run("should scan the stored column through the Scanner intermediate", func(t *testing.T) {
+		// *RawJSON is not a sql.Scanner, so it is only reachable through the intermediate proxy
+		_, isSQLScanner := interface{}(&written.Attrs).(interface{ Scan(interface{}) error })
+		assert.False(t, isSQLScanner)
+
+		for _, src := range []driver.Value{stored, []byte(stored)} {
+			db := newTestDB(t, []string{"id", "attrs"}, []driver.Value{"a", src})
+			read := &order{}
+			assert.Nil(t, ScanInto(db.QueryRow("SELECT id, attrs FROM orders"), read))
+			assert.Equal(t, written, read)
+
+			var attrs struct {
+				Side string `json:"side"`
+				Qty  int    `json:"qty"`
+			}
+			assert.Nil(t, read.Attrs.Decode(&attrs))
+			assert.Equal(t, "buy", attrs.Side)
+			assert.Equal(t, 3, attrs.Qty)
+		}
+	})
+
+	t.Run("should scan NULL as nil", func(t *testing.T) {
+		db := newTestDB(t, []string{"id", "attrs"}, []driver.Value{"a", nil})
+		read := &order{Attrs: RawJSON(`{}`)}
+		assert.Nil(t, ScanInto(db.QueryRow("SELECT id, attrs FROM orders"), read))
+		assert.Nil(t, read.Attrs)
+	})
+
+	t.Run("should scan a scalar query", func(t *testing.T) {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+		client.pgSqlDB = newTestDB(t, []string{"attrs"}, []driver.Value{stored})
+
+		var attrs RawJSON
+		assert.Nil(t, client.QueryScalar(context.Background(), "SELECT attrs FROM orders LIMIT 1", &attrs))
+		assert.Equal(t, written.Attrs, attrs)
+	})
+
+	t.Run("should return an error for values which are not base64 encoded json", func(t *testing.T) {
+		var attrs RawJSON
+		assert.NotNil(t, attrs.QDBScan("not base64"))
+		assert.NotNil(t, attrs.QDBScan("bm90IGpzb24=")) // "not json"
+		assert.NotNil(t, attrs.QDBScan(int64(1)))
+	})
+}
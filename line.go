@@ -0,0 +1,301 @@
+package questdb
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// LineMarshaler is the interface implemented by types which marshal themselves into a
+// complete Influx Line Protocol message (including the trailing newline). Client's Write
+// methods write a LineMarshaler's line as is, instead of building a Model from qdb tags, which
+// allows writing records which cannot be expressed as qdb tagged structs.
+type LineMarshaler interface {
+	MarshalLine() ([]byte, error)
+}
+
+// Line struct represents a single Influx Line Protocol message built by hand rather than
+// from a qdb tagged struct. It is made up of a table name, a set of symbols, a set of
+// columns and an optional designated timestamp:
+//
+//	<table name>,<symbols,...> <columns,...> <timestamp>
+type Line struct {
+	tableName string
+	symbols   []lineEntry
+	columns   []lineColumn
+	timestamp time.Time
+	// format holds the ILP dialect the Line is written in
+	format lineFormat
+}
+
+// lineColumn struct is a column of a Line. Values of the types which take a type suffix are kept
+// so they can be serialized again in the format the Line is written in.
+type lineColumn struct {
+	name            string
+	qdbType         QuestDBType
+	value           interface{}
+	valueSerialized string
+}
+
+// suffixedTypes are the QuestDBTypes whose serialized values end in a type suffix
+var suffixedTypes = map[QuestDBType]bool{
+	Byte:      true,
+	Short:     true,
+	Int:       true,
+	Long:      true,
+	Date:      true,
+	Timestamp: true,
+}
+
+// serializedIn func returns the value of the column serialized in format
+func (c lineColumn) serializedIn(format lineFormat) string {
+	if !suffixedTypes[c.qdbType] {
+		return c.valueSerialized
+	}
+	// the value was already serialized once, so it is known to be compatible with qdbType
+	valStr, err := serializeValue(c.value, c.qdbType, format)
+	if err != nil {
+		return c.valueSerialized
+	}
+	return valStr
+}
+
+// lineEntry struct is a single name=value pair of a Line whose value is already serialized
+type lineEntry struct {
+	name  string
+	value string
+}
+
+// NewLine func returns a *Line which will be written to the table tableName
+func NewLine(tableName string) *Line {
+	return &Line{
+		tableName: tableName,
+	}
+}
+
+// AddSymbol func adds a symbol with name and value to the Line
+func (l *Line) AddSymbol(name, value string) {
+	l.symbols = append(l.symbols, lineEntry{
+		name:  name,
+		value: quoteEscape(value, needsEscapeForSymbol, quoteSymbolFn),
+	})
+}
+
+// AddColumn func serializes value according to qdbType and adds it as a column with name
+// to the Line. It returns an error if value cannot be serialized as qdbType.
+func (l *Line) AddColumn(name string, qdbType QuestDBType, value interface{}) error {
+	if qdbType == Symbol {
+		return fmt.Errorf("%s: use AddSymbol to add symbol values", name)
+	}
+	valStr, err := serializeValue(value, qdbType, l.format)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	column := lineColumn{name: name, qdbType: qdbType, valueSerialized: valStr}
+	if suffixedTypes[qdbType] {
+		column.value = value
+	}
+	l.columns = append(l.columns, column)
+	return nil
+}
+
+// SetTimestamp func sets the designated timestamp of the Line. If t is the zero time.Time,
+// no timestamp is sent and QuestDB will use the server time at ingestion.
+func (l *Line) SetTimestamp(t time.Time) {
+	l.timestamp = t
+}
+
+// SetDialect func sets the ILP dialect the Line is written in. By default a Line is written in
+// StandardILPDialect, or in the Config.ILPDialect of the Client writing it.
+func (l *Line) SetDialect(dialect ILPDialect) {
+	l.format.dialect = &dialect
+}
+
+// terminateLines func returns b, one or more ILP lines, ending with exactly one newline: one is
+// added if b lacks it and repeated trailing newlines are collapsed. QuestDB only ingests a line
+// once its newline arrives, so an unterminated message would otherwise wait for the next write.
+// An empty b, or one of only newlines, is returned empty.
+func terminateLines(b []byte) []byte {
+	trimmed := bytes.TrimRight(b, "\n")
+	if len(trimmed) == 0 {
+		return nil
+	}
+	if len(trimmed) == len(b)-1 {
+		return b
+	}
+	out := make([]byte, len(trimmed)+1)
+	copy(out, trimmed)
+	out[len(trimmed)] = '\n'
+	return out
+}
+
+// minLineTimestamp and maxLineTimestamp are the range of times which can be written as a line's
+// timestamp, which is the time's int64 count of nanoseconds since the Unix epoch
+var (
+	minLineTimestamp = time.Unix(0, math.MinInt64)
+	maxLineTimestamp = time.Unix(0, math.MaxInt64)
+)
+
+// formatLineTimestamp func returns t formatted as the timestamp ending an ILP line. It returns
+// an error if t is outside the range of nanosecond timestamps (years 1677 to 2262), which
+// time.Time's UnixNano would silently overflow.
+func formatLineTimestamp(t time.Time) (string, error) {
+	if t.Before(minLineTimestamp) || t.After(maxLineTimestamp) {
+		return "", fmt.Errorf("timestamp %s is outside the range of nanosecond timestamps", t.Format(time.RFC3339))
+	}
+	return strconv.FormatInt(t.UnixNano(), 10), nil
+}
+
+// String func returns the Line serialized into Influx Line Protocol message format, including
+// the trailing newline. A timestamp outside the range of nanosecond timestamps is left out; use
+// MarshalLine to get an error for it instead.
+func (l *Line) String() string {
+	line, _ := l.marshalLine()
+	return line
+}
+
+// marshalLine func is like String but also returns an error if the Line's timestamp cannot be
+// written
+func (l *Line) marshalLine() (string, error) {
+	b, err := l.appendTo(nil, l.format)
+	return string(b), err
+}
+
+// appendTo func appends the Line to b in format, leaving out a timestamp which cannot be written
+// and returning its error
+func (l *Line) appendTo(b []byte, format lineFormat) ([]byte, error) {
+	symbols := make([]lineEntry, len(l.symbols))
+	for i, symbol := range l.symbols {
+		symbols[i] = lineEntry{name: quoteEscape(symbol.name, needsEscapeForSymbol, quoteSymbolFn), value: symbol.value}
+	}
+	columns := make([]lineEntry, len(l.columns))
+	for i, column := range l.columns {
+		columns[i] = lineEntry{name: quoteEscape(column.name, needsEscapeForSymbol, quoteSymbolFn), value: column.serializedIn(format)}
+	}
+
+	var ts string
+	var err error
+	if !l.timestamp.IsZero() {
+		ts, err = formatLineTimestamp(l.timestamp)
+	}
+
+	tableName := quoteEscape(l.tableName, needsEscapeForSymbol, quoteSymbolFn)
+	return format.ilpDialect().appendLine(b, tableName, symbols, columns, ts), err
+}
+
+// MarshalLine func implements LineMarshaler so a *Line can be passed to Client's Write methods
+func (l *Line) MarshalLine() ([]byte, error) {
+	line, err := l.marshalLine()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(line), nil
+}
+
+// MapRecord struct is a LineMarshaler for dynamic records held in maps rather than qdb tagged
+// structs. The QuestDB type of each column is inferred from its Go value:
+//
+//	bool                                           boolean
+//	int, int8, int16, int32, int64                 long
+//	uint8, uint16, uint32                          long
+//	float32                                        float
+//	float64                                        double
+//	string                                         string
+//	time.Time                                      timestamp
+//	[]byte, Bytes                                  binary
+//
+// nil column values are omitted. Symbols and columns are written sorted by name so the same
+// record always marshals to the same line.
+type MapRecord struct {
+	Table   string
+	Symbols map[string]string
+	Columns map[string]interface{}
+	// Timestamp is the designated timestamp of the record. If zero, QuestDB will use the server
+	// time at ingestion.
+	Timestamp time.Time
+}
+
+// inferQuestDBType func returns the QuestDBType a MapRecord column value v is written as
+func inferQuestDBType(v interface{}) (QuestDBType, error) {
+	switch v.(type) {
+	case bool:
+		return Boolean, nil
+	case int, int8, int16, int32, int64, uint8, uint16, uint32:
+		return Long, nil
+	case float32:
+		return Float, nil
+	case float64:
+		return Double, nil
+	case string:
+		return String, nil
+	case time.Time:
+		return Timestamp, nil
+	case []byte, Bytes:
+		return Binary, nil
+	}
+	return "", fmt.Errorf("cannot infer questdb type of %T", v)
+}
+
+// sortedKeys func returns the keys of m in ascending order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MarshalLine func implements LineMarshaler. It returns an error if the record has no table
+// name or a column value is of a type which cannot be inferred.
+func (r MapRecord) MarshalLine() ([]byte, error) {
+	if r.Table == "" {
+		return nil, fmt.Errorf("map record has no table name")
+	}
+
+	l := NewLine(r.Table)
+
+	symbolNames := make([]string, 0, len(r.Symbols))
+	for name := range r.Symbols {
+		symbolNames = append(symbolNames, name)
+	}
+	sort.Strings(symbolNames)
+	for _, name := range symbolNames {
+		l.AddSymbol(name, r.Symbols[name])
+	}
+
+	for _, name := range sortedKeys(r.Columns) {
+		v := r.Columns[name]
+		if v == nil {
+			continue
+		}
+		qdbType, err := inferQuestDBType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if err := l.AddColumn(name, qdbType, v); err != nil {
+			return nil, err
+		}
+	}
+
+	l.SetTimestamp(r.Timestamp)
+
+	return l.MarshalLine()
+}
+
+// lineTableName func returns the (escaped) table name of the ILP line, which ends at the first
+// unescaped comma or space
+func lineTableName(line []byte) string {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case ',', ' ', '\n':
+			return string(line[:i])
+		}
+	}
+	return string(line)
+}
@@ -0,0 +1,119 @@
+package questdb
+
+import "context"
+
+// LineBuffer struct accumulates ILP lines in a single byte buffer which is kept across batches,
+// for high throughput loops which would otherwise allocate a buffer per WriteBatch. Lines are
+// marshaled with the config of the Client which made the LineBuffer, exactly as its Write methods
+// marshal them, and the buffered lines are written with Client.WriteLineBuffer:
+//
+//	buf := client.NewLineBuffer()
+//	for batch := range batches {
+//		buf.Reset()
+//		for _, row := range batch {
+//			if err := buf.AppendStruct(row); err != nil {
+//				return err
+//			}
+//		}
+//		if err := client.WriteLineBuffer(buf); err != nil {
+//			return err
+//		}
+//	}
+//
+// A LineBuffer is not safe for concurrent use.
+type LineBuffer struct {
+	client  *Client
+	options []option
+	buf     []byte
+	// lines is the number of buffered lines and tables the tables they are written to
+	lines  int
+	tables []string
+}
+
+// NewLineBuffer func returns an empty *LineBuffer which marshals the structs appended to it with
+// the Client's config and options
+func (c *Client) NewLineBuffer(options ...option) *LineBuffer {
+	return &LineBuffer{
+		client:  c,
+		options: options,
+	}
+}
+
+// AppendStruct func appends the ILP line of v, a valid struct with qdb tags or a LineMarshaler,
+// to the LineBuffer. It returns the errors Client.Write would, in which case nothing is appended.
+func (b *LineBuffer) AppendStruct(v interface{}) error {
+	if lm, ok := v.(LineMarshaler); ok {
+		table, line, lines, err := b.client.marshalRow(lm, nil)
+		if err != nil {
+			return err
+		}
+		b.buf = append(b.buf, line...)
+		b.lines += lines
+		b.tables = append(b.tables, table)
+		return nil
+	}
+
+	m, err := b.client.newModel(v, b.options)
+	if err != nil {
+		return err
+	}
+	var lines int
+	b.buf, lines, err = b.client.appendLines(b.buf, m)
+	if err != nil {
+		return err
+	}
+	b.lines += lines
+	b.tables = append(b.tables, m.tableName)
+	return nil
+}
+
+// AppendLine func appends l to the LineBuffer. It returns the errors Client.WriteLine would, in
+// which case nothing is appended.
+func (b *LineBuffer) AppendLine(l *Line) error {
+	buf, err := b.client.appendLine(b.buf, l)
+	if err != nil {
+		return err
+	}
+	b.buf = buf
+	b.lines++
+	b.tables = append(b.tables, l.tableName)
+	return nil
+}
+
+// Reset func empties the LineBuffer, keeping its buffer for the next lines
+func (b *LineBuffer) Reset() {
+	b.buf = b.buf[:0]
+	b.lines = 0
+	b.tables = b.tables[:0]
+}
+
+// Bytes func returns the buffered lines. The slice is only valid until the LineBuffer is next
+// appended to or reset.
+func (b *LineBuffer) Bytes() []byte {
+	return b.buf
+}
+
+// Lines func returns the number of buffered lines
+func (b *LineBuffer) Lines() int {
+	return b.lines
+}
+
+// Len func returns the length in bytes of the buffered lines
+func (b *LineBuffer) Len() int {
+	return len(b.buf)
+}
+
+// WriteLineBuffer func writes the lines buffered in b to the underlying InfluxDB line protocol in
+// a single write. Unlike WriteMessage it writes them as they are, so they may hold double arrays.
+// An empty b is not written.
+func (c *Client) WriteLineBuffer(b *LineBuffer) error {
+	return c.WriteLineBufferContext(context.Background(), b)
+}
+
+// WriteLineBufferContext func is like WriteLineBuffer but takes a ctx which bounds the write
+func (c *Client) WriteLineBufferContext(ctx context.Context, b *LineBuffer) error {
+	if b.lines == 0 {
+		return nil
+	}
+	return c.traceWrite(ctx, "questdb.WriteLineBuffer", b.tables, b.buf, b.lines)
+}
@@ -0,0 +1,60 @@
+package questdb
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineBuffer(t *testing.T) {
+	t.Run("should buffer structs, LineMarshalers and Lines for WriteMessage", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		buf := client.NewLineBuffer()
+		assert.Nil(t, buf.AppendStruct(testRow{Name: "a", Value: 1}))
+		assert.Nil(t, buf.AppendStruct(MapRecord{Table: "maps", Symbols: map[string]string{"k": "v"}}))
+		l := NewLine("lines")
+		l.AddSymbol("s", "x")
+		l.SetTimestamp(time.Unix(1, 0))
+		assert.Nil(t, buf.AppendLine(l))
+		assert.Nil(t, client.WriteMessage(buf.Bytes()))
+
+		expected := "test_rows,name=a value=1i\nmaps,k=v\nlines,s=x 1000000000\n"
+		assert.Equal(t, expected, server.waitFor(len(expected)))
+	})
+
+	t.Run("should reuse its buffer once reset", func(t *testing.T) {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+
+		buf := client.NewLineBuffer(WithTableName("rows"))
+		assert.Nil(t, buf.AppendStruct(testRow{Name: "a", Value: 1}))
+		assert.Equal(t, "rows,name=a value=1i\n", string(buf.Bytes()))
+		allocated := cap(buf.Bytes())
+
+		buf.Reset()
+		assert.Equal(t, 0, buf.Len())
+		assert.Nil(t, buf.AppendStruct(testRow{Name: "b", Value: 2}))
+		assert.Equal(t, "rows,name=b value=2i\n", string(buf.Bytes()))
+		assert.Equal(t, allocated, cap(buf.Bytes()))
+	})
+
+	t.Run("should append nothing for rows Write would reject", func(t *testing.T) {
+		client, err := New(Config{MaxLineBytes: 30})
+		assert.Nil(t, err)
+
+		buf := client.NewLineBuffer()
+		assert.Nil(t, buf.AppendStruct(testRow{Name: "a", Value: 1}))
+		assert.True(t, errors.Is(buf.AppendStruct(testRow{Name: "a long symbol value", Value: 1}), ErrILPLineTooLong))
+		assert.True(t, errors.Is(buf.AppendStruct(testRow{}), ErrNoFieldsToWrite))
+		assert.NotNil(t, buf.AppendStruct("not a struct"))
+		l := NewLine("a_long_table_name")
+		l.AddSymbol("symbol", "a long symbol value")
+		assert.True(t, errors.Is(buf.AppendLine(l), ErrILPLineTooLong))
+
+		assert.Equal(t, "test_rows,name=a value=1i\n", string(buf.Bytes()))
+	})
+}
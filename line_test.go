@@ -0,0 +1,105 @@
+package questdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLine_String(t *testing.T) {
+	t.Run("should serialize symbols, columns and timestamp", func(t *testing.T) {
+		ts := time.Unix(0, 1645660800000000000)
+
+		l := NewLine("trades")
+		l.AddSymbol("pair", "BTC-USD")
+		l.AddSymbol("venue", "big exchange")
+		assert.Nil(t, l.AddColumn("amount", Long, int64(3)))
+		assert.Nil(t, l.AddColumn("note", String, `say "hi"`))
+		l.SetTimestamp(ts)
+
+		expected := "trades,pair=BTC-USD,venue=big\\ exchange amount=3i,note=\"say \\\"hi\\\"\" 1645660800000000000\n"
+		assert.Equal(t, expected, l.String())
+	})
+
+	t.Run("should omit columns and timestamp when not set", func(t *testing.T) {
+		l := NewLine("trades")
+		l.AddSymbol("pair", "BTC-USD")
+
+		assert.Equal(t, "trades,pair=BTC-USD\n", l.String())
+	})
+
+	t.Run("should return an error for values incompatible with the column type", func(t *testing.T) {
+		l := NewLine("trades")
+
+		err := l.AddColumn("amount", Long, "not a number")
+		assert.NotNil(t, err)
+
+		err = l.AddColumn("pair", Symbol, "BTC-USD")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("should write the separators and suffixes of the Line's dialect", func(t *testing.T) {
+		l := NewLine("trades")
+		l.SetDialect(ILPDialect{SymbolSeparator: ";", FieldSeparator: "\t", ColumnSeparator: "&", IntSuffix: "L"})
+		l.AddSymbol("pair", "BTC-USD")
+		l.AddSymbol("venue", "x")
+		assert.Nil(t, l.AddColumn("amount", Long, int64(3)))
+		assert.Nil(t, l.AddColumn("price", Double, 1.5))
+		l.SetTimestamp(time.Unix(1, 0))
+
+		assert.Equal(t, "trades;pair=BTC-USD;venue=x\tamount=3L&price=1.5\t1000000000\n", l.String())
+	})
+
+	t.Run("should write the suffixes of a dialect set after the columns were added", func(t *testing.T) {
+		l := NewLine("trades")
+		assert.Nil(t, l.AddColumn("amount", Long, int64(3)))
+		assert.Nil(t, l.AddColumn("price", Double, 1.5))
+		l.SetDialect(LegacyILPDialect)
+
+		assert.Equal(t, "trades amount=3,price=1.5\n", l.String())
+	})
+}
+
+func TestMapRecord_MarshalLine(t *testing.T) {
+	t.Run("should marshal symbols and columns sorted by name", func(t *testing.T) {
+		r := MapRecord{
+			Table:   "events",
+			Symbols: map[string]string{"source": "api", "kind": "click"},
+			Columns: map[string]interface{}{
+				"user":    "bob",
+				"count":   3,
+				"score":   0.5,
+				"ok":      true,
+				"missing": nil,
+			},
+			Timestamp: time.Unix(1, 0),
+		}
+
+		line, err := r.MarshalLine()
+		assert.Nil(t, err)
+		assert.Equal(t, "events,kind=click,source=api count=3i,ok=true,score=0.5,user=\"bob\" 1000000000\n", string(line))
+	})
+
+	t.Run("should return an error for columns of unknown type", func(t *testing.T) {
+		_, err := MapRecord{Table: "events", Columns: map[string]interface{}{"tags": []string{"a"}}}.MarshalLine()
+		assert.NotNil(t, err)
+
+		_, err = MapRecord{Columns: map[string]interface{}{"count": 1}}.MarshalLine()
+		assert.NotNil(t, err)
+	})
+}
+
+func TestLine_TimestampRange(t *testing.T) {
+	l := NewLine("trades")
+	assert.Nil(t, l.AddColumn("price", Double, 1.0))
+
+	l.SetTimestamp(time.Date(1950, 1, 1, 0, 0, 0, 0, time.UTC))
+	line, err := l.MarshalLine()
+	assert.Nil(t, err)
+	assert.Equal(t, "trades price=1 -631152000000000000\n", string(line))
+
+	l.SetTimestamp(time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC))
+	_, err = l.MarshalLine()
+	assert.NotNil(t, err)
+}
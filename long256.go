@@ -0,0 +1,100 @@
+package questdb
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Long256Value is a 256-bit unsigned integer, the Go representation of the QuestDB long256
+// type, stored as 32 big-endian bytes. QuestDB returns long256 values over the Postgres Wire
+// Protocol in their hex form (i.e. "0x1f"), which Long256Value scans from and writes as.
+type Long256Value [32]byte
+
+// ParseLong256 func parses s, a "0x" prefixed hex string of at most 64 digits, into a
+// Long256Value
+func ParseLong256(s string) (Long256Value, error) {
+	var l Long256Value
+	if !strings.HasPrefix(s, "0x") && !strings.HasPrefix(s, "0X") {
+		return l, fmt.Errorf("long256 '%s' must start with 0x", s)
+	}
+	digits := s[2:]
+	if len(digits) == 0 || len(digits) > 64 {
+		return l, fmt.Errorf("long256 '%s' must have between 1 and 64 hex digits", s)
+	}
+	// left pad to the full 64 digits so each byte decodes into its place
+	by, err := hex.DecodeString(strings.Repeat("0", 64-len(digits)) + digits)
+	if err != nil {
+		return l, fmt.Errorf("could not hex decode long256 '%s': %w", s, err)
+	}
+	copy(l[:], by)
+	return l, nil
+}
+
+// Long256FromBigInt func returns i as a Long256Value. It returns an error if i is negative or
+// does not fit in 256 bits.
+func Long256FromBigInt(i *big.Int) (Long256Value, error) {
+	var l Long256Value
+	if i.Sign() < 0 || i.BitLen() > 256 {
+		return l, fmt.Errorf("%s does not fit in long256", i)
+	}
+	i.FillBytes(l[:])
+	return l, nil
+}
+
+// BigInt func returns l as a *big.Int
+func (l Long256Value) BigInt() *big.Int {
+	return new(big.Int).SetBytes(l[:])
+}
+
+// String func returns l in its "0x" prefixed hex form without leading zeros
+func (l Long256Value) String() string {
+	s := strings.TrimLeft(hex.EncodeToString(l[:]), "0")
+	if s == "" {
+		s = "0"
+	}
+	return "0x" + s
+}
+
+// Value func implements the driver.Valuer interface
+func (l Long256Value) Value() (driver.Value, error) {
+	return l.String(), nil
+}
+
+// QDBValue func implements the QDBValuer interface
+func (l Long256Value) QDBValue() Value {
+	return l.String()
+}
+
+// Scan func implements the sql.Scanner interface. The driver returns long256 values as their
+// hex form, as either a string or a []byte.
+func (l *Long256Value) Scan(src interface{}) error {
+	switch val := src.(type) {
+	case nil:
+		*l = Long256Value{}
+		return nil
+	case string:
+		parsed, err := ParseLong256(val)
+		if err != nil {
+			return err
+		}
+		*l = parsed
+		return nil
+	case []byte:
+		parsed, err := ParseLong256(string(val))
+		if err != nil {
+			return err
+		}
+		*l = parsed
+		return nil
+	default:
+		return fmt.Errorf("%T cannot be scanned into Long256Value", val)
+	}
+}
+
+// QDBScan func implements the Scanner interface
+func (l *Long256Value) QDBScan(src interface{}) error {
+	return l.Scan(src)
+}
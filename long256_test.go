@@ -0,0 +1,64 @@
+package questdb
+
+import (
+	"database/sql/driver"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLong256Value(t *testing.T) {
+	t.Run("should parse and format the hex form", func(t *testing.T) {
+		l, err := ParseLong256("0x01ff")
+		assert.Nil(t, err)
+		assert.Equal(t, "0x1ff", l.String())
+		assert.Equal(t, int64(511), l.BigInt().Int64())
+
+		assert.Equal(t, "0x0", Long256Value{}.String())
+	})
+
+	t.Run("should return an error for invalid hex forms", func(t *testing.T) {
+		for _, s := range []string{"1ff", "0x", "0xzz", "0x" + strings.Repeat("f", 65)} {
+			_, err := ParseLong256(s)
+			assert.NotNil(t, err, s)
+		}
+	})
+
+	t.Run("should only convert big ints which fit", func(t *testing.T) {
+		max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+		l, err := Long256FromBigInt(max)
+		assert.Nil(t, err)
+		assert.Equal(t, "0x"+strings.Repeat("f", 64), l.String())
+
+		_, err = Long256FromBigInt(new(big.Int).Add(max, big.NewInt(1)))
+		assert.NotNil(t, err)
+
+		_, err = Long256FromBigInt(big.NewInt(-1))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("should round trip a 256-bit value through ingestion and scanning", func(t *testing.T) {
+		type hash struct {
+			Name  string       `qdb:"name;symbol"`
+			Value Long256Value `qdb:"value;long256"`
+		}
+
+		written, err := ParseLong256("0x" + strings.Repeat("0123456789abcdef", 4))
+		assert.Nil(t, err)
+
+		m, err := NewModel(&hash{Name: "a", Value: written})
+		assert.Nil(t, err)
+		line := string(m.MarshalLine())
+		assert.Equal(t, "hashs,name=a value="+written.String()+"i\n", line)
+
+		// QuestDB returns the value as the hex written without the 'i' suffix
+		hexForm := strings.TrimSuffix(strings.TrimPrefix(line, "hashs,name=a value="), "i\n")
+		db := newTestDB(t, []string{"name", "value"}, []driver.Value{"a", hexForm})
+
+		read := &hash{}
+		assert.Nil(t, ScanInto(db.QueryRow("SELECT name, value FROM hashs"), read))
+		assert.Equal(t, written, read.Value)
+	})
+}
@@ -1,12 +1,18 @@
 package questdb
 
 import (
+	"bytes"
 	"database/sql"
+	"errors"
 	"fmt"
 	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Model represents a struct's model
@@ -18,18 +24,293 @@ type Model struct {
 	val                reflect.Value
 	designatedTS       *field
 	createTableOptions *CreateTableOptions
+	// timestamp overrides the designated timestamp value emitted by MarshalLine when set
+	timestamp time.Time
+	// format controls how field values are serialized by MarshalLine
+	format lineFormat
+	// typeMapper maps field types to the column types of the create table statement
+	typeMapper TypeMapper
+	// stampNowIfZero makes MarshalLine emit the current time when there is no designated
+	// timestamp value
+	stampNowIfZero bool
+	// clock, if set, returns the current time wherever the Model stamps one. Defaults to
+	// time.Now.
+	clock func() time.Time
+	// columnFilter, if set, holds the only columns MarshalLine emits (besides the designated
+	// timestamp)
+	columnFilter map[string]struct{}
+	// defaultSymbols are symbols written with every line, set by the DefaultSymboler interface
+	defaultSymbols map[string]string
+	// fieldFilter, if set, decides which fields MarshalLine emits (besides the designated
+	// timestamp)
+	fieldFilter func(FieldInfo) bool
+	// sortedColumns makes MarshalLine write symbols and columns in alphabetical order
+	sortedColumns bool
+	// commitZeroValues makes MarshalLine write the zero values of all fields, as if they were all
+	// tagged 'commitZeroValue:true'
+	commitZeroValues bool
+	// ignoreUnknownColumns makes ScanRows and ScanAll scan columns into fields by name, ignoring
+	// columns without a field
+	ignoreUnknownColumns bool
+	// scanByName makes ScanRows and ScanAll scan columns into fields by name even when there are
+	// as many columns as fields
+	scanByName bool
+	// shardBase, if set, is the base name of the time sharded tables the Model's rows are
+	// written to, by the time of shardField
+	shardBase  string
+	shardField *field
+	// tableNameTransformer, if set, maps the table name as the final step of resolving it,
+	// including the name of each shard
+	tableNameTransformer func(string) string
+	// exploded is the field tagged 'explode:true', if any, and explodeIndex the index of its
+	// element being serialized
+	exploded     *field
+	explodeIndex int
 }
 
 // field struct represents a field within a valid qdb tagged struct
 type field struct {
-	isZero          bool
-	name            string
+	isZero bool
+	// isNull is set for nil pointer fields, which are never written
+	isNull bool
+	name   string
+	// index is the sequence of struct field indexes leading to the field from the model's
+	// struct, following embedded structs
+	index           []int
 	qdbName         string
 	qdbType         QuestDBType
 	typ             reflect.Type
 	value           reflect.Value
 	valueSerialized string
 	tagOptions      tagOptions
+	// validSymbols, if set, holds the only values the field may be written with, see
+	// ValidSymboler
+	validSymbols map[string]struct{}
+}
+
+// valueType func returns the type of the values f holds, which is the element type of an
+// exploded field
+func (f *field) valueType() reflect.Type {
+	if f.tagOptions.explode {
+		return f.typ.Elem()
+	}
+	return f.typ
+}
+
+// columnType func returns the QuestDBType of the column f is stored in. This is f's own
+// QuestDBType unless a tag option changes how it is stored.
+func (f *field) columnType() QuestDBType {
+	if f.tagOptions.boolAsInt {
+		return Int
+	}
+	return f.qdbType
+}
+
+// FieldInfo struct describes a field of a Model and the column it is stored in
+type FieldInfo struct {
+	// Name is the Go name of the field, prefixed with the names of the embedded structs leading
+	// to it (e.g. "Audited.CreatedAt")
+	Name string
+	// Column is the name of the field's column
+	Column string
+	// Type is the QuestDBType of the field's column
+	Type QuestDBType
+	// GoType is the Go type of the field
+	GoType reflect.Type
+	// DesignatedTS is set for the designated timestamp field
+	DesignatedTS bool
+	// Indexed is set for indexed symbol fields
+	Indexed bool
+}
+
+// Fields func returns the FieldInfo of each of the Model's fields, in struct field order
+func (m *Model) Fields() []FieldInfo {
+	infos := make([]FieldInfo, len(m.fields))
+	for i, field := range m.fields {
+		infos[i] = m.fieldInfo(field)
+	}
+	return infos
+}
+
+// fieldInfo func returns the FieldInfo of f, one of the Model's fields
+func (m *Model) fieldInfo(f *field) FieldInfo {
+	return FieldInfo{
+		Name:         f.name,
+		Column:       f.qdbName,
+		Type:         f.columnType(),
+		GoType:       f.typ,
+		DesignatedTS: f == m.designatedTS,
+		Indexed:      f.tagOptions.index,
+	}
+}
+
+// storedValue func converts v, the value of f, into the value of f's column type according to
+// f's tag options
+func (f *field) storedValue(v interface{}) (interface{}, error) {
+	// durations are sent as a count of the field's duration unit
+	if d, ok := v.(time.Duration); ok && f.tagOptions.durationUnit > 0 {
+		return int64(d / f.tagOptions.durationUnit), nil
+	}
+	// the options below convert named types as their underlying basic type
+	base := v
+	if converted, ok := underlyingValue(v); ok {
+		base = converted
+	}
+	// formatted times are parsed with the field's layout
+	if str, ok := base.(string); ok && f.tagOptions.timeFormat != "" {
+		t, err := time.Parse(f.tagOptions.timeFormat, str)
+		if err != nil {
+			return nil, fmt.Errorf("%s: could not parse '%s' with time format '%s': %w", f.name, str, f.tagOptions.timeFormat, err)
+		}
+		return t, nil
+	}
+	// epoch timestamps with a unit are sent as the time they hold
+	if n, ok := base.(int64); ok && f.tagOptions.tsUnit > 0 {
+		return epochTime(n, f.tagOptions.tsUnit), nil
+	}
+	// booleans stored as int are sent as 1 or 0
+	if b, ok := base.(bool); ok && f.tagOptions.boolAsInt {
+		if b {
+			return int32(1), nil
+		}
+		return int32(0), nil
+	}
+	return v, nil
+}
+
+// checkGoType func returns an error if the Go type of f cannot be written to its QuestDBType
+// (e.g. a string field tagged int), so the struct is rejected by NewModel rather than failing
+// every write. The zero value of the type is serialized as serialize would, which accepts or
+// rejects every value of a type alike. Interface fields are only known once set, so they are
+// not checked.
+func (f *field) checkGoType() error {
+	ty := indirectType(f.valueType())
+	if ty.Kind() == reflect.Interface || arrayDims(f.qdbType) > 0 {
+		return nil
+	}
+	v := reflect.Zero(ty).Interface()
+	if layout := f.tagOptions.timeFormat; layout != "" {
+		// the zero string is no time of the layout, it is the parsed time which is written, as long
+		// as the layout can parse the times it formats
+		if _, err := time.Parse(layout, time.Time{}.Format(layout)); err != nil {
+			return fmt.Errorf("time format '%s' cannot parse the times it formats: %w", layout, err)
+		}
+		v = time.Time{}
+	}
+	v, err := f.storedValue(v)
+	if err != nil {
+		return err
+	}
+	var incompatible *incompatibleTypeError
+	if _, err := serializeValue(v, f.columnType(), lineFormat{}); errors.As(err, &incompatible) {
+		return fmt.Errorf("go type %s is not compatible with %s", ty, f.columnType())
+	}
+	return nil
+}
+
+// validSymbolsOf func returns the set of ValidSymbols of ty if it is a ValidSymboler, by value or
+// pointer receiver, or nil if it is not. It returns an error if ty is a ValidSymboler which is not
+// string backed.
+func validSymbolsOf(ty reflect.Type) (map[string]struct{}, error) {
+	validSymboler, ok := reflect.New(ty).Interface().(ValidSymboler)
+	if !ok {
+		return nil, nil
+	}
+	if ty.Kind() != reflect.String {
+		return nil, fmt.Errorf("ValidSymbols type %s must be string backed", ty)
+	}
+	valid := map[string]struct{}{}
+	for _, symbol := range validSymboler.ValidSymbols() {
+		valid[symbol] = struct{}{}
+	}
+	return valid, nil
+}
+
+// checkValidSymbol func returns an ErrInvalidSymbol error if f only takes its valid symbols and v,
+// a value of f's string backed type, is not one of them
+func (f *field) checkValidSymbol(v reflect.Value) error {
+	if f.validSymbols == nil {
+		return nil
+	}
+	if _, ok := f.validSymbols[v.String()]; ok {
+		return nil
+	}
+	valid := make([]string, 0, len(f.validSymbols))
+	for symbol := range f.validSymbols {
+		valid = append(valid, symbol)
+	}
+	sort.Strings(valid)
+	return fmt.Errorf("%s: %w: '%s' is not one of [%s]", f.name, ErrInvalidSymbol, v.String(), strings.Join(valid, ", "))
+}
+
+// timeValue func returns the time held by f, a timestamp field of either time.Time or int64 (a
+// count of its tsUnit since the Unix epoch). ok is false if f holds neither or is nil.
+func (f *field) timeValue() (t time.Time, ok bool) {
+	v := reflect.Indirect(f.value)
+	if !v.IsValid() {
+		return time.Time{}, false
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t, true
+	}
+	if isEpochType(v.Type()) {
+		return epochTime(v.Int(), f.tagOptions.tsUnit), true
+	}
+	return time.Time{}, false
+}
+
+// formatFloat func returns the float v formatted with the field's 'floatFmt' option, and whether
+// the field has the option
+func (f *field) formatFloat(v interface{}) (string, bool) {
+	if !f.tagOptions.floatFormat {
+		return "", false
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Float32 && rv.Kind() != reflect.Float64 {
+		return "", false
+	}
+	return strconv.FormatFloat(rv.Float(), f.tagOptions.floatVerb, f.tagOptions.floatPrec, rv.Type().Bits()), true
+}
+
+// ShardedTableName func returns the name of the table of base holding the rows of t's time
+// bucket, for sharding rows across one table per bucket. Buckets are those of the partitions of
+// by, in UTC: base_2024 (Year), base_2024_01 (Month), base_2024_01_15 (Day) and base_2024_01_15_13
+// (Hour). For None, or any other value, base itself is returned.
+func ShardedTableName(base string, t time.Time, by PartitionOption) string {
+	t = t.UTC()
+	switch by {
+	case Year:
+		return fmt.Sprintf("%s_%s", base, t.Format("2006"))
+	case Month:
+		return fmt.Sprintf("%s_%s", base, t.Format("2006_01"))
+	case Day:
+		return fmt.Sprintf("%s_%s", base, t.Format("2006_01_02"))
+	case Hour:
+		return fmt.Sprintf("%s_%s", base, t.Format("2006_01_02_15"))
+	default:
+		return base
+	}
+}
+
+// applyShard func sets the Model's table name to the sharded table of its bound row, if it is
+// sharded. Rows are sharded by the partitions of the Model's CreateTableOptions, or by month if
+// it has none. A row without a time is sharded by the current time, as QuestDB stamps it.
+func (m *Model) applyShard() {
+	if m.shardBase == "" {
+		return
+	}
+	by := Month
+	if m.createTableOptions != nil && m.createTableOptions.PartitionBy != "" {
+		by = m.createTableOptions.PartitionBy
+	}
+	t, ok := m.shardField.timeValue()
+	if !ok || t.IsZero() {
+		t = m.now()
+	}
+	m.tableName = ShardedTableName(m.shardBase, t, by)
+	if m.tableNameTransformer != nil {
+		m.tableName = m.tableNameTransformer(m.tableName)
+	}
 }
 
 // PartitionOption is a string which is used in CreateTableOptions struct
@@ -48,6 +329,11 @@ const (
 // a QuestDB table
 type CreateTableOptions struct {
 	PartitionBy PartitionOption
+	// NoDesignatedTimestamp creates a plain table without a designated timestamp: the default
+	// "timestamp" column is not added and the timestamp(...) clause is omitted, leaving a
+	// designated timestamp field as an ordinary timestamp column. QuestDB only partitions tables
+	// with a designated timestamp, so PartitionBy must be empty or None with it.
+	NoDesignatedTimestamp bool
 	// Deprecated: QuestDB >= v7.0.0 no longer requires this option
 	MaxUncommittedRows int
 	// Deprecated: QuestDB >= v7.0.0 no longer requires this option
@@ -83,6 +369,23 @@ type CreateTableOptioner interface {
 	CreateTableOptions() CreateTableOptions
 }
 
+// DefaultSymboler is an interface which has a single method DefaultSymbols which returns
+// symbols (column name to value) written with every line of the struct, in addition to
+// its symbol fields. This keeps constant metadata, such as a service name or environment,
+// out of the struct's fields. The symbols are also declared as symbol columns by the create
+// table statement.
+type DefaultSymboler interface {
+	DefaultSymbols() map[string]string
+}
+
+// ValidSymboler is an interface which has a single method ValidSymbols which returns the values
+// a string backed enum type (e.g. `type Status string`) may take. Writing a field of such a type
+// with any other value fails with ErrInvalidSymbol, which keeps typos from adding symbols to the
+// column. ValidSymbols is called once per Model, on the zero value of the type.
+type ValidSymboler interface {
+	ValidSymbols() []string
+}
+
 // NewModel func takes a struct and returns the Model representation of
 // that struct or an optional error
 func NewModel(a interface{}) (*Model, error) {
@@ -101,7 +404,7 @@ func NewModel(a interface{}) (*Model, error) {
 
 	aTableNamer, ok := a.(TableNamer)
 	if ok {
-		tableName = aTableNamer.TableName()
+		tableName = unquoteIdentifier(aTableNamer.TableName())
 	}
 
 	m := &Model{
@@ -116,26 +419,34 @@ func NewModel(a interface{}) (*Model, error) {
 		m.createTableOptions = &opts
 	}
 
-	fields, err := structToFieldSlice("", "", ty, val)
+	aDefaultSymboler, ok := a.(DefaultSymboler)
+	if ok {
+		m.defaultSymbols = aDefaultSymboler.DefaultSymbols()
+	}
+
+	fields, err := structToFieldSlice("", "", nil, ty, val)
 	if err != nil {
 		return nil, fmt.Errorf("could not parse field: %w", err)
 	}
 
 	for _, field := range fields {
-		if field.tagOptions.designatedTS {
-			if m.designatedTS != nil {
-				return nil, fmt.Errorf("multiple designated timestamp fields found")
-			}
-			field2 := field
-			m.designatedTS = field2
+		if field.tagOptions.designatedTS && m.designatedTS == nil {
+			m.designatedTS = field
 		}
 		if field.tagOptions.index {
 			m.indexFields = append(m.indexFields, field)
 		}
+		if field.tagOptions.explode && m.exploded == nil {
+			m.exploded = field
+		}
 	}
 
 	m.fields = fields
 
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
 	if err := m.serialize(); err != nil {
 		return nil, err
 	}
@@ -143,7 +454,90 @@ func NewModel(a interface{}) (*Model, error) {
 	return m, nil
 }
 
-func structToFieldSlice(fieldPrefix, colPrefix string, ty reflect.Type, val reflect.Value) ([]*field, error) {
+// Validate func checks the Model for problems which would produce an invalid create table
+// statement or ILP message and returns an error listing all of them. It checks that:
+//
+//   - at most one field is the designated timestamp
+//   - the designated timestamp field is of timestamp type
+//   - no two fields map to the same column name, including fields of embedded structs
+//   - no default symbol (see DefaultSymboler) has the column name of a field
+//   - at most one field is exploded
+//   - a table created without a designated timestamp is not partitioned
+//
+// Validate is called by NewModel.
+func (m *Model) Validate() error {
+	errs := []error{}
+
+	designatedTSFields := 0
+	explodedFields := 0
+	columns := map[string]*field{}
+	for _, field := range m.fields {
+		if field.tagOptions.explode {
+			explodedFields++
+		}
+		if field.tagOptions.designatedTS {
+			designatedTSFields++
+			if field.qdbType != Timestamp {
+				errs = append(errs, fmt.Errorf("%s: designated timestamp must be of type %s not %s", field.name, Timestamp, field.qdbType))
+			}
+		}
+
+		// embedded structs prefix their column names, so two differently named Go fields can
+		// still collide on the same column
+		if other, ok := columns[field.qdbName]; ok {
+			errs = append(errs, fmt.Errorf("column '%s' is mapped by both %s and %s", field.qdbName, other.name, field.name))
+			continue
+		}
+		columns[field.qdbName] = field
+	}
+
+	if designatedTSFields > 1 {
+		errs = append(errs, fmt.Errorf("multiple designated timestamp fields found"))
+	}
+
+	if explodedFields > 1 {
+		errs = append(errs, fmt.Errorf("multiple exploded fields found"))
+	}
+
+	if m.noDesignatedTimestamp() && m.createTableOptions.PartitionBy != "" && m.createTableOptions.PartitionBy != None {
+		errs = append(errs, fmt.Errorf("tables without a designated timestamp cannot be partitioned by %s", m.createTableOptions.PartitionBy))
+	}
+
+	errs = append(errs, m.symbolPlacementErrors()...)
+
+	for _, name := range m.defaultSymbolNames() {
+		if other, ok := columns[name]; ok {
+			errs = append(errs, fmt.Errorf("column '%s' is mapped by both %s and a default symbol", name, other.name))
+		}
+	}
+
+	return joinErrors(errs)
+}
+
+// symbolPlacementErrors func returns an error for each column whose create table type disagrees
+// with how its ILP line writes it: symbols are written in the line's symbol set and must be
+// declared symbol, any other column is written in the field set and must not be. QuestDB rejects
+// a symbol written to a string column and vice versa, so the two are not interchangeable. Only a
+// TypeMapper mapping to or from symbol can cause such a mismatch.
+func (m *Model) symbolPlacementErrors() []error {
+	typeMapper := m.typeMapper
+	if typeMapper == nil {
+		typeMapper = DefaultTypeMapper
+	}
+	errs := []error{}
+	for _, field := range m.fields {
+		ddlType := typeMapper(field.columnType())
+		if (field.qdbType == Symbol) != (ddlType == Symbol) {
+			errs = append(errs, fmt.Errorf("%s: %s column '%s' is declared %s by the type mapper", field.name, field.columnType(), field.qdbName, ddlType))
+		}
+	}
+	if len(m.defaultSymbols) > 0 && typeMapper(Symbol) != Symbol {
+		errs = append(errs, fmt.Errorf("default symbols are declared %s by the type mapper", typeMapper(Symbol)))
+	}
+	return errs
+}
+
+func structToFieldSlice(fieldPrefix, colPrefix string, index []int, ty reflect.Type, val reflect.Value) ([]*field, error) {
 	if ty.Kind() == reflect.Ptr {
 		ty = ty.Elem()
 	}
@@ -161,12 +555,27 @@ func structToFieldSlice(fieldPrefix, colPrefix string, ty reflect.Type, val refl
 		}
 
 		fieldName := fieldPrefix + fieldType.Name
+		fieldIndex := append(append([]int{}, index...), i)
 
 		tagStr := fieldType.Tag.Get(tagName)
 		// skip fields that are marked to ignore
 		if tagStr == "-" {
 			continue
 		}
+
+		// promote the qdb tagged fields of untagged anonymous (Go embedded) structs, the same
+		// way encoding/json treats embedding
+		if fieldType.Anonymous && tagStr == "" && indirectType(fieldType.Type).Kind() == reflect.Struct {
+			if !fieldType.IsExported() {
+				return nil, fmt.Errorf("%s: embedded struct type must be exported", fieldName)
+			}
+			embeddedFields, err := structToFieldSlice(fieldName+".", colPrefix, fieldIndex, fieldType.Type, fieldValue)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, embeddedFields...)
+			continue
+		}
 		tagProps := strings.Split(tagStr, ";")
 
 		if len(tagProps) < 2 {
@@ -178,6 +587,7 @@ func structToFieldSlice(fieldPrefix, colPrefix string, ty reflect.Type, val refl
 
 		f := &field{
 			name:            fieldName,
+			index:           fieldIndex,
 			qdbName:         columnName,
 			qdbType:         QuestDBType(columnType),
 			typ:             fieldType.Type,
@@ -201,12 +611,16 @@ func structToFieldSlice(fieldPrefix, colPrefix string, ty reflect.Type, val refl
 			return nil, fmt.Errorf("%s: unsupported qdb type %s", fieldName, f.qdbType)
 		}
 
+		if dims := arrayDims(f.qdbType); dims > 0 && !isDoubleArrayType(f.valueType(), dims) {
+			return nil, fmt.Errorf("%s: %s fields must be %d dimensional slices of float64 or float32, got %s", fieldName, f.qdbType, dims, f.valueType())
+		}
+
 		if columnType == "embedded" && f.tagOptions.embeddedPrefix == "" {
 			return nil, fmt.Errorf("%s: 'embeddedPrefix' is required if type is embedded", fieldName)
 		}
 
 		if columnType == "embedded" {
-			embeddedFields, err := structToFieldSlice(f.name+".", f.tagOptions.embeddedPrefix, f.typ, f.value)
+			embeddedFields, err := structToFieldSlice(f.name+".", f.tagOptions.embeddedPrefix, f.index, f.typ, f.value)
 			if err != nil {
 				return nil, err
 			}
@@ -214,30 +628,138 @@ func structToFieldSlice(fieldPrefix, colPrefix string, ty reflect.Type, val refl
 			continue
 		}
 
+		if err := f.checkGoType(); err != nil {
+			return nil, fmt.Errorf("%s: %w", fieldName, err)
+		}
+
+		validSymbols, err := validSymbolsOf(indirectType(f.valueType()))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fieldName, err)
+		}
+		f.validSymbols = validSymbols
+
 		fields = append(fields, f)
 	}
 
 	return fields, nil
 }
 
+// fieldByIndex func returns the field of the struct val reached by following index through
+// any embedded structs, or the zero reflect.Value if a nil embedded pointer is in the way.
+func fieldByIndex(val reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		if val.Kind() == reflect.Ptr {
+			val = val.Elem()
+		}
+		if !val.IsValid() {
+			return reflect.Value{}
+		}
+		val = val.Field(i)
+	}
+	return val
+}
+
+// allocFieldByIndex func is like fieldByIndex but allocates the nil embedded struct pointers in
+// the way to the field, so the field can be scanned into. It returns the zero reflect.Value if a
+// nil pointer cannot be set.
+func allocFieldByIndex(val reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		if val.Kind() == reflect.Ptr {
+			if val.IsNil() {
+				if !val.CanSet() {
+					return reflect.Value{}
+				}
+				val.Set(reflect.New(val.Type().Elem()))
+			}
+			val = val.Elem()
+		}
+		val = val.Field(i)
+	}
+	return val
+}
+
+// Bind func rebinds the Model to a, which must be a struct (or pointer to struct) of the same
+// type the Model was made from, and re-serializes its values. This allows a single Model to be
+// reused for many values of the same type instead of calling NewModel for each. The Model's
+// table name, options and any timestamp set with SetTimestamp are kept, though a WithShardedTable
+// Model moves to the shard of a's timestamp.
+func (m *Model) Bind(a interface{}) error {
+	ty := reflect.TypeOf(a)
+	val := reflect.ValueOf(a)
+
+	if ty != nil && ty.Kind() == reflect.Ptr {
+		ty = ty.Elem()
+	}
+
+	if ty != m.typ {
+		return fmt.Errorf("cannot bind %v to model of type %v", reflect.TypeOf(a), m.typ)
+	}
+
+	m.bind(val)
+
+	return m.serialize()
+}
+
+// bind func points the Model's fields at the fields of val, which must be of the Model's type,
+// and moves a sharded Model to the shard of val
+func (m *Model) bind(val reflect.Value) {
+	m.val = val
+	for _, field := range m.fields {
+		field.value = fieldByIndex(val, field.index)
+	}
+	m.applyShard()
+}
+
 func (m *Model) serialize() error {
 	for _, field := range m.fields {
 
 		fieldValue := field.value
+		if field == m.exploded {
+			fieldValue = explodedElement(fieldValue, m.explodeIndex)
+		}
 		// if fieldValue kind is pointer, get its underlying poited to value
 		if fieldValue.Kind() == reflect.Ptr {
 			fieldValue = fieldValue.Elem()
 		}
 
-		if !fieldValue.IsValid() || fieldValue.IsZero() {
-			field.isZero = true
+		field.isNull = !fieldValue.IsValid()
+		field.isZero = field.isNull || fieldValue.IsZero()
+		field.valueSerialized = ""
+
+		// an empty symbol is written rather than omitted (null) if set to be
+		if field.isZero && !field.isNull && field.tagOptions.emitEmptySymbol {
+			field.isZero = false
+		}
+
+		if field.isNull {
+			continue
 		}
 
-		if field.isZero && !field.tagOptions.commitZeroValue {
+		if field.isZero && !m.commitsZeroValue(field) {
 			continue
 		}
 
-		valStr, err := serializeValue(fieldValue.Interface(), field.qdbType)
+		if err := field.checkValidSymbol(fieldValue); err != nil {
+			return err
+		}
+
+		v := fieldValue.Interface()
+		// the designated timestamp ends the line as nanoseconds, which only cover a limited range
+		if t, ok := field.timeValue(); ok && field == m.designatedTS && !field.isZero {
+			if _, err := formatLineTimestamp(t); err != nil {
+				return fmt.Errorf("%s: %w", field.name, err)
+			}
+		}
+		v, err := field.storedValue(v)
+		if err != nil {
+			return err
+		}
+
+		if valStr, ok := field.formatFloat(v); ok {
+			field.valueSerialized = valStr
+			continue
+		}
+		valStr, err := serializeValue(v, field.columnType(), m.format)
 		if err != nil {
 			return fmt.Errorf("%s: %w", field.name, err)
 		}
@@ -262,90 +784,317 @@ func (m *Model) Columns() string {
 
 // ScanInto func is a helper function which takes a *sql.Row and a dest (an valid qdb model struct)
 // and scans the row values into dest. This will typically be used in conjunction with a select statement
-// which has used (Model).Columns() to specify the columns for selecting.
+// which has used (Model).Columns() to specify the columns for selecting. NULL columns scan as nil
+// into pointer fields and as the zero value into other fields. As a *sql.Row does not expose its
+// columns, values are always scanned in column order; see ScanRows for other queries.
 func ScanInto(row *sql.Row, dest interface{}) (err error) {
 	m, err := NewModel(dest)
 	if err != nil {
 		return fmt.Errorf("could not make model from dest: %w", err)
 	}
-	return row.Scan(m.destinations()...)
+	addrs, err := m.destinations()
+	if err != nil {
+		return err
+	}
+	return row.Scan(addrs...)
 }
 
-// ScanInto func is a helper function which takes a *sql.Row and a dest (an valid qdb model struct)
-// and scans the row values into dest. This will typically be used in conjunction with a select statement
-// which has used (Model).Columns() to specify the columns for selecting.
-func ScanRows(rows *sql.Rows, dest interface{}) (err error) {
+// ScanRows func is a helper function which takes a *sql.Rows and a dest (an valid qdb model struct)
+// and scans the current row's values into dest. Values are scanned into fields in column order if
+// the query returns as many columns as dest has fields, e.g. a select statement which has used
+// (Model).Columns() to specify the columns for selecting. Otherwise, as for a SELECT * of a table
+// with columns the struct does not have, an error names the unknown and missing columns, unless
+// WithIgnoreUnknownColumns is passed, which scans the columns of dest's fields by name and
+// ignores the others. WithScanByName scans the columns by name whatever their number, for
+// queries selecting the columns in another order, e.g. joins aliasing columns to the field names.
+func ScanRows(rows *sql.Rows, dest interface{}, options ...option) (err error) {
 	m, err := NewModel(dest)
 	if err != nil {
 		return fmt.Errorf("could not make model from dest: %w", err)
 	}
-	return rows.Scan(m.destinations()...)
+	if err := applyOptions(m, options); err != nil {
+		return err
+	}
+	columns, err := m.scanColumns(rows)
+	if err != nil {
+		return err
+	}
+	addrs, err := m.appendColumnDestinations(nil, columns)
+	if err != nil {
+		return err
+	}
+	return rows.Scan(addrs...)
 }
 
-func (m *Model) destinations() []interface{} {
-	addrs := []interface{}{}
+// ScanAll func is a helper function which takes a *sql.Rows and a dest (a pointer to a slice of
+// valid qdb model structs or struct pointers) and appends a new element to dest for each row,
+// scanned the same way as ScanRows, including its options. The model of the element type is only
+// built once, so ScanAll allocates far less than calling ScanRows for each row. rows is not closed.
+func ScanAll(rows *sql.Rows, dest interface{}, options ...option) error {
+	destVal := reflect.ValueOf(dest)
+	if destVal.Kind() != reflect.Ptr || destVal.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("dest must be a pointer to a slice not %T", dest)
+	}
+	sliceVal := destVal.Elem()
+	elemType := sliceVal.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	structType := indirectType(elemType)
+
+	m, err := NewModel(reflect.New(structType).Interface())
+	if err != nil {
+		return fmt.Errorf("could not make model from dest: %w", err)
+	}
+	if err := applyOptions(m, options); err != nil {
+		return err
+	}
+	columns, err := m.scanColumns(rows)
+	if err != nil {
+		return err
+	}
+
+	addrs := make([]interface{}, 0, len(m.fields))
+	for rows.Next() {
+		elem := reflect.New(structType)
+		m.bind(elem)
+		addrs, err = m.appendColumnDestinations(addrs[:0], columns)
+		if err != nil {
+			return err
+		}
+		if err := rows.Scan(addrs...); err != nil {
+			return err
+		}
+		if isPtr {
+			sliceVal = reflect.Append(sliceVal, elem)
+		} else {
+			sliceVal = reflect.Append(sliceVal, elem.Elem())
+		}
+	}
+	destVal.Elem().Set(sliceVal)
+
+	return rows.Err()
+}
+
+// scanColumns func returns, for each column of rows, the index of the Model's field it is scanned
+// into, or -1 if it is ignored. It returns nil if the columns are scanned into the fields in
+// order, which they are if there are as many columns as fields (unless the Model scans by name or
+// ignores unknown columns). Otherwise it returns an error naming the unknown and missing columns,
+// unless every column matches a field or the Model ignores unknown columns.
+func (m *Model) scanColumns(rows *sql.Rows) ([]int, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !m.ignoreUnknownColumns && !m.scanByName && len(columns) == len(m.fields) {
+		return nil, nil
+	}
+
+	fields := make(map[string]int, len(m.fields))
+	for i, field := range m.fields {
+		fields[field.qdbName] = i
+	}
+	indexes := make([]int, len(columns))
+	unknown := []string{}
+	for i, column := range columns {
+		index, ok := fields[column]
+		if !ok {
+			indexes[i] = -1
+			unknown = append(unknown, column)
+			continue
+		}
+		indexes[i] = index
+		delete(fields, column)
+	}
+	if m.ignoreUnknownColumns || (len(unknown) == 0 && len(fields) == 0) {
+		return indexes, nil
+	}
+
+	missing := []string{}
+	for _, field := range m.fields {
+		if _, ok := fields[field.qdbName]; ok {
+			missing = append(missing, field.qdbName)
+		}
+	}
+	return nil, fmt.Errorf("query returned %d columns for the %d fields of %s: unknown columns [%s], missing columns [%s]",
+		len(columns), len(m.fields), m.typ, strings.Join(unknown, ", "), strings.Join(missing, ", "))
+}
+
+// appendColumnDestinations func appends the scan destination of each column to addrs, given the
+// field index of each column returned by scanColumns, and returns the extended slice. Ignored
+// columns are scanned into a discarded sql.RawBytes.
+func (m *Model) appendColumnDestinations(addrs []interface{}, columns []int) ([]interface{}, error) {
+	if columns == nil {
+		return m.appendDestinations(addrs)
+	}
+	fieldAddrs, err := m.destinations()
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range columns {
+		if index < 0 {
+			addrs = append(addrs, new(sql.RawBytes))
+			continue
+		}
+		addrs = append(addrs, fieldAddrs[index])
+	}
+	return addrs, nil
+}
+
+func (m *Model) destinations() ([]interface{}, error) {
+	return m.appendDestinations([]interface{}{})
+}
+
+// appendDestinations func appends the scan destination of each of the Model's fields to addrs
+// and returns the extended slice. Nil embedded struct pointers are allocated so their fields
+// can be scanned into. It returns an error if the Model's struct is not addressable, i.e. the
+// Model was not made from a pointer.
+func (m *Model) appendDestinations(addrs []interface{}) ([]interface{}, error) {
 	for _, field := range m.fields {
 		if !field.value.IsValid() {
-			fmt.Println(field.name)
+			field.value = allocFieldByIndex(m.val, field.index)
+		}
+		if !field.value.CanAddr() {
+			return nil, fmt.Errorf("%s: cannot scan into field, dest must be a pointer to a struct", field.name)
 		}
 		v := field.value.Addr().Interface()
-		qdbScanner, ok := v.(Scanner)
-		if ok {
-			v = newIntermediate(qdbScanner)
+		if field.tagOptions.explode {
+			// an exploded field is scanned as a slice of the row's single element
+			v = newExplodedIntermediate(field.value, field.scanDestination)
+		} else if field.typ.Kind() == reflect.Ptr {
+			// pointer fields are set to nil for NULL, and to a new value scanned as a field of
+			// the pointed to type otherwise
+			if _, ok := field.scanDestination(reflect.New(field.typ.Elem()).Interface()).(sql.Scanner); ok {
+				v = newPointerIntermediate(field.value, field.scanDestination)
+			}
+		} else {
+			v = field.scanDestination(v)
 		}
 		addrs = append(addrs, v)
 	}
-	return addrs
+	return addrs, nil
+}
+
+// scanDestination func returns the destination a value of the field's (non pointer) type,
+// addressed by v, is scanned into: the intermediate converting the stored value if one is needed,
+// else a sql.Null* based intermediate for basic types, which scans NULL as the zero value, else v
+// itself.
+func (f *field) scanDestination(v interface{}) interface{} {
+	if qdbScanner, ok := v.(Scanner); ok {
+		return newIntermediate(qdbScanner)
+	} else if _, ok := v.(sql.Scanner); ok {
+		return v
+	} else if f.qdbType == JSON {
+		return newJSONIntermediate(v)
+	} else if d, ok := v.(*time.Duration); ok {
+		return newDurationIntermediate(d, f.tagOptions.durationUnit)
+	} else if dims := arrayDims(f.qdbType); dims > 0 {
+		return newDoubleArrayIntermediate(v, dims)
+	} else if t, ok := v.(*time.Time); ok {
+		return newTimestampIntermediate(t)
+	} else if n, ok := v.(*int64); ok && f.qdbType == Timestamp {
+		return newEpochIntermediate(n, f.tagOptions.tsUnit)
+	} else if r, ok := v.(*rune); ok && f.qdbType == Char {
+		return newCharIntermediate(r)
+	} else if b, ok := v.(*bool); ok && f.tagOptions.boolAsInt {
+		return newBoolIntIntermediate(b)
+	} else if str, ok := v.(*string); ok && f.tagOptions.timeFormat != "" {
+		return newTimeFormatIntermediate(str, f.tagOptions.timeFormat)
+	} else if rv := reflect.ValueOf(v).Elem(); f.qdbType == UUID && isUUIDType(rv.Type()) {
+		return newUUIDIntermediate(rv)
+	} else if n, ok := newNullIntermediate(v); ok {
+		return n
+	}
+	return v
+}
+
+// TypeMapper is a func which maps a field's QuestDBType to the column type used for it in the
+// create table statement. It only affects the DDL; values are always serialized according to
+// the field's own QuestDBType, so a TypeMapper must map to a column type QuestDB can ingest
+// those values into. In particular symbol and string are not interchangeable, as ILP writes
+// symbols separately from other columns: a TypeMapper must keep symbol fields symbol and map no
+// other type to symbol, which Validate checks.
+type TypeMapper func(qdbType QuestDBType) QuestDBType
+
+// DefaultTypeMapper func is the TypeMapper used unless another is set. It maps binary and json
+// fields, which are ingested as base64 encoded strings, to string columns and leaves every other
+// type unchanged.
+func DefaultTypeMapper(qdbType QuestDBType) QuestDBType {
+	// currently encoding binary as base64 encoded string
+	if qdbType == Binary || qdbType == JSON {
+		return String
+	}
+	return qdbType
+}
+
+// SetTypeMapper func sets the TypeMapper used by CreateTableIfNotExistStatement. Passing nil
+// restores DefaultTypeMapper.
+func (m *Model) SetTypeMapper(typeMapper TypeMapper) {
+	m.typeMapper = typeMapper
+}
+
+// schemaColumn struct is a column of the Model's table and its type
+type schemaColumn struct {
+	name    string
+	qdbType QuestDBType
+}
+
+// schemaColumns func returns the columns CreateTableIfNotExistStatement declares, with their
+// types after the Model's TypeMapper
+func (m *Model) schemaColumns() []schemaColumn {
+	typeMapper := m.typeMapper
+	if typeMapper == nil {
+		typeMapper = DefaultTypeMapper
+	}
+	columns := []schemaColumn{}
+	for _, field := range m.fields {
+		columns = append(columns, schemaColumn{name: field.qdbName, qdbType: typeMapper(field.columnType())})
+	}
+	for _, name := range m.defaultSymbolNames() {
+		columns = append(columns, schemaColumn{name: name, qdbType: typeMapper(Symbol)})
+	}
+	if m.designatedTS == nil && !m.noDesignatedTimestamp() {
+		columns = append(columns, schemaColumn{name: "timestamp", qdbType: Timestamp})
+	}
+	return columns
+}
+
+// noDesignatedTimestamp func returns whether the Model's table is created without a designated
+// timestamp, see CreateTableOptions.NoDesignatedTimestamp
+func (m *Model) noDesignatedTimestamp() bool {
+	return m.createTableOptions != nil && m.createTableOptions.NoDesignatedTimestamp
 }
 
 // CreateTableIfNotExistStatement func returns the sql create table statement for
 // the Model
 func (m *Model) CreateTableIfNotExistStatement() string {
-	out := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS "%s" ( `, m.tableName)
+	return createTableStatement(m.tableName, m.schemaColumns(), m.indexClauses(), m.timestampClause(), m.createTableOptions)
+}
 
-	// add each qdb column to the create table statement's column definition
-	for i, field := range m.fields {
-		qdbType := field.qdbType
-		// currently encoding binary as base64 encoded string
-		if qdbType == Binary || qdbType == JSON {
-			qdbType = String
-		}
-		out += fmt.Sprintf("\"%s\" %s", field.qdbName, qdbType)
-		if i != len(m.fields)-1 {
-			out += ", "
-		}
-	}
+// createTableStatement func returns the sql create table statement of the table tableName with
+// columns, the index clauses indexes, the timestamp clause (if not empty) and the create table
+// options, if any
+func createTableStatement(tableName string, columns []schemaColumn, indexes []string, timestampClause string, options *CreateTableOptions) string {
+	out := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s ( `, QuoteIdentifier(tableName))
 
-	// add default designated timestamp field
-	if m.designatedTS == nil {
-		out += ", \"timestamp\" timestamp"
+	// add each qdb column to the create table statement's column definition
+	definitions := []string{}
+	for _, column := range columns {
+		definitions = append(definitions, fmt.Sprintf("%s %s", QuoteIdentifier(column.name), column.qdbType))
 	}
+	out += strings.Join(definitions, ", ")
 	out += " ) "
 
 	// if index fields, add them to statement
-	indexFieldsLen := len(m.indexFields)
-	if indexFieldsLen > 0 {
-		out += ", "
-		for i, field := range m.indexFields {
-			out += fmt.Sprintf("index(%s)", field.qdbName)
-			if i != indexFieldsLen-1 {
-				out += ", "
-			} else {
-				out += " "
-			}
-		}
+	if len(indexes) > 0 {
+		out += ", " + strings.Join(indexes, ", ") + " "
 	}
 
-	// if designatedTS is specified, add to statement, else use default designated TS field
-	if m.designatedTS == nil {
-		out += "timestamp(timestamp) "
-	} else {
-		out += fmt.Sprintf("timestamp(%s) ", m.designatedTS.qdbName)
+	if timestampClause != "" {
+		out += timestampClause + " "
 	}
 
 	// if some create table options exists, add them to statement
-	if m.createTableOptions != nil {
-		out += m.createTableOptions.String()
+	if options != nil {
+		out += options.String()
 	}
 
 	// end statement
@@ -354,105 +1103,718 @@ func (m *Model) CreateTableIfNotExistStatement() string {
 	return out
 }
 
-func (m *Model) buildSymbols() string {
-	if len(m.fields) == 0 {
+// ColumnSpec struct describes a column of a table created by CreateTableFromSpec
+type ColumnSpec struct {
+	Name string
+	Type QuestDBType
+	// Indexed adds an index on the column, which must be a symbol column
+	Indexed bool
+	// DesignatedTS makes the column, which must be a timestamp column, the designated timestamp
+	// of the table
+	DesignatedTS bool
+}
+
+// CreateTableFromSpec func returns the sql create table statement of the table name with columns,
+// for tables whose shape is only known at runtime rather than as a qdb tagged struct. Column
+// types are mapped by DefaultTypeMapper and names, including those of the index and timestamp
+// clauses, quoted as in CreateTableIfNotExistStatement. Like a struct without a designated
+// timestamp field, a table without a DesignatedTS column gets a designated "timestamp" column,
+// unless opts.NoDesignatedTimestamp is set, in which case the table has no designated timestamp
+// at all. If several columns are DesignatedTS, the first is used. It returns an error if a column
+// has no name, is Indexed but not a symbol, is DesignatedTS but not a timestamp, or is named
+// "timestamp" while the default timestamp column is added.
+func CreateTableFromSpec(name string, columns []ColumnSpec, opts CreateTableOptions) (string, error) {
+	schema := []schemaColumn{}
+	indexes := []string{}
+	designatedTS := ""
+	for i, column := range columns {
+		if column.Name == "" {
+			return "", fmt.Errorf("column %d has no name", i)
+		}
+		if column.Indexed && column.Type != Symbol {
+			return "", fmt.Errorf("column '%s' must be a symbol not %s to be indexed", column.Name, column.Type)
+		}
+		if column.DesignatedTS && column.Type != Timestamp {
+			return "", fmt.Errorf("column '%s' must be a timestamp not %s to be the designated timestamp", column.Name, column.Type)
+		}
+		schema = append(schema, schemaColumn{name: column.Name, qdbType: DefaultTypeMapper(column.Type)})
+		if column.Indexed {
+			indexes = append(indexes, fmt.Sprintf("index(%s)", QuoteIdentifier(column.Name)))
+		}
+		if column.DesignatedTS && designatedTS == "" {
+			designatedTS = column.Name
+		}
+	}
+	if opts.NoDesignatedTimestamp {
+		return createTableStatement(name, schema, indexes, "", &opts), nil
+	}
+	if designatedTS == "" {
+		designatedTS = "timestamp"
+		for _, column := range columns {
+			// QuestDB column names are case insensitive
+			if strings.EqualFold(column.Name, designatedTS) {
+				return "", fmt.Errorf("column '%s' clashes with the default designated timestamp column, make it DesignatedTS or rename it", column.Name)
+			}
+		}
+		schema = append(schema, schemaColumn{name: designatedTS, qdbType: Timestamp})
+	}
+	return createTableStatement(name, schema, indexes, fmt.Sprintf("timestamp(%s)", QuoteIdentifier(designatedTS)), &opts), nil
+}
+
+// CreateTableStatementPretty func returns the same statement as CreateTableIfNotExistStatement
+// formatted for people rather than QuestDB, with one column per line and the column types
+// aligned, e.g. for logging or debugging wide tables:
+//
+//	CREATE TABLE IF NOT EXISTS "trades" (
+//	    "pair"  symbol,
+//	    "price" double,
+//	    "ts"    timestamp
+//	), index(pair) timestamp(ts) PARTITION BY DAY;
+func (m *Model) CreateTableStatementPretty() string {
+	columns := m.schemaColumns()
+	names := make([]string, len(columns))
+	width := 0
+	for i, column := range columns {
+		names[i] = QuoteIdentifier(column.name)
+		if n := utf8.RuneCountInString(names[i]); n > width {
+			width = n
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n", QuoteIdentifier(m.tableName)))
+	for i, column := range columns {
+		sb.WriteString(fmt.Sprintf("    %-*s %s", width, names[i], column.qdbType))
+		if i != len(columns)-1 {
+			sb.WriteString(",")
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(")")
+
+	clauses := m.indexClauses()
+	if len(clauses) > 0 {
+		sb.WriteString(", " + strings.Join(clauses, ", "))
+	}
+	if clause := m.timestampClause(); clause != "" {
+		sb.WriteString(" " + clause)
+	}
+	if m.createTableOptions != nil {
+		if options := strings.TrimSpace(m.createTableOptions.String()); options != "" {
+			sb.WriteString(" " + options)
+		}
+	}
+	sb.WriteString(";")
+
+	return sb.String()
+}
+
+// indexClauses func returns the index(column) clauses of the Model's indexed fields
+func (m *Model) indexClauses() []string {
+	clauses := []string{}
+	for _, field := range m.indexFields {
+		clauses = append(clauses, fmt.Sprintf("index(%s)", field.qdbName))
+	}
+	return clauses
+}
+
+// timestampClause func returns the timestamp(column) clause of the Model's designated timestamp,
+// or of the default "timestamp" column if it has none, or "" if the table is created without a
+// designated timestamp
+func (m *Model) timestampClause() string {
+	if m.noDesignatedTimestamp() {
 		return ""
 	}
+	if m.designatedTS == nil {
+		return "timestamp(timestamp)"
+	}
+	return fmt.Sprintf("timestamp(%s)", m.designatedTS.qdbName)
+}
+
+// LatestOnStatement func returns a sql select statement for the Model's columns which selects
+// the latest row, by designated timestamp, of each distinct combination of partitionBy columns:
+//
+//	SELECT <columns> FROM "<table>" LATEST ON <designated timestamp> PARTITION BY <partitionBy>
+//
+// If partitionBy is empty, the Model's indexed fields are used. An error is returned if the
+// Model has no designated timestamp field, if there are no partition columns or if a partition
+// column is not a column of the Model.
+func (m *Model) LatestOnStatement(partitionBy ...string) (string, error) {
+	if m.designatedTS == nil {
+		return "", fmt.Errorf("LATEST ON requires a designated timestamp field")
+	}
 
+	if len(partitionBy) == 0 {
+		for _, field := range m.indexFields {
+			partitionBy = append(partitionBy, field.qdbName)
+		}
+	}
+
+	if len(partitionBy) == 0 {
+		return "", fmt.Errorf("LATEST ON requires partition columns or indexed fields")
+	}
+
+	for _, column := range partitionBy {
+		if m.fieldByColumn(column) == nil {
+			return "", fmt.Errorf("partition column '%s' is not a column of %s", column, m.tableName)
+		}
+	}
+
+	return fmt.Sprintf(`SELECT %s FROM %s LATEST ON %s PARTITION BY %s`,
+		m.Columns(), QuoteIdentifier(m.tableName), m.designatedTS.qdbName, strings.Join(partitionBy, ", ")), nil
+}
+
+var (
+	// sampleByIntervalRegexp matches a SAMPLE BY interval, a count and a unit: U (microseconds),
+	// T (milliseconds), s, m, h, d, M (months) or y
+	sampleByIntervalRegexp = regexp.MustCompile(`^[0-9]+[UTsmhdMy]$`)
+	// aggregateRegexp matches the name of an aggregate function
+	aggregateRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// SampleByStatement func returns a sql select statement downsampling the Model's table into
+// buckets of interval (e.g. "1h" or "15m"):
+//
+//	SELECT <aggregate>(<column>) <column>, ..., <designated timestamp> FROM "<table>" SAMPLE BY <interval>
+//
+// aggregates maps column names to the aggregate function applied to them (e.g. "price": "avg").
+// A column mapped to "" is selected as is, making it a key each bucket is grouped by (e.g. a
+// symbol). Columns are selected in the Model's field order and keep their names. An error is
+// returned if the Model has no designated timestamp field, if interval is invalid, if there are
+// no aggregates or if an aggregate column is not a column of the Model.
+func (m *Model) SampleByStatement(interval string, aggregates map[string]string) (string, error) {
+	if m.designatedTS == nil {
+		return "", fmt.Errorf("SAMPLE BY requires a designated timestamp field")
+	}
+	if !sampleByIntervalRegexp.MatchString(interval) {
+		return "", fmt.Errorf("'%s' is not a valid SAMPLE BY interval", interval)
+	}
+	if len(aggregates) == 0 {
+		return "", fmt.Errorf("SAMPLE BY requires aggregates")
+	}
+
+	for column, aggregate := range aggregates {
+		f := m.fieldByColumn(column)
+		if f == nil {
+			return "", fmt.Errorf("aggregate column '%s' is not a column of %s", column, m.tableName)
+		}
+		if f == m.designatedTS {
+			return "", fmt.Errorf("aggregate column '%s' is the designated timestamp", column)
+		}
+		if aggregate != "" && !aggregateRegexp.MatchString(aggregate) {
+			return "", fmt.Errorf("'%s' is not a valid aggregate function for column '%s'", aggregate, column)
+		}
+	}
+
+	selected := []string{}
+	for _, field := range m.fields {
+		aggregate, ok := aggregates[field.qdbName]
+		if !ok {
+			continue
+		}
+		if aggregate == "" {
+			selected = append(selected, field.qdbName)
+			continue
+		}
+		selected = append(selected, fmt.Sprintf("%s(%s) %s", aggregate, field.qdbName, field.qdbName))
+	}
+	selected = append(selected, m.designatedTS.qdbName)
+
+	return fmt.Sprintf(`SELECT %s FROM %s SAMPLE BY %s`,
+		strings.Join(selected, ", "), QuoteIdentifier(m.tableName), interval), nil
+}
+
+// InClause func returns the sql predicate (and its args) filtering the Model's symbol or string
+// column to values, as BuildInClause does, e.g. for:
+//
+//	where, args, err := m.InClause("pair", pairs)
+//	rows, err := db.Query(`SELECT * FROM "trades" WHERE `+where, args...)
+//
+// An error is returned if column is not a symbol or string column of the Model.
+func (m *Model) InClause(column string, values []string) (string, []interface{}, error) {
+	f := m.fieldByColumn(column)
+	if f == nil {
+		return "", nil, fmt.Errorf("IN column '%s' is not a column of %s", column, m.tableName)
+	}
+	if f.qdbType != Symbol && f.qdbType != String {
+		return "", nil, fmt.Errorf("IN column '%s' is a %s column, not a symbol or string column", column, f.qdbType)
+	}
+	where, args := BuildInClause(f.qdbName, values)
+	return where, args, nil
+}
+
+// confirmQuery func returns the sql query (and its args) counting the rows of the Model's table
+// which match its key fields: the designated timestamp (or the timestamp set by SetTimestamp)
+// and every written symbol. It returns an error if the Model has no designated timestamp value to
+// match on.
+func (m *Model) confirmQuery() (string, []interface{}, error) {
+	if m.exploded != nil {
+		return "", nil, fmt.Errorf("confirming a write of an exploded field is not supported")
+	}
+	if m.designatedTS == nil || (m.designatedTS.isZero && m.timestamp.IsZero()) {
+		return "", nil, fmt.Errorf("confirming a write requires a designated timestamp value")
+	}
+	ts := m.timestamp
+	if ts.IsZero() {
+		var ok bool
+		if ts, ok = m.designatedTS.timeValue(); !ok {
+			return "", nil, fmt.Errorf("confirming a write requires a time.Time or int64 designated timestamp")
+		}
+	}
+
+	// QuestDB stores timestamps with microsecond precision
+	conditions := []string{fmt.Sprintf("%s = $1", QuoteIdentifier(m.designatedTS.qdbName))}
+	args := []interface{}{ts.UTC().Truncate(time.Microsecond)}
+	for _, field := range m.fields {
+		if field.qdbType != Symbol || !m.emits(field) {
+			continue
+		}
+		args = append(args, field.value.Interface())
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", QuoteIdentifier(field.qdbName), len(args)))
+	}
+
+	return fmt.Sprintf("SELECT count() FROM %s WHERE %s", QuoteIdentifier(m.tableName), strings.Join(conditions, " AND ")), args, nil
+}
+
+// fieldByColumn func returns the Model's field of the named column, or nil if there is none
+func (m *Model) fieldByColumn(column string) *field {
+	for _, field := range m.fields {
+		if field.qdbName == column {
+			return field
+		}
+	}
+	return nil
+}
+
+// commitsZeroValue func returns whether MarshalLine writes the zero value of field f, which it
+// does if f is tagged 'commitZeroValue:true' or the Model commits every zero value. The zero
+// designated timestamp is never written, so QuestDB stamps the line instead.
+func (m *Model) commitsZeroValue(f *field) bool {
+	return f.tagOptions.commitZeroValue || (m.commitZeroValues && f != m.designatedTS)
+}
+
+// emits func returns whether MarshalLine writes field f, which it does if f is non zero (or
+// commits zero values) and passes the Model's column and field filters
+func (m *Model) emits(f *field) bool {
+	if f.isNull {
+		return false
+	}
+	if f.isZero && !m.commitsZeroValue(f) {
+		return false
+	}
+	if m.columnFilter != nil && f != m.designatedTS {
+		if _, ok := m.columnFilter[f.qdbName]; !ok {
+			return false
+		}
+	}
+	if m.fieldFilter != nil && f != m.designatedTS && !m.fieldFilter(m.fieldInfo(f)) {
+		return false
+	}
+	return true
+}
+
+// defaultSymbolNames func returns the names of the Model's default symbols in ascending order
+func (m *Model) defaultSymbolNames() []string {
+	names := make([]string, 0, len(m.defaultSymbols))
+	for name := range m.defaultSymbols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// symbolEntries func returns the Model's symbols to write, ordered by their position in order if
+// it is non nil
+func (m *Model) symbolEntries(order map[string]int) []lineEntry {
 	fields := []*field{}
 
 	for _, field := range m.fields {
-		if field.qdbType == Symbol && (!field.isZero || (field.isZero && field.tagOptions.commitZeroValue)) {
+		if field.qdbType == Symbol && m.emits(field) {
 			fields = append(fields, field)
 		}
 	}
 
-	out := ""
-	n := 0
-	for _, field := range fields {
-		out += fmt.Sprintf("%s=%s", field.qdbName, field.valueSerialized)
-		if n != len(fields)-1 {
-			out += ","
+	// explicitly ordered symbols go first, the rest keep their field order
+	sort.SliceStable(fields, func(i, j int) bool {
+		a, b := fields[i].tagOptions, fields[j].tagOptions
+		if a.symbolOrdered != b.symbolOrdered {
+			return a.symbolOrdered
 		}
-		n++
+		return a.symbolOrder < b.symbolOrder
+	})
+
+	symbols := []lineEntry{}
+	for _, field := range fields {
+		symbols = append(symbols, lineEntry{name: field.qdbName, value: field.valueSerialized})
 	}
 
-	return out
+	// default symbols follow the symbol fields, in name order
+	for _, name := range m.defaultSymbolNames() {
+		value := quoteEscape(m.defaultSymbols[name], needsEscapeForSymbol, quoteSymbolFn)
+		symbols = append(symbols, lineEntry{name: name, value: value})
+	}
+
+	return orderLineEntries(symbols, order)
 }
 
-func (m *Model) buildColumns() string {
+// columnEntries func returns the Model's columns to write, other than the designated timestamp,
+// ordered by their position in order if it is non nil
+func (m *Model) columnEntries(order map[string]int) []lineEntry {
 	if len(m.fields) == 0 {
-		return ""
+		return nil
 	}
 
 	fields := []*field{}
 
 	for _, field := range m.fields {
-		if field.qdbType != Symbol && (!field.isZero || (field.isZero && field.tagOptions.commitZeroValue)) {
+		if field.qdbType != Symbol && m.emits(field) {
 			fields = append(fields, field)
 		}
 	}
 
-	fieldsSerialized := []string{}
+	columns := []lineEntry{}
 	for _, field := range fields {
 		// skip including this in columns field as it will be included in the timestamp section of
 		// line message:
 		// 			 <table name>,<symbols,...> <columns,...> <timestamp>
 		// 												here ----^
-		if field.tagOptions.designatedTS {
+		if field == m.designatedTS {
 			continue
 		}
-		fieldsSerialized = append(fieldsSerialized, fmt.Sprintf("%s=%s", field.qdbName, field.valueSerialized))
+		columns = append(columns, lineEntry{name: field.qdbName, value: field.valueSerialized})
 	}
 
-	return strings.Join(fieldsSerialized, ",")
+	return orderLineEntries(columns, order)
 }
 
-func (m *Model) buildTimestamp() string {
-	if m.designatedTS != nil && m.designatedTS.value.IsValid() {
-		designatedTSTime, ok := m.designatedTS.value.Interface().(time.Time)
-		if ok {
-			if !designatedTSTime.IsZero() {
-				return fmt.Sprintf("%d", designatedTSTime.UnixNano())
-			}
+// orderLineEntries func sorts entries by their name's position in order, placing the entries
+// order does not name after those it does in their existing order. A nil order leaves entries
+// as they are.
+func orderLineEntries(entries []lineEntry, order map[string]int) []lineEntry {
+	if order == nil {
+		return entries
+	}
+	position := func(name string) int {
+		if i, ok := order[name]; ok {
+			return i
 		}
+		return len(order)
 	}
-	return ""
+	sort.SliceStable(entries, func(i, j int) bool {
+		return position(entries[i].name) < position(entries[j].name)
+	})
+	return entries
+}
+
+// SetTimestamp func sets the timestamp emitted at the end of the line by MarshalLine,
+// overriding the value of the designated timestamp field (if any). Passing the zero
+// time.Time removes the override.
+func (m *Model) SetTimestamp(t time.Time) {
+	m.timestamp = t
+}
+
+// now func returns the current time of the Model's clock
+func (m *Model) now() time.Time {
+	if m.clock != nil {
+		return m.clock()
+	}
+	return time.Now()
+}
+
+// buildTimestamp func returns the timestamp ending the Model's line, or "" if the line has none.
+// It returns an error if the designated timestamp field is a nil pointer and no other timestamp
+// is set, as a nil pointer is more likely a bug than a request for the server's time.
+func (m *Model) buildTimestamp() (string, error) {
+	if !m.timestamp.IsZero() {
+		return formatLineTimestamp(m.timestamp)
+	}
+	if m.designatedTS != nil && !m.designatedTS.isZero {
+		designatedTSTime, ok := m.designatedTS.timeValue()
+		if !ok {
+			return "", fmt.Errorf("%s: designated timestamp of type %s cannot be read as a time", m.designatedTS.name, m.designatedTS.typ)
+		}
+		return formatLineTimestamp(designatedTSTime)
+	}
+	if m.stampNowIfZero {
+		return formatLineTimestamp(m.now())
+	}
+	if m.designatedTS != nil && m.designatedTS.isNull && m.designatedTS.typ.Kind() == reflect.Ptr {
+		return "", fmt.Errorf("%s: designated timestamp pointer is nil", m.designatedTS.name)
+	}
+	return "", nil
 }
 
 // MarshalLine func marshals Model's underlying struct values into Influx Line Protocol
 // message serialization format to be written to the QuestDB ILP port for ingestion.
+// MarshalLine does not report errors: values which cannot be serialized, including a designated
+// timestamp outside the range of nanosecond timestamps, are left out of the line. Client's write
+// methods return such errors instead. A row without any symbol or column to write, which QuestDB
+// would reject, marshals to nil and is an ErrNoFieldsToWrite error for the write methods.
 func (m *Model) MarshalLine() (msg []byte) {
-	m.serialize()
-	symbolsString := m.buildSymbols()
-	columnsString := m.buildColumns()
-	timestampString := m.buildTimestamp()
+	line, _ := m.marshalLine()
+	return line
+}
+
+// MarshalLineOrdered func is like MarshalLine but writes the symbols, then the columns, in the
+// order their names appear in columnOrder, for lines which are byte identical across versions
+// of the struct's field layout (e.g. golden files). Symbols and columns columnOrder does not name
+// follow those it does, in their MarshalLine order. Naming the designated timestamp has no
+// effect as it always ends the line. It returns an error if a name is not a column of the Model
+// or is repeated, or if a value cannot be serialized.
+func (m *Model) MarshalLineOrdered(columnOrder []string) ([]byte, error) {
+	order := make(map[string]int, len(columnOrder))
+	for i, name := range columnOrder {
+		if m.fieldByColumn(name) == nil {
+			if _, ok := m.defaultSymbols[name]; !ok {
+				return nil, fmt.Errorf("column '%s' is not a column of %s", name, m.tableName)
+			}
+		}
+		if _, ok := order[name]; ok {
+			return nil, fmt.Errorf("column '%s' is repeated in the column order", name)
+		}
+		order[name] = i
+	}
+	lines, err := m.marshalLinesOrdered(order)
+	return joinLines(lines), err
+}
 
-	outString := m.tableName
+// marshalLine func is like MarshalLine but also returns the first error encountered
+func (m *Model) marshalLine() ([]byte, error) {
+	lines, err := m.marshalLines()
+	return joinLines(lines), err
+}
 
-	if symbolsString != "" {
-		outString += fmt.Sprintf(",%s", symbolsString)
+// joinLines func returns lines written one after the other, or nil if there are none
+func joinLines(lines [][]byte) []byte {
+	if len(lines) == 0 {
+		return nil
 	}
+	return bytes.Join(lines, nil)
+}
 
-	if columnsString != "" {
-		outString += fmt.Sprintf(" %s", columnsString)
+// marshalLines func returns the lines MarshalLine writes, one per element of an exploded field or
+// else a single one, and the first error encountered
+func (m *Model) marshalLines() ([][]byte, error) {
+	if m.sortedColumns {
+		return m.marshalLinesOrdered(m.alphabeticalOrder())
 	}
+	return m.marshalLinesOrdered(nil)
+}
 
-	if timestampString != "" {
-		outString += fmt.Sprintf(" %s", timestampString)
+// marshalLinesOrdered func is like marshalLines but orders the lines' symbols and columns by
+// their position in order, if it is non nil
+func (m *Model) marshalLinesOrdered(order map[string]int) ([][]byte, error) {
+	lines := [][]byte{}
+	err := m.eachLineOrdered(order, func(parts lineParts) {
+		lines = append(lines, parts.bytes())
+	})
+	if len(lines) == 0 {
+		return nil, err
 	}
+	return lines, err
+}
 
-	outString += "\n"
+// eachLineOrdered func calls fn with the parts of each line marshalLinesOrdered returns, one per
+// element of an exploded field or else a single one, and returns the first error encountered
+func (m *Model) eachLineOrdered(order map[string]int, fn func(parts lineParts)) error {
+	if m.exploded == nil {
+		parts, ok, err := m.linePartsOrdered(order)
+		if ok {
+			fn(parts)
+		}
+		return err
+	}
 
-	return []byte(outString)
+	defer func() { m.explodeIndex = 0 }()
+	n := 0
+	if m.exploded.value.IsValid() {
+		n = m.exploded.value.Len()
+	}
+	var firstErr error
+	for m.explodeIndex = 0; m.explodeIndex < n; m.explodeIndex++ {
+		parts, ok, err := m.linePartsOrdered(order)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if ok {
+			fn(parts)
+		}
+	}
+	return firstErr
+}
+
+// LineSize func returns the length in bytes of the line MarshalLine returns, without building
+// it, so that callers can budget the bytes written to the ILP port before writing (e.g. to rate
+// limit a Client). Like Client's write methods, LineSize returns the first error encountered,
+// such as ErrNoFieldsToWrite, along with the size of the line MarshalLine returns despite it.
+func (m *Model) LineSize() (int, error) {
+	size := 0
+	err := m.eachLine(func(parts lineParts) {
+		size += parts.size()
+	})
+	return size, err
+}
+
+// eachLine func is like eachLineOrdered but in the order MarshalLine writes symbols and columns
+func (m *Model) eachLine(fn func(parts lineParts)) error {
+	if m.sortedColumns {
+		return m.eachLineOrdered(m.alphabeticalOrder(), fn)
+	}
+	return m.eachLineOrdered(nil, fn)
+}
+
+// explodedElement func returns the element i of the slice v, or the zero reflect.Value if v has
+// no such element
+func explodedElement(v reflect.Value, i int) reflect.Value {
+	if !v.IsValid() || i >= v.Len() {
+		return reflect.Value{}
+	}
+	return v.Index(i)
+}
+
+// alphabeticalOrder func returns the position of each of the Model's columns, including its
+// default symbols, in alphabetical order of their names
+func (m *Model) alphabeticalOrder() map[string]int {
+	names := make([]string, 0, len(m.fields)+len(m.defaultSymbols))
+	for _, field := range m.fields {
+		names = append(names, field.qdbName)
+	}
+	names = append(names, m.defaultSymbolNames()...)
+	sort.Strings(names)
+
+	order := make(map[string]int, len(names))
+	for i, name := range names {
+		order[name] = i
+	}
+	return order
+}
+
+// lineParts struct holds the serialized parts of an ILP line and the dialect it is written in:
+//
+//	<table name>,<symbols,...> <columns,...> <timestamp>
+type lineParts struct {
+	dialect   ILPDialect
+	tableName string
+	symbols   []lineEntry
+	columns   []lineEntry
+	timestamp string
+}
+
+// size func returns the length in bytes of the line of p
+func (p lineParts) size() int {
+	return p.dialect.lineSize(p.tableName, p.symbols, p.columns, p.timestamp)
+}
+
+// bytes func returns the line of p
+func (p lineParts) bytes() []byte {
+	return p.appendTo(make([]byte, 0, p.size()))
+}
+
+// appendTo func appends the line of p to b
+func (p lineParts) appendTo(b []byte) []byte {
+	return p.dialect.appendLine(b, p.tableName, p.symbols, p.columns, p.timestamp)
+}
+
+// linePartsOrdered func returns the parts of the Model's line with its symbols and columns
+// ordered by their position in order, if it is non nil, whether there is a line at all and the
+// first error encountered. The line of an exploded field holds its current element.
+func (m *Model) linePartsOrdered(order map[string]int) (lineParts, bool, error) {
+	errs := []error{}
+	if err := m.serialize(); err != nil {
+		errs = append(errs, err)
+	}
+	m.applyShard()
+	parts := lineParts{
+		dialect:   m.format.ilpDialect(),
+		tableName: m.tableName,
+		symbols:   m.symbolEntries(order),
+		columns:   m.columnEntries(order),
+	}
+	// QuestDB rejects a line of just the table name and timestamp
+	if len(parts.symbols) == 0 && len(parts.columns) == 0 {
+		return lineParts{}, false, fmt.Errorf("%w: every field of the %s row is zero or null", ErrNoFieldsToWrite, m.tableName)
+	}
+	timestamp, err := m.buildTimestamp()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	parts.timestamp = timestamp
+
+	if len(errs) > 0 {
+		return parts, true, errs[0]
+	}
+	return parts, true, nil
 }
 
-var matchFirstCap = regexp.MustCompile("(.)([A-Z][a-z]+)")
-var matchAllCap = regexp.MustCompile("([a-z0-9])([A-Z])")
+// MarshalStruct func returns the ILP line of a, a valid struct with qdb tags (or a pointer to one)
+// or a LineMarshaler, with options applied. The line is exactly what Client.Write sends for a
+// with the default Config, so MarshalStruct can be used to test, snapshot or pipe lines to other
+// ILP consumers without a Client. Unlike MarshalLine, it returns the errors Client.Write would.
+func MarshalStruct(a interface{}, options ...option) ([]byte, error) {
+	if lm, ok := a.(LineMarshaler); ok {
+		line, err := lm.MarshalLine()
+		if err != nil {
+			return nil, err
+		}
+		return terminateLines(line), nil
+	}
+	m, err := NewModel(a)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyOptions(m, options); err != nil {
+		return nil, err
+	}
+	return m.marshalLine()
+}
 
-// toSnakeCase func takes a string and returns it's snake case form
+// toSnakeCase func takes a string and returns it's snake case form. Word boundaries are placed:
+//
+//   - between a lowercase letter and an uppercase letter ("UserID" -> "user_id")
+//   - before the last capital of an acronym followed by a word ("HTTPServer" -> "http_server")
+//   - between a digit and a capitalized word ("HTTP2Server" -> "http2_server")
+//
+// Digits stay attached to the word they follow ("OAuth2" -> "o_auth2", "Size2D" -> "size2d"),
+// a single lowercase letter does not end an acronym ("IPv4Addr" -> "ipv4_addr") and any
+// character that is not a letter or digit is treated as a separator.
 func toSnakeCase(str string) string {
-	snake := matchFirstCap.ReplaceAllString(str, "${1}_${2}")
-	snake = matchAllCap.ReplaceAllString(snake, "${1}_${2}")
-	return strings.ToLower(snake)
+	runes := []rune(str)
+	words := []string{}
+	word := []rune{}
+
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+
+		if unicode.IsUpper(r) && len(word) > 0 {
+			prev := runes[i-1]
+			// number of lowercase letters directly following r
+			lowerRun := 0
+			for j := i + 1; j < len(runes) && unicode.IsLower(runes[j]); j++ {
+				lowerRun++
+			}
+			switch {
+			case unicode.IsLower(prev):
+				flush()
+			case unicode.IsDigit(prev) && lowerRun > 0:
+				flush()
+			case unicode.IsUpper(prev) && lowerRun > 1:
+				flush()
+			}
+		}
+
+		word = append(word, unicode.ToLower(r))
+	}
+	flush()
+
+	return strings.Join(words, "_")
 }
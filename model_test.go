@@ -0,0 +1,1706 @@
+package questdb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToSnakeCase(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"", ""},
+		{"User", "user"},
+		{"userName", "user_name"},
+		{"ID", "id"},
+		{"UserID", "user_id"},
+		{"UserIDs", "user_ids"},
+		{"HTTP", "http"},
+		{"HTTPServer", "http_server"},
+		{"HTTP2Server", "http2_server"},
+		{"OAuth2", "o_auth2"},
+		{"IPv4Addr", "ipv4_addr"},
+		{"Size2D", "size2d"},
+		{"MyV2Table", "my_v2_table"},
+		{"JSONData", "json_data"},
+		{"Already_Snake", "already_snake"},
+		{"trade_events", "trade_events"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			assert.Equal(t, tt.out, toSnakeCase(tt.in))
+		})
+	}
+}
+
+func TestScanInto_JSON(t *testing.T) {
+	type event struct {
+		Payload map[string]interface{} `qdb:"payload;json"`
+	}
+
+	t.Run("should scan a json column written by the client back into a map", func(t *testing.T) {
+		written := &event{
+			Payload: map[string]interface{}{
+				"name":  "deposit",
+				"value": 42.5,
+				"tags":  []interface{}{"a", "b"},
+			},
+		}
+		m, err := NewModel(written)
+		assert.Nil(t, err)
+
+		// the serialized ILP value is a quoted base64 string; QuestDB returns it unquoted
+		stored := strings.Trim(m.fields[0].valueSerialized, `"`)
+		db := newTestDB(t, []string{"payload"}, []driver.Value{stored})
+
+		read := &event{}
+		err = ScanInto(db.QueryRow("SELECT payload FROM events"), read)
+		assert.Nil(t, err)
+		assert.Equal(t, written.Payload, read.Payload)
+	})
+}
+
+type testTrade struct {
+	Pair  string    `qdb:"pair;symbol"`
+	Price float64   `qdb:"price;double"`
+	TS    time.Time `qdb:"ts;timestamp;designatedTS:true"`
+}
+
+func TestModel_SetTimestamp(t *testing.T) {
+	t.Run("should override the designated timestamp field value", func(t *testing.T) {
+		m, err := NewModel(&testTrade{Pair: "BTC-USD", Price: 1, TS: time.Unix(1, 0)})
+		assert.Nil(t, err)
+
+		m.SetTimestamp(time.Unix(2, 0))
+
+		assert.Equal(t, "test_trades,pair=BTC-USD price=1 2000000000\n", string(m.MarshalLine()))
+	})
+
+	t.Run("should emit a timestamp for models without a designated timestamp field", func(t *testing.T) {
+		m, err := NewModel(&testRow{Name: "a", Value: 1})
+		assert.Nil(t, err)
+
+		m.SetTimestamp(time.Unix(3, 0))
+
+		assert.Equal(t, "test_rows,name=a value=1i 3000000000\n", string(m.MarshalLine()))
+	})
+
+	t.Run("should fall back to the field value once the override is cleared", func(t *testing.T) {
+		m, err := NewModel(&testTrade{Pair: "BTC-USD", Price: 1, TS: time.Unix(1, 0)})
+		assert.Nil(t, err)
+
+		m.SetTimestamp(time.Unix(2, 0))
+		m.SetTimestamp(time.Time{})
+
+		assert.Equal(t, "test_trades,pair=BTC-USD price=1 1000000000\n", string(m.MarshalLine()))
+	})
+}
+
+func TestModel_PointerDesignatedTS(t *testing.T) {
+	type trade struct {
+		Price float64    `qdb:"price;double"`
+		TS    *time.Time `qdb:"ts;timestamp;designatedTS:true"`
+	}
+
+	t.Run("should end the line with the pointed to time", func(t *testing.T) {
+		ts := time.Unix(1, 0)
+		line, err := MarshalStruct(trade{Price: 1, TS: &ts})
+		assert.Nil(t, err)
+		assert.Equal(t, "trades price=1 1000000000\n", string(line))
+	})
+
+	t.Run("should return an error for a nil pointer", func(t *testing.T) {
+		_, err := MarshalStruct(trade{Price: 1})
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "designated timestamp pointer is nil")
+
+		server := newTestILPServer(t)
+		client := server.client(t)
+		assert.NotNil(t, client.Write(trade{Price: 1}))
+	})
+
+	t.Run("should not return an error when another timestamp is set", func(t *testing.T) {
+		line, err := MarshalStruct(trade{Price: 1}, WithTimestamp(time.Unix(2, 0)))
+		assert.Nil(t, err)
+		assert.Equal(t, "trades price=1 2000000000\n", string(line))
+
+		_, err = MarshalStruct(trade{Price: 1}, WithStampNowIfZero())
+		assert.Nil(t, err)
+	})
+}
+
+func TestModel_Validate(t *testing.T) {
+	t.Run("should return no error for a valid model", func(t *testing.T) {
+		_, err := NewModel(&testTrade{})
+		assert.Nil(t, err)
+	})
+
+	t.Run("should return an error for multiple designated timestamps", func(t *testing.T) {
+		type twoTimestamps struct {
+			A time.Time `qdb:"a;timestamp;designatedTS:true"`
+			B time.Time `qdb:"b;timestamp;designatedTS:true"`
+		}
+
+		_, err := NewModel(&twoTimestamps{})
+		assert.EqualError(t, err, "multiple designated timestamp fields found")
+	})
+
+	t.Run("should return an error for duplicate column names", func(t *testing.T) {
+		type duplicate struct {
+			A string `qdb:"name;string"`
+			B string `qdb:"name;symbol"`
+		}
+
+		_, err := NewModel(&duplicate{})
+		assert.EqualError(t, err, "column 'name' is mapped by both A and B")
+	})
+
+	t.Run("should return an error naming both fields when an embedded column collides", func(t *testing.T) {
+		type options struct {
+			MaxAge int `qdb:"max_age;long"`
+		}
+		type user struct {
+			Options    options `qdb:"options;embedded;embeddedPrefix:opts_"`
+			OptsMaxAge int     `qdb:"opts_max_age;long"`
+		}
+
+		_, err := NewModel(&user{})
+		assert.EqualError(t, err, "column 'opts_max_age' is mapped by both Options.MaxAge and OptsMaxAge")
+	})
+
+	t.Run("should return an error when two embedded structs share a prefix", func(t *testing.T) {
+		type limits struct {
+			Max int `qdb:"max;long"`
+		}
+		type quotas struct {
+			Max int `qdb:"max;long"`
+		}
+		type account struct {
+			Limits limits `qdb:"limits;embedded;embeddedPrefix:l_"`
+			Quotas quotas `qdb:"quotas;embedded;embeddedPrefix:l_"`
+		}
+
+		_, err := NewModel(&account{})
+		assert.EqualError(t, err, "column 'l_max' is mapped by both Limits.Max and Quotas.Max")
+	})
+
+	t.Run("should aggregate every problem found", func(t *testing.T) {
+		m := &Model{fields: []*field{
+			{name: "A", qdbName: "a", qdbType: Long, tagOptions: tagOptions{designatedTS: true}},
+			{name: "B", qdbName: "a", qdbType: Timestamp, tagOptions: tagOptions{designatedTS: true}},
+		}}
+
+		err := m.Validate()
+		assert.IsType(t, multiError{}, err)
+		assert.Len(t, err.(multiError), 3)
+	})
+}
+
+func TestModel_Duration(t *testing.T) {
+	type request struct {
+		Path    string        `qdb:"path;symbol"`
+		Latency time.Duration `qdb:"latency;long;durationUnit:ms"`
+		Queued  time.Duration `qdb:"queued;int;durationUnit:us"`
+		Raw     time.Duration `qdb:"raw;long"`
+	}
+
+	t.Run("should round trip durations in their configured unit", func(t *testing.T) {
+		written := &request{
+			Path:    "/api",
+			Latency: 1500 * time.Millisecond,
+			Queued:  250 * time.Microsecond,
+			Raw:     42 * time.Nanosecond,
+		}
+		m, err := NewModel(written)
+		assert.Nil(t, err)
+		assert.Equal(t, "requests,path=/api latency=1500i,queued=250i,raw=42i\n", string(m.MarshalLine()))
+
+		db := newTestDB(t, []string{"path", "latency", "queued", "raw"},
+			[]driver.Value{"/api", int64(1500), int64(250), int64(42)})
+
+		read := &request{}
+		err = ScanInto(db.QueryRow("SELECT path, latency, queued, raw FROM requests"), read)
+		assert.Nil(t, err)
+		assert.Equal(t, written, read)
+	})
+
+	t.Run("should return an error for an invalid duration unit", func(t *testing.T) {
+		type invalid struct {
+			Latency time.Duration `qdb:"latency;long;durationUnit:h"`
+		}
+
+		_, err := NewModel(&invalid{})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("should return an error if durationUnit is set on a non duration field", func(t *testing.T) {
+		type invalid struct {
+			Latency int64 `qdb:"latency;long;durationUnit:ms"`
+		}
+
+		_, err := NewModel(&invalid{})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestModel_SetTypeMapper(t *testing.T) {
+	type document struct {
+		Name    string                 `qdb:"name;symbol"`
+		Body    Bytes                  `qdb:"body;binary"`
+		Payload map[string]interface{} `qdb:"payload;json"`
+		Size    int64                  `qdb:"size;long"`
+	}
+
+	t.Run("should map binary and json to string by default", func(t *testing.T) {
+		m, err := NewModel(&document{})
+		assert.Nil(t, err)
+
+		expected := `CREATE TABLE IF NOT EXISTS "documents" ( "name" symbol, "body" string, "payload" string, "size" long, "timestamp" timestamp ) timestamp(timestamp) ;`
+		assert.Equal(t, expected, m.CreateTableIfNotExistStatement())
+	})
+
+	t.Run("should use a custom type mapper for the ddl only", func(t *testing.T) {
+		m, err := NewModel(&document{Name: "a", Size: 3})
+		assert.Nil(t, err)
+
+		m.SetTypeMapper(func(qdbType QuestDBType) QuestDBType {
+			if qdbType == JSON {
+				return "varchar"
+			}
+			return DefaultTypeMapper(qdbType)
+		})
+
+		expected := `CREATE TABLE IF NOT EXISTS "documents" ( "name" symbol, "body" string, "payload" varchar, "size" long, "timestamp" timestamp ) timestamp(timestamp) ;`
+		assert.Equal(t, expected, m.CreateTableIfNotExistStatement())
+		assert.Equal(t, "documents,name=a size=3i\n", string(m.MarshalLine()))
+	})
+}
+
+func TestModel_Char(t *testing.T) {
+	type grade struct {
+		Student string `qdb:"student;symbol"`
+		Letter  rune   `qdb:"letter;char"`
+		Mark    string `qdb:"mark;char"`
+	}
+
+	t.Run("should round trip a char column into rune and string fields", func(t *testing.T) {
+		written := &grade{Student: "a", Letter: 'A', Mark: "A"}
+		m, err := NewModel(written)
+		assert.Nil(t, err)
+		assert.Equal(t, `"A"`, m.fields[1].valueSerialized)
+		assert.Equal(t, `"A"`, m.fields[2].valueSerialized)
+
+		db := newTestDB(t, []string{"student", "letter", "mark"}, []driver.Value{"a", "A", "A"})
+
+		read := &grade{}
+		err = ScanInto(db.QueryRow("SELECT student, letter, mark FROM grades"), read)
+		assert.Nil(t, err)
+		assert.Equal(t, written, read)
+	})
+
+	t.Run("should return an error for strings longer than one character", func(t *testing.T) {
+		_, err := NewModel(&grade{Student: "a", Mark: "AB"})
+		assert.NotNil(t, err)
+
+		db := newTestDB(t, []string{"student", "letter", "mark"}, []driver.Value{"a", "AB", "A"})
+		err = ScanInto(db.QueryRow("SELECT student, letter, mark FROM grades"), &grade{})
+		assert.NotNil(t, err)
+	})
+}
+
+type Audited struct {
+	CreatedAt time.Time `qdb:"created_at;timestamp"`
+	CreatedBy string    `qdb:"created_by;symbol"`
+}
+
+func TestModel_AnonymousEmbedding(t *testing.T) {
+	type account struct {
+		Audited
+		Name string    `qdb:"name;string"`
+		TS   time.Time `qdb:"ts;timestamp;designatedTS:true"`
+	}
+
+	created := time.Unix(10, 0)
+
+	t.Run("should promote the fields of an embedded struct", func(t *testing.T) {
+		m, err := NewModel(&account{Audited: Audited{CreatedAt: created, CreatedBy: "admin"}, Name: "a", TS: time.Unix(20, 0)})
+		assert.Nil(t, err)
+
+		assert.Equal(t, "created_at, created_by, name, ts", m.Columns())
+		assert.Equal(t, "accounts,created_by=admin created_at=10000000t,name=\"a\" 20000000000\n", string(m.MarshalLine()))
+		assert.Equal(t, `CREATE TABLE IF NOT EXISTS "accounts" ( "created_at" timestamp, "created_by" symbol, "name" string, "ts" timestamp ) timestamp(ts) ;`,
+			m.CreateTableIfNotExistStatement())
+	})
+
+	t.Run("should promote the fields of an embedded struct pointer", func(t *testing.T) {
+		type pointerAccount struct {
+			*Audited
+			Name string `qdb:"name;string"`
+		}
+
+		m, err := NewModel(&pointerAccount{Audited: &Audited{CreatedBy: "admin"}, Name: "a"})
+		assert.Nil(t, err)
+
+		assert.Equal(t, "created_at, created_by, name", m.Columns())
+		assert.Equal(t, "pointer_accounts,created_by=admin name=\"a\"\n", string(m.MarshalLine()))
+	})
+
+	t.Run("should scan into the fields of an embedded struct", func(t *testing.T) {
+		db := newTestDB(t, []string{"created_at", "created_by", "name", "ts"},
+			[]driver.Value{created, "admin", "a", time.Unix(20, 0)})
+
+		read := &account{}
+		err := ScanInto(db.QueryRow("SELECT created_at, created_by, name, ts FROM accounts"), read)
+		assert.Nil(t, err)
+		assert.Equal(t, "admin", read.CreatedBy)
+		assert.True(t, created.Equal(read.CreatedAt))
+	})
+}
+
+func TestModel_BoolAsInt(t *testing.T) {
+	type flag struct {
+		Name    string `qdb:"name;symbol"`
+		Enabled bool   `qdb:"enabled;boolean;boolAs:int;commitZeroValue:true"`
+		Visible bool   `qdb:"visible;boolean"`
+	}
+
+	t.Run("should store the field in an int column", func(t *testing.T) {
+		m, err := NewModel(&flag{Name: "a", Enabled: true, Visible: true})
+		assert.Nil(t, err)
+
+		assert.Equal(t, "flags,name=a enabled=1i,visible=true\n", string(m.MarshalLine()))
+		assert.Equal(t, `CREATE TABLE IF NOT EXISTS "flags" ( "name" symbol, "enabled" int, "visible" boolean, "timestamp" timestamp ) timestamp(timestamp) ;`,
+			m.CreateTableIfNotExistStatement())
+
+		m, err = NewModel(&flag{Name: "a"})
+		assert.Nil(t, err)
+		assert.Equal(t, "flags,name=a enabled=0i\n", string(m.MarshalLine()))
+	})
+
+	t.Run("should scan the stored int back into a bool", func(t *testing.T) {
+		db := newTestDB(t, []string{"name", "enabled", "visible"},
+			[]driver.Value{"a", int64(1), true},
+			[]driver.Value{"b", int64(0), false},
+		)
+
+		rows, err := db.Query("SELECT name, enabled, visible FROM flags")
+		assert.Nil(t, err)
+		defer rows.Close()
+
+		read := []flag{}
+		for rows.Next() {
+			f := flag{}
+			assert.Nil(t, ScanRows(rows, &f))
+			read = append(read, f)
+		}
+		assert.Equal(t, []flag{{Name: "a", Enabled: true, Visible: true}, {Name: "b"}}, read)
+	})
+
+	t.Run("should return an error if set on a non boolean field", func(t *testing.T) {
+		type invalid struct {
+			Enabled int32 `qdb:"enabled;int;boolAs:int"`
+		}
+
+		_, err := NewModel(&invalid{})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestModel_Bind(t *testing.T) {
+	t.Run("should rebind the model to another value of the same type", func(t *testing.T) {
+		m, err := NewModel(&testTrade{Pair: "BTC-USD", Price: 1.5, TS: time.Unix(1, 0)})
+		assert.Nil(t, err)
+
+		err = m.Bind(&testTrade{Pair: "ETH-USD", Price: 2.5, TS: time.Unix(2, 0)})
+		assert.Nil(t, err)
+		assert.Equal(t, "test_trades,pair=ETH-USD price=2.5 2000000000\n", string(m.MarshalLine()))
+
+		err = m.Bind(testTrade{Pair: "SOL-USD"})
+		assert.Nil(t, err)
+		assert.Equal(t, "test_trades,pair=SOL-USD\n", string(m.MarshalLine()))
+	})
+
+	t.Run("should move a sharded model to the shard of each rebound value", func(t *testing.T) {
+		m, err := NewModel(&testEvent{Name: "a", Received: time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)})
+		assert.Nil(t, err)
+		assert.Nil(t, applyOptions(m, []option{WithShardedTable("events", "received")}))
+		assert.Equal(t, "events_2024_01", m.tableName)
+
+		assert.Nil(t, m.Bind(&testEvent{Name: "b", Received: time.Date(2024, time.February, 2, 0, 0, 0, 0, time.UTC)}))
+		assert.Equal(t, "events_2024_02", m.tableName)
+		assert.Equal(t, "events_2024_02,name=b received=1706832000000000t\n", string(m.MarshalLine()))
+	})
+
+	t.Run("should rebind the fields of embedded structs", func(t *testing.T) {
+		type pointerAccount struct {
+			*Audited
+			Name string `qdb:"name;string"`
+		}
+
+		m, err := NewModel(&pointerAccount{Audited: &Audited{CreatedBy: "admin"}, Name: "a"})
+		assert.Nil(t, err)
+
+		err = m.Bind(&pointerAccount{Audited: &Audited{CreatedBy: "root"}, Name: "b"})
+		assert.Nil(t, err)
+		assert.Equal(t, "pointer_accounts,created_by=root name=\"b\"\n", string(m.MarshalLine()))
+
+		err = m.Bind(&pointerAccount{Name: "c"})
+		assert.Nil(t, err)
+		assert.Equal(t, "pointer_accounts name=\"c\"\n", string(m.MarshalLine()))
+	})
+
+	t.Run("should scan into the rebound value", func(t *testing.T) {
+		db := newTestDB(t, []string{"pair", "price", "ts"},
+			[]driver.Value{"BTC-USD", 1.5, time.Unix(1, 0)})
+
+		m, err := NewModel(&testTrade{})
+		assert.Nil(t, err)
+
+		read := &testTrade{}
+		assert.Nil(t, m.Bind(read))
+		addrs, err := m.destinations()
+		assert.Nil(t, err)
+		err = db.QueryRow("SELECT pair, price, ts FROM test_trades").Scan(addrs...)
+		assert.Nil(t, err)
+		assert.Equal(t, "BTC-USD", read.Pair)
+		assert.Equal(t, 1.5, read.Price)
+	})
+
+	t.Run("should return an error if the type does not match", func(t *testing.T) {
+		m, err := NewModel(&testTrade{})
+		assert.Nil(t, err)
+
+		assert.NotNil(t, m.Bind(&testRow{}))
+		assert.NotNil(t, m.Bind(nil))
+	})
+}
+
+func TestModel_LatestOnStatement(t *testing.T) {
+	type quote struct {
+		Pair     string    `qdb:"pair;symbol;index:true"`
+		Exchange string    `qdb:"exchange;symbol"`
+		Price    float64   `qdb:"price;double"`
+		TS       time.Time `qdb:"ts;timestamp;designatedTS:true"`
+	}
+
+	m, err := NewModel(&quote{})
+	assert.Nil(t, err)
+
+	t.Run("should partition by the indexed fields by default", func(t *testing.T) {
+		stmt, err := m.LatestOnStatement()
+		assert.Nil(t, err)
+		assert.Equal(t, `SELECT pair, exchange, price, ts FROM "quotes" LATEST ON ts PARTITION BY pair`, stmt)
+	})
+
+	t.Run("should partition by the given columns", func(t *testing.T) {
+		stmt, err := m.LatestOnStatement("pair", "exchange")
+		assert.Nil(t, err)
+		assert.Equal(t, `SELECT pair, exchange, price, ts FROM "quotes" LATEST ON ts PARTITION BY pair, exchange`, stmt)
+	})
+
+	t.Run("should return an error if a partition column is unknown", func(t *testing.T) {
+		_, err := m.LatestOnStatement("symbol")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("should return an error without a designated timestamp", func(t *testing.T) {
+		m, err := NewModel(&testRow{})
+		assert.Nil(t, err)
+
+		_, err = m.LatestOnStatement("name")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("should return an error without partition columns", func(t *testing.T) {
+		m, err := NewModel(&testTrade{})
+		assert.Nil(t, err)
+
+		_, err = m.LatestOnStatement()
+		assert.NotNil(t, err)
+	})
+}
+
+func TestModel_SymbolOrder(t *testing.T) {
+	t.Run("should write ordered symbols first and the rest in field order", func(t *testing.T) {
+		type order struct {
+			Account  string  `qdb:"account;symbol"`
+			Side     string  `qdb:"side;symbol;symbolOrder:1"`
+			Exchange string  `qdb:"exchange;symbol;symbolOrder:0"`
+			Desk     string  `qdb:"desk;symbol"`
+			Price    float64 `qdb:"price;double"`
+		}
+
+		m, err := NewModel(&order{Account: "acc", Side: "buy", Exchange: "nyse", Desk: "d1", Price: 1})
+		assert.Nil(t, err)
+		assert.Equal(t, "orders,exchange=nyse,side=buy,account=acc,desk=d1 price=1\n", string(m.MarshalLine()))
+		assert.Equal(t, "account, side, exchange, desk, price", m.Columns())
+	})
+
+	t.Run("should return an error if the option is invalid", func(t *testing.T) {
+		type notSymbol struct {
+			Price float64 `qdb:"price;double;symbolOrder:1"`
+		}
+		_, err := NewModel(&notSymbol{})
+		assert.NotNil(t, err)
+
+		type negative struct {
+			Side string `qdb:"side;symbol;symbolOrder:-1"`
+		}
+		_, err = NewModel(&negative{})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestScanAll(t *testing.T) {
+	db := newTestDB(t, []string{"pair", "price", "ts"},
+		[]driver.Value{"BTC-USD", 1.5, time.Unix(1, 0)},
+		[]driver.Value{"ETH-USD", 2.5, time.Unix(2, 0)},
+	)
+
+	t.Run("should scan every row into a slice of structs", func(t *testing.T) {
+		rows, err := db.Query("SELECT pair, price, ts FROM test_trades")
+		assert.Nil(t, err)
+		defer rows.Close()
+
+		trades := []testTrade{}
+		assert.Nil(t, ScanAll(rows, &trades))
+		assert.Len(t, trades, 2)
+		assert.Equal(t, "BTC-USD", trades[0].Pair)
+		assert.Equal(t, 2.5, trades[1].Price)
+		assert.True(t, time.Unix(2, 0).Equal(trades[1].TS))
+	})
+
+	t.Run("should scan every row into a slice of struct pointers", func(t *testing.T) {
+		rows, err := db.Query("SELECT pair, price, ts FROM test_trades")
+		assert.Nil(t, err)
+		defer rows.Close()
+
+		trades := []*testTrade{}
+		assert.Nil(t, ScanAll(rows, &trades))
+		assert.Len(t, trades, 2)
+		assert.Equal(t, "BTC-USD", trades[0].Pair)
+		assert.Equal(t, "ETH-USD", trades[1].Pair)
+	})
+
+	t.Run("should return an error if dest is not a pointer to a slice", func(t *testing.T) {
+		rows, err := db.Query("SELECT pair, price, ts FROM test_trades")
+		assert.Nil(t, err)
+		defer rows.Close()
+
+		assert.NotNil(t, ScanAll(rows, []testTrade{}))
+	})
+}
+
+func benchmarkScanDB(b *testing.B) *sql.DB {
+	rows := make([][]driver.Value, 1000)
+	for i := range rows {
+		rows[i] = []driver.Value{"BTC-USD", float64(i), time.Unix(int64(i), 0)}
+	}
+	return newTestDB(b, []string{"pair", "price", "ts"}, rows...)
+}
+
+func BenchmarkScanRows(b *testing.B) {
+	db := benchmarkScanDB(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rows, err := db.Query("SELECT pair, price, ts FROM test_trades")
+		if err != nil {
+			b.Fatal(err)
+		}
+		trades := []testTrade{}
+		for rows.Next() {
+			trade := testTrade{}
+			if err := ScanRows(rows, &trade); err != nil {
+				b.Fatal(err)
+			}
+			trades = append(trades, trade)
+		}
+		rows.Close()
+	}
+}
+
+func BenchmarkScanAll(b *testing.B) {
+	db := benchmarkScanDB(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rows, err := db.Query("SELECT pair, price, ts FROM test_trades")
+		if err != nil {
+			b.Fatal(err)
+		}
+		trades := []testTrade{}
+		if err := ScanAll(rows, &trades); err != nil {
+			b.Fatal(err)
+		}
+		rows.Close()
+	}
+}
+
+func TestModel_TimeFormat(t *testing.T) {
+	type holiday struct {
+		Name string `qdb:"name;symbol"`
+		Day  string `qdb:"day;date;timeFormat:2006-01-02"`
+		At   string `qdb:"at;timestamp;timeFormat:2006-01-02 15:04:05"`
+	}
+
+	t.Run("should parse the string with the layout", func(t *testing.T) {
+		m, err := NewModel(&holiday{Name: "new_year", Day: "2022-01-01", At: "2022-01-01 00:00:01"})
+		assert.Nil(t, err)
+		assert.Equal(t, "holidays,name=new_year day=1640995200000i,at=1640995201000000t\n", string(m.MarshalLine()))
+		assert.Equal(t, `CREATE TABLE IF NOT EXISTS "holidays" ( "name" symbol, "day" date, "at" timestamp, "timestamp" timestamp ) timestamp(timestamp) ;`,
+			m.CreateTableIfNotExistStatement())
+	})
+
+	t.Run("should return an error naming the field if the string does not parse", func(t *testing.T) {
+		_, err := NewModel(&holiday{Day: "01/01/2022"})
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "Day")
+	})
+
+	t.Run("should format the scanned time with the layout", func(t *testing.T) {
+		db := newTestDB(t, []string{"name", "day", "at"},
+			[]driver.Value{"new_year", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2022, 1, 1, 0, 0, 1, 0, time.UTC)})
+
+		read := &holiday{}
+		err := ScanInto(db.QueryRow("SELECT name, day, at FROM holidays"), read)
+		assert.Nil(t, err)
+		assert.Equal(t, holiday{Name: "new_year", Day: "2022-01-01", At: "2022-01-01 00:00:01"}, *read)
+	})
+
+	t.Run("should return an error if set on a non string field", func(t *testing.T) {
+		type invalid struct {
+			Day time.Time `qdb:"day;date;timeFormat:2006-01-02"`
+		}
+		_, err := NewModel(&invalid{})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestModel_ConfirmQuery(t *testing.T) {
+	m, err := NewModel(&testTrade{Pair: "BTC-USD", Price: 1, TS: time.Unix(1, 1500)})
+	assert.Nil(t, err)
+
+	query, args, err := m.confirmQuery()
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT count() FROM "test_trades" WHERE "ts" = $1 AND "pair" = $2`, query)
+	assert.Equal(t, []interface{}{time.Unix(1, 1000).UTC(), "BTC-USD"}, args)
+}
+
+func TestModel_TimestampRange(t *testing.T) {
+	t.Run("should write pre 1970 timestamps as negative nanoseconds", func(t *testing.T) {
+		ts := time.Date(1950, 1, 1, 0, 0, 0, 0, time.UTC)
+		m, err := NewModel(&testTrade{Pair: "BTC-USD", Price: 1, TS: ts})
+		assert.Nil(t, err)
+
+		line, err := m.marshalLine()
+		assert.Nil(t, err)
+		assert.Equal(t, "test_trades,pair=BTC-USD price=1 -631152000000000000\n", string(line))
+	})
+
+	t.Run("should return an error for timestamps beyond the nanosecond range", func(t *testing.T) {
+		ts := time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC)
+		_, err := NewModel(&testTrade{Pair: "BTC-USD", Price: 1, TS: ts})
+		assert.NotNil(t, err)
+
+		m, err := NewModel(&testTrade{Pair: "BTC-USD", Price: 1})
+		assert.Nil(t, err)
+		m.SetTimestamp(ts)
+		_, err = m.marshalLine()
+		assert.NotNil(t, err)
+		assert.Equal(t, "test_trades,pair=BTC-USD price=1\n", string(m.MarshalLine()))
+	})
+}
+
+type testService struct {
+	Latency int64 `qdb:"latency;long"`
+}
+
+func (testService) DefaultSymbols() map[string]string {
+	return map[string]string{"service": "api gateway", "env": "prod"}
+}
+
+func TestModel_DefaultSymbols(t *testing.T) {
+	t.Run("should write default symbols with every line", func(t *testing.T) {
+		m, err := NewModel(&testService{Latency: 5})
+		assert.Nil(t, err)
+
+		assert.Equal(t, "test_services,env=prod,service=api\\ gateway latency=5i\n", string(m.MarshalLine()))
+		assert.Equal(t, `CREATE TABLE IF NOT EXISTS "test_services" ( "latency" long, "env" symbol, "service" symbol, "timestamp" timestamp ) timestamp(timestamp) ;`,
+			m.CreateTableIfNotExistStatement())
+	})
+
+	t.Run("should return an error if a default symbol collides with a field", func(t *testing.T) {
+		m, err := NewModel(&testService{})
+		assert.Nil(t, err)
+		m.defaultSymbols["latency"] = "x"
+
+		assert.NotNil(t, m.Validate())
+	})
+}
+
+func TestScanInto_Embedded(t *testing.T) {
+	type options struct {
+		MaxAge    int64  `qdb:"max_age;long"`
+		LengthMax string `qdb:"length_max;string"`
+	}
+
+	type user struct {
+		Name    string   `qdb:"name;string"`
+		Options options  `qdb:"options;embedded;embeddedPrefix:opts_"`
+		Limits  *options `qdb:"limits;embedded;embeddedPrefix:limits_"`
+		*Audited
+	}
+
+	columns := []string{"name", "opts_max_age", "opts_length_max", "limits_max_age", "limits_length_max", "created_at", "created_by"}
+	created := time.Unix(10, 0)
+	db := newTestDB(t, columns, []driver.Value{"john", int64(45), "455", int64(7), "10", created, "admin"})
+
+	t.Run("should scan into embedded and nil embedded pointer fields", func(t *testing.T) {
+		m, err := NewModel(&user{})
+		assert.Nil(t, err)
+		assert.Equal(t, strings.Join(columns, ", "), m.Columns())
+
+		read := &user{}
+		err = ScanInto(db.QueryRow("SELECT "+m.Columns()+" FROM users"), read)
+		assert.Nil(t, err)
+		assert.Equal(t, "john", read.Name)
+		assert.Equal(t, options{MaxAge: 45, LengthMax: "455"}, read.Options)
+		assert.Equal(t, &options{MaxAge: 7, LengthMax: "10"}, read.Limits)
+		if assert.NotNil(t, read.Audited) {
+			assert.Equal(t, "admin", read.CreatedBy)
+			assert.True(t, created.Equal(read.CreatedAt))
+		}
+	})
+
+	t.Run("should round trip an embedded struct through marshaling and scanning", func(t *testing.T) {
+		written := &user{Name: "john", Options: options{MaxAge: 45, LengthMax: "455"}}
+		m, err := NewModel(written)
+		assert.Nil(t, err)
+		assert.Equal(t, "users name=\"john\",opts_max_age=45i,opts_length_max=\"455\"\n", string(m.MarshalLine()))
+
+		rows, err := db.Query("SELECT " + m.Columns() + " FROM users")
+		assert.Nil(t, err)
+		defer rows.Close()
+
+		read := []user{}
+		assert.Nil(t, ScanAll(rows, &read))
+		assert.Len(t, read, 1)
+		assert.Equal(t, written.Options, read[0].Options)
+	})
+
+	t.Run("should return an error if dest is not a pointer", func(t *testing.T) {
+		err := ScanInto(db.QueryRow("SELECT "+strings.Join(columns, ", ")+" FROM users"), user{})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestModel_EmitEmptySymbol(t *testing.T) {
+	type event struct {
+		Region *string `qdb:"region;symbol;emitEmptySymbol:true"`
+		Zone   string  `qdb:"zone;symbol;emitEmptySymbol:true"`
+		Host   string  `qdb:"host;symbol"`
+		Note   *string `qdb:"note;string;commitZeroValue:true"`
+		Count  int64   `qdb:"count;long"`
+	}
+
+	t.Run("should write empty symbols and omit nil ones", func(t *testing.T) {
+		empty := ""
+		m, err := NewModel(&event{Region: &empty, Count: 1})
+		assert.Nil(t, err)
+		assert.Equal(t, "events,region=,zone= count=1i\n", string(m.MarshalLine()))
+
+		m, err = NewModel(&event{Count: 1})
+		assert.Nil(t, err)
+		assert.Equal(t, "events,zone= count=1i\n", string(m.MarshalLine()))
+	})
+
+	t.Run("should write empty strings of committed zero value string fields", func(t *testing.T) {
+		empty := ""
+		m, err := NewModel(&event{Zone: "z", Note: &empty})
+		assert.Nil(t, err)
+		assert.Equal(t, "events,zone=z note=\"\"\n", string(m.MarshalLine()))
+	})
+
+	t.Run("should return an error if set on a non symbol field", func(t *testing.T) {
+		type invalid struct {
+			Name string `qdb:"name;string;emitEmptySymbol:true"`
+		}
+		_, err := NewModel(&invalid{})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestMarshalStruct(t *testing.T) {
+	t.Run("should return the line Client.Write sends", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+		trade := testTrade{Pair: "BTC-USD", Price: 1.5, TS: time.Unix(1, 0)}
+
+		line, err := MarshalStruct(trade, WithTableName("trades"))
+		assert.Nil(t, err)
+		assert.Equal(t, "trades,pair=BTC-USD price=1.5 1000000000\n", string(line))
+
+		assert.Nil(t, client.Write(trade, WithTableName("trades")))
+		assert.Equal(t, string(line), server.waitFor(len(line)))
+	})
+
+	t.Run("should honor WithTimestamp", func(t *testing.T) {
+		line, err := MarshalStruct(&testTrade{Pair: "BTC-USD", Price: 1.5}, WithTimestamp(time.Unix(2, 0)))
+		assert.Nil(t, err)
+		assert.Equal(t, "test_trades,pair=BTC-USD price=1.5 2000000000\n", string(line))
+	})
+
+	t.Run("should marshal a LineMarshaler", func(t *testing.T) {
+		l := NewLine("sensors")
+		assert.Nil(t, l.AddColumn("temp", Double, 1.5))
+		line, err := MarshalStruct(l)
+		assert.Nil(t, err)
+		assert.Equal(t, "sensors temp=1.5\n", string(line))
+	})
+
+	t.Run("should terminate a LineMarshaler's lines like Client.Write", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		sent := ""
+		for _, lm := range []LineMarshaler{testRawLine("raw_lines value=1i"), testRawLine("raw_lines value=2i\n\n")} {
+			line, err := MarshalStruct(lm)
+			assert.Nil(t, err)
+			assert.Nil(t, client.Write(lm))
+			sent += string(line)
+		}
+		assert.Equal(t, "raw_lines value=1i\nraw_lines value=2i\n", sent)
+		assert.Equal(t, sent, server.waitFor(len(sent)))
+	})
+
+	t.Run("should return errors", func(t *testing.T) {
+		_, err := MarshalStruct(testTrade{Pair: "BTC-USD", TS: time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC)})
+		assert.NotNil(t, err)
+
+		_, err = MarshalStruct(testRow{Name: "a"}, WithColumns("missing"))
+		assert.NotNil(t, err)
+
+		_, err = MarshalStruct(1)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestModel_TsUnit(t *testing.T) {
+	type event struct {
+		Name     string `qdb:"name;symbol"`
+		Received int64  `qdb:"received;timestamp;tsUnit:ns"`
+		Raw      int64  `qdb:"raw;timestamp"`
+		TS       int64  `qdb:"ts;timestamp;designatedTS:true;tsUnit:ms"`
+	}
+
+	t.Run("should write epoch timestamps in their configured unit", func(t *testing.T) {
+		written := &event{Name: "a", Received: 1000001000, Raw: 3000000, TS: 2000}
+		m, err := NewModel(written)
+		assert.Nil(t, err)
+		assert.Equal(t, "events,name=a received=1000001t,raw=3000000t 2000000000\n", string(m.MarshalLine()))
+
+		db := newTestDB(t, []string{"name", "received", "raw", "ts"},
+			[]driver.Value{"a", time.Unix(1, 1000), time.Unix(3, 0), time.Unix(2, 0)})
+
+		read := &event{}
+		err = ScanInto(db.QueryRow("SELECT name, received, raw, ts FROM events"), read)
+		assert.Nil(t, err)
+		assert.Equal(t, written, read)
+	})
+
+	t.Run("should leave a zero designated timestamp out of the line", func(t *testing.T) {
+		m, err := NewModel(&event{Name: "a"})
+		assert.Nil(t, err)
+		assert.Equal(t, "events,name=a\n", string(m.MarshalLine()))
+	})
+
+	t.Run("should return an error for an invalid tsUnit", func(t *testing.T) {
+		type invalidUnit struct {
+			TS int64 `qdb:"ts;timestamp;tsUnit:s"`
+		}
+		_, err := NewModel(&invalidUnit{})
+		assert.NotNil(t, err)
+
+		type invalidType struct {
+			TS time.Time `qdb:"ts;timestamp;tsUnit:ms"`
+		}
+		_, err = NewModel(&invalidType{})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestModel_FloatFmt(t *testing.T) {
+	type price float64
+	type quote struct {
+		Bid    float64  `qdb:"bid;double;floatFmt:f:2"`
+		Ask    price    `qdb:"ask;double;floatFmt:g"`
+		Spread *float32 `qdb:"spread;float;floatFmt:e:3"`
+		Mid    float64  `qdb:"mid;double"`
+	}
+
+	t.Run("should format each float with its own format", func(t *testing.T) {
+		spread := float32(0.25)
+		line, err := MarshalStruct(quote{Bid: 1.005, Ask: 1.0123456789, Spread: &spread, Mid: 1.5})
+		assert.Nil(t, err)
+		assert.Equal(t, "quotes bid=1.00,ask=1.0123456789,spread=2.500e-01,mid=1.5\n", string(line))
+	})
+
+	t.Run("should format exploded elements", func(t *testing.T) {
+		type reading struct {
+			Values []float64 `qdb:"value;double;explode:true;floatFmt:f"`
+		}
+		line, err := MarshalStruct(reading{Values: []float64{0.1, 2}})
+		assert.Nil(t, err)
+		assert.Equal(t, "readings value=0.1\nreadings value=2\n", string(line))
+	})
+
+	t.Run("should return an error for invalid formats", func(t *testing.T) {
+		for _, spec := range []string{"x", "ff", "f:-1", "f:two"} {
+			_, _, err := parseFloatFormat(spec)
+			assert.NotNil(t, err, spec)
+		}
+
+		_, err := NewModel(struct {
+			V float64 `qdb:"v;double;floatFmt:d"`
+		}{})
+		assert.NotNil(t, err)
+
+		_, err = NewModel(struct {
+			V int64 `qdb:"v;long;floatFmt:g"`
+		}{})
+		assert.NotNil(t, err)
+
+		_, err = NewModel(struct {
+			V string `qdb:"v;double;floatFmt:g"`
+		}{})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestModel_MarshalLine_NoFields(t *testing.T) {
+	type upsert struct {
+		Name  string    `qdb:"name;symbol"`
+		Value int64     `qdb:"value;long"`
+		Note  string    `qdb:"note;string"`
+		TS    time.Time `qdb:"ts;timestamp;designatedTS:true"`
+	}
+
+	t.Run("should return an error rather than a bare line for an all zero struct", func(t *testing.T) {
+		m, err := NewModel(&upsert{TS: time.Unix(1, 0)})
+		assert.Nil(t, err)
+
+		line, err := m.marshalLine()
+		assert.True(t, errors.Is(err, ErrNoFieldsToWrite))
+		assert.Nil(t, line)
+		assert.Empty(t, m.MarshalLine())
+
+		_, err = MarshalStruct(upsert{})
+		assert.True(t, errors.Is(err, ErrNoFieldsToWrite))
+	})
+
+	t.Run("should write a line with a single field", func(t *testing.T) {
+		line, err := MarshalStruct(upsert{Value: 1})
+		assert.Nil(t, err)
+		assert.Equal(t, "upserts value=1i\n", string(line))
+	})
+}
+
+func TestModel_LineSize(t *testing.T) {
+	t.Run("should return the length of the marshaled line", func(t *testing.T) {
+		for _, v := range []interface{}{
+			&testTrade{Pair: "BTC-USD", Price: 1, TS: time.Unix(1, 0)},
+			&testTrade{Price: 1},
+			&testRow{Name: "a b", Value: 1},
+			&testService{Latency: 5},
+			&testReading{Device: "d1", Sensors: []string{"a", "bc"}, Unit: "c", TS: time.Unix(1, 0)},
+		} {
+			m, err := NewModel(v)
+			assert.Nil(t, err)
+
+			size, err := m.LineSize()
+			assert.Nil(t, err)
+			assert.Equal(t, len(m.MarshalLine()), size)
+		}
+	})
+
+	t.Run("should return the length of the line with sorted columns", func(t *testing.T) {
+		m, err := NewModel(&testService{Latency: 5})
+		assert.Nil(t, err)
+		assert.Nil(t, applyOptions(m, []option{WithSortedColumns()}))
+
+		size, err := m.LineSize()
+		assert.Nil(t, err)
+		assert.Equal(t, len(m.MarshalLine()), size)
+	})
+
+	t.Run("should return an error for a row without fields to write", func(t *testing.T) {
+		m, err := NewModel(&testTrade{TS: time.Unix(1, 0)})
+		assert.Nil(t, err)
+
+		size, err := m.LineSize()
+		assert.True(t, errors.Is(err, ErrNoFieldsToWrite))
+		assert.Equal(t, 0, size)
+	})
+}
+
+func TestModel_MarshalLineOrdered(t *testing.T) {
+	type reading struct {
+		Audited
+		Sensor string    `qdb:"sensor;symbol"`
+		Site   string    `qdb:"site;symbol"`
+		Temp   float64   `qdb:"temp;double"`
+		Count  int64     `qdb:"count;long"`
+		TS     time.Time `qdb:"ts;timestamp;designatedTS:true"`
+	}
+	r := &reading{
+		Audited: Audited{CreatedBy: "admin"},
+		Sensor:  "s1",
+		Site:    "a",
+		Temp:    1.5,
+		Count:   2,
+		TS:      time.Unix(1, 0),
+	}
+
+	t.Run("should write symbols then columns in the given order", func(t *testing.T) {
+		m, err := NewModel(r)
+		assert.Nil(t, err)
+
+		line, err := m.MarshalLineOrdered([]string{"count", "site", "created_by", "ts", "sensor", "temp"})
+		assert.Nil(t, err)
+		assert.Equal(t, "readings,site=a,created_by=admin,sensor=s1 count=2i,temp=1.5 1000000000\n", string(line))
+	})
+
+	t.Run("should write unnamed columns after the named ones in their usual order", func(t *testing.T) {
+		m, err := NewModel(r)
+		assert.Nil(t, err)
+
+		line, err := m.MarshalLineOrdered([]string{"temp"})
+		assert.Nil(t, err)
+		assert.Equal(t, "readings,created_by=admin,sensor=s1,site=a temp=1.5,count=2i 1000000000\n", string(line))
+	})
+
+	t.Run("should return an error for unknown or repeated names", func(t *testing.T) {
+		m, err := NewModel(r)
+		assert.Nil(t, err)
+
+		_, err = m.MarshalLineOrdered([]string{"missing"})
+		assert.NotNil(t, err)
+
+		_, err = m.MarshalLineOrdered([]string{"temp", "temp"})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestModel_NamedTypes(t *testing.T) {
+	type person struct {
+		Name    testSymbol `qdb:"name;symbol"`
+		Age     testAge    `qdb:"age;short"`
+		Score   testScore  `qdb:"score;double"`
+		Active  testFlag   `qdb:"active;boolean;boolAs:int"`
+		Created testCount  `qdb:"created;timestamp;tsUnit:ms"`
+	}
+
+	t.Run("should write named types as their underlying type", func(t *testing.T) {
+		m, err := NewModel(&person{Name: "a", Age: 42, Score: 1.5, Active: true, Created: 1000})
+		assert.Nil(t, err)
+
+		line, err := m.marshalLine()
+		assert.Nil(t, err)
+		assert.Equal(t, "persons,name=a age=42i,score=1.5,active=1i,created=1000000t\n", string(line))
+	})
+
+	t.Run("should scan into named types", func(t *testing.T) {
+		db := newTestDB(t, []string{"name", "age", "score"}, []driver.Value{"a", int64(42), 1.5})
+
+		type named struct {
+			Name  testSymbol `qdb:"name;symbol"`
+			Age   testAge    `qdb:"age;short"`
+			Score testScore  `qdb:"score;double"`
+		}
+		read := &named{}
+		assert.Nil(t, ScanInto(db.QueryRow("SELECT name, age, score FROM people"), read))
+		assert.Equal(t, &named{Name: "a", Age: 42, Score: 1.5}, read)
+	})
+}
+
+func TestModel_GoTypeCheck(t *testing.T) {
+	t.Run("should reject fields whose go type does not match their qdb type", func(t *testing.T) {
+		type invalid struct {
+			Count string `qdb:"count;int"`
+		}
+		_, err := NewModel(&invalid{Count: "1"})
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "Count")
+		assert.Contains(t, err.Error(), "go type string is not compatible with int")
+
+		type pointer struct {
+			Price *int64 `qdb:"price;double"`
+		}
+		_, err = NewModel(&pointer{})
+		assert.NotNil(t, err)
+
+		type exploded struct {
+			Tags []int `qdb:"tag;symbol;explode:true"`
+		}
+		_, err = NewModel(&exploded{})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("should accept fields converted by their tag options", func(t *testing.T) {
+		type converted struct {
+			Day     string        `qdb:"day;date;timeFormat:2006-01-02"`
+			Elapsed time.Duration `qdb:"elapsed;long;durationUnit:ms"`
+			Active  bool          `qdb:"active;boolean;boolAs:int"`
+			Created *testCount    `qdb:"created;timestamp;tsUnit:ms"`
+			Payload interface{}   `qdb:"payload;string"`
+		}
+		_, err := NewModel(&converted{})
+		assert.Nil(t, err)
+	})
+
+	t.Run("should reject fields whose tag options cannot convert them", func(t *testing.T) {
+		// the layout formats the 1st of January as "11", which it parses as the 11th day of no month
+		type unparsable struct {
+			Day string `qdb:"day;date;timeFormat:21"`
+		}
+		_, err := NewModel(&unparsable{Day: "11"})
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "Day: time format '21' cannot parse the times it formats")
+	})
+}
+
+// testStatus is a string backed enum
+type testStatus string
+
+func (testStatus) ValidSymbols() []string {
+	return []string{"open", "closed"}
+}
+
+// testPriority is a ValidSymboler which is not string backed
+type testPriority int
+
+func (*testPriority) ValidSymbols() []string {
+	return []string{"1"}
+}
+
+func TestModel_ValidSymbols(t *testing.T) {
+	type order struct {
+		Status testStatus  `qdb:"status;symbol"`
+		Prev   *testStatus `qdb:"prev;symbol"`
+	}
+
+	t.Run("should write valid symbols", func(t *testing.T) {
+		prev := testStatus("open")
+		m, err := NewModel(&order{Status: "closed", Prev: &prev})
+		assert.Nil(t, err)
+
+		line, err := m.marshalLine()
+		assert.Nil(t, err)
+		assert.Equal(t, "orders,status=closed,prev=open\n", string(line))
+	})
+
+	t.Run("should return an error for values out of the set", func(t *testing.T) {
+		_, err := NewModel(&order{Status: "opne"})
+		assert.True(t, errors.Is(err, ErrInvalidSymbol))
+		assert.Contains(t, err.Error(), "'opne' is not one of [closed, open]")
+
+		typo := testStatus("clsoed")
+		_, err = NewModel(&order{Status: "open", Prev: &typo})
+		assert.True(t, errors.Is(err, ErrInvalidSymbol))
+	})
+
+	t.Run("should require string backed types", func(t *testing.T) {
+		type invalid struct {
+			Priority testPriority `qdb:"priority;long"`
+		}
+		_, err := NewModel(&invalid{})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestModel_Fields(t *testing.T) {
+	m, err := NewModel(&testTrade{})
+	assert.Nil(t, err)
+
+	fields := m.Fields()
+	assert.Equal(t, 3, len(fields))
+	assert.Equal(t, FieldInfo{Name: "Pair", Column: "pair", Type: Symbol, GoType: fields[0].GoType}, fields[0])
+	assert.Equal(t, "TS", fields[2].Name)
+	assert.True(t, fields[2].DesignatedTS)
+}
+
+type testQuote struct {
+	Pair     string    `qdb:"pair;symbol;index:true"`
+	Exchange string    `qdb:"exchange;symbol"`
+	BidPrice float64   `qdb:"bid_price;double"`
+	TS       time.Time `qdb:"ts;timestamp;designatedTS:true"`
+}
+
+func (testQuote) CreateTableOptions() CreateTableOptions {
+	return CreateTableOptions{PartitionBy: Day}
+}
+
+func TestModel_CreateTableStatementPretty(t *testing.T) {
+	t.Run("should write one aligned column per line", func(t *testing.T) {
+		m, err := NewModel(&testQuote{})
+		assert.Nil(t, err)
+
+		expected := `CREATE TABLE IF NOT EXISTS "test_quotes" (
+    "pair"      symbol,
+    "exchange"  symbol,
+    "bid_price" double,
+    "ts"        timestamp
+), index(pair) timestamp(ts) PARTITION BY DAY;`
+		assert.Equal(t, expected, m.CreateTableStatementPretty())
+		assert.Equal(t, `CREATE TABLE IF NOT EXISTS "test_quotes" ( "pair" symbol, "exchange" symbol, "bid_price" double, "ts" timestamp ) , index(pair) timestamp(ts) PARTITION BY DAY ;`,
+			m.CreateTableIfNotExistStatement())
+	})
+
+	t.Run("should declare the default timestamp column", func(t *testing.T) {
+		m, err := NewModel(&testRow{})
+		assert.Nil(t, err)
+
+		expected := `CREATE TABLE IF NOT EXISTS "test_rows" (
+    "name"      symbol,
+    "value"     long,
+    "timestamp" timestamp
+) timestamp(timestamp);`
+		assert.Equal(t, expected, m.CreateTableStatementPretty())
+	})
+}
+
+func TestCreateTableFromSpec(t *testing.T) {
+	t.Run("should build the statement of the columns", func(t *testing.T) {
+		statement, err := CreateTableFromSpec("test_quotes", []ColumnSpec{
+			{Name: "pair", Type: Symbol, Indexed: true},
+			{Name: "exchange", Type: Symbol},
+			{Name: "bid_price", Type: Double},
+			{Name: "ts", Type: Timestamp, DesignatedTS: true},
+		}, CreateTableOptions{PartitionBy: Day})
+		assert.Nil(t, err)
+		assert.Equal(t, `CREATE TABLE IF NOT EXISTS "test_quotes" ( "pair" symbol, "exchange" symbol, "bid_price" double, "ts" timestamp ) `+
+			`, index("pair") timestamp("ts") PARTITION BY DAY ;`, statement)
+	})
+
+	t.Run("should map types and declare the default timestamp column", func(t *testing.T) {
+		statement, err := CreateTableFromSpec("blobs", []ColumnSpec{
+			{Name: "data", Type: Binary},
+		}, CreateTableOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, `CREATE TABLE IF NOT EXISTS "blobs" ( "data" string, "timestamp" timestamp ) timestamp("timestamp") ;`, statement)
+	})
+
+	t.Run("should quote the names of the index and timestamp clauses", func(t *testing.T) {
+		statement, err := CreateTableFromSpec("events", []ColumnSpec{
+			{Name: `the "kind"`, Type: Symbol, Indexed: true},
+			{Name: "order", Type: Timestamp, DesignatedTS: true},
+		}, CreateTableOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, `CREATE TABLE IF NOT EXISTS "events" ( "the ""kind""" symbol, "order" timestamp ) , index("the ""kind""") timestamp("order") ;`, statement)
+	})
+
+	t.Run("should return an error for invalid columns", func(t *testing.T) {
+		invalid := [][]ColumnSpec{
+			{{Name: "", Type: Symbol}},
+			{{Name: "price", Type: Double, Indexed: true}},
+			{{Name: "ts", Type: Long, DesignatedTS: true}},
+			{{Name: "Timestamp", Type: Timestamp}},
+		}
+		for _, columns := range invalid {
+			_, err := CreateTableFromSpec("events", columns, CreateTableOptions{})
+			assert.NotNil(t, err, "%v", columns)
+		}
+
+		// a column named timestamp is fine if it is the designated timestamp or there is none
+		_, err := CreateTableFromSpec("events", []ColumnSpec{{Name: "timestamp", Type: Timestamp, DesignatedTS: true}}, CreateTableOptions{})
+		assert.Nil(t, err)
+		_, err = CreateTableFromSpec("events", []ColumnSpec{{Name: "timestamp", Type: Timestamp}}, CreateTableOptions{NoDesignatedTimestamp: true})
+		assert.Nil(t, err)
+	})
+}
+
+// testSetting is a plain table without a designated timestamp
+type testSetting struct {
+	Key   string `qdb:"key;symbol"`
+	Value string `qdb:"value;string"`
+}
+
+func (testSetting) CreateTableOptions() CreateTableOptions {
+	return CreateTableOptions{NoDesignatedTimestamp: true}
+}
+
+func TestModel_NoDesignatedTimestamp(t *testing.T) {
+	t.Run("should create a plain table without timestamp artifacts", func(t *testing.T) {
+		m, err := NewModel(&testSetting{})
+		assert.Nil(t, err)
+
+		statement := m.CreateTableIfNotExistStatement()
+		assert.Equal(t, `CREATE TABLE IF NOT EXISTS "test_settings" ( "key" symbol, "value" string ) ;`, statement)
+		assert.NotContains(t, statement, "timestamp")
+		assert.Equal(t, `CREATE TABLE IF NOT EXISTS "test_settings" (
+    "key"   symbol,
+    "value" string
+);`, m.CreateTableStatementPretty())
+
+		specStatement, err := CreateTableFromSpec("test_settings", []ColumnSpec{
+			{Name: "key", Type: Symbol},
+			{Name: "value", Type: String},
+		}, CreateTableOptions{NoDesignatedTimestamp: true})
+		assert.Nil(t, err)
+		assert.Equal(t, statement, specStatement)
+	})
+
+	t.Run("should keep a designated timestamp field as a plain column", func(t *testing.T) {
+		m, err := NewModel(&testTrade{})
+		assert.Nil(t, err)
+		m.createTableOptions = &CreateTableOptions{NoDesignatedTimestamp: true}
+
+		assert.Equal(t, `CREATE TABLE IF NOT EXISTS "test_trades" ( "pair" symbol, "price" double, "ts" timestamp ) ;`,
+			m.CreateTableIfNotExistStatement())
+	})
+
+	t.Run("should not be partitioned", func(t *testing.T) {
+		m, err := NewModel(&testSetting{})
+		assert.Nil(t, err)
+		m.createTableOptions = &CreateTableOptions{NoDesignatedTimestamp: true, PartitionBy: Day}
+		assert.NotNil(t, m.Validate())
+
+		m.createTableOptions.PartitionBy = None
+		assert.Nil(t, m.Validate())
+	})
+}
+
+func TestModel_SampleByStatement(t *testing.T) {
+	m, err := NewModel(&testQuote{})
+	assert.Nil(t, err)
+
+	t.Run("should aggregate the given columns in field order", func(t *testing.T) {
+		stmt, err := m.SampleByStatement("1h", map[string]string{"bid_price": "avg", "pair": ""})
+		assert.Nil(t, err)
+		assert.Equal(t, `SELECT pair, avg(bid_price) bid_price, ts FROM "test_quotes" SAMPLE BY 1h`, stmt)
+	})
+
+	t.Run("should return an error for an invalid interval", func(t *testing.T) {
+		for _, interval := range []string{"", "h", "1x", "1h; DROP TABLE test_quotes"} {
+			_, err := m.SampleByStatement(interval, map[string]string{"bid_price": "avg"})
+			assert.NotNil(t, err, interval)
+		}
+	})
+
+	t.Run("should return an error for invalid aggregates", func(t *testing.T) {
+		_, err := m.SampleByStatement("1h", nil)
+		assert.NotNil(t, err)
+
+		_, err = m.SampleByStatement("1h", map[string]string{"price": "avg"})
+		assert.NotNil(t, err)
+
+		_, err = m.SampleByStatement("1h", map[string]string{"ts": "max"})
+		assert.NotNil(t, err)
+
+		_, err = m.SampleByStatement("1h", map[string]string{"bid_price": "avg(1)"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("should return an error without a designated timestamp", func(t *testing.T) {
+		m, err := NewModel(&testRow{})
+		assert.Nil(t, err)
+
+		_, err = m.SampleByStatement("1h", map[string]string{"value": "sum"})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestModel_ValidateSymbolPlacement(t *testing.T) {
+	symbolsAsStrings := func(qdbType QuestDBType) QuestDBType {
+		if qdbType == Symbol {
+			return String
+		}
+		return DefaultTypeMapper(qdbType)
+	}
+
+	t.Run("should return an error if a symbol is declared string", func(t *testing.T) {
+		m, err := NewModel(&testTrade{})
+		assert.Nil(t, err)
+		m.SetTypeMapper(symbolsAsStrings)
+
+		err = m.Validate()
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "symbol column 'pair' is declared string")
+	})
+
+	t.Run("should return an error if a string is declared symbol", func(t *testing.T) {
+		type tagged struct {
+			Label string `qdb:"label;string"`
+		}
+		m, err := NewModel(&tagged{})
+		assert.Nil(t, err)
+		m.SetTypeMapper(func(qdbType QuestDBType) QuestDBType {
+			if qdbType == String {
+				return Symbol
+			}
+			return qdbType
+		})
+
+		assert.NotNil(t, m.Validate())
+	})
+
+	t.Run("should fail client writes with a mismatching type mapper", func(t *testing.T) {
+		client, err := New(Config{TypeMapper: symbolsAsStrings})
+		assert.Nil(t, err)
+
+		_, err = client.newModel(&testTrade{}, nil)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestShardedTableName(t *testing.T) {
+	ts := time.Date(2024, time.January, 15, 13, 4, 5, 0, time.UTC)
+
+	t.Run("should name the table by the time bucket of the partition option", func(t *testing.T) {
+		assert.Equal(t, "events_2024", ShardedTableName("events", ts, Year))
+		assert.Equal(t, "events_2024_01", ShardedTableName("events", ts, Month))
+		assert.Equal(t, "events_2024_01_15", ShardedTableName("events", ts, Day))
+		assert.Equal(t, "events_2024_01_15_13", ShardedTableName("events", ts, Hour))
+		assert.Equal(t, "events", ShardedTableName("events", ts, None))
+	})
+
+	t.Run("should bucket the time in UTC", func(t *testing.T) {
+		local := ts.Add(11 * time.Hour).In(time.FixedZone("UTC+12", 12*60*60))
+		assert.Equal(t, "events_2024_01_16_00", ShardedTableName("events", local, Hour))
+		assert.Equal(t, "events_2024_01_15", ShardedTableName("events", ts.In(time.FixedZone("UTC-5", -5*60*60)), Day))
+	})
+}
+
+func TestModel_ScanNull(t *testing.T) {
+	type reading struct {
+		Sensor   string         `qdb:"sensor;symbol"`
+		Value    float64        `qdb:"value;double"`
+		ValuePtr *float64       `qdb:"value_ptr;double"`
+		Count    int32          `qdb:"count;int"`
+		CountPtr *int32         `qdb:"count_ptr;int"`
+		Note     string         `qdb:"note;string"`
+		NotePtr  *string        `qdb:"note_ptr;string"`
+		Seen     time.Time      `qdb:"seen;timestamp"`
+		SeenPtr  *time.Time     `qdb:"seen_ptr;timestamp"`
+		Level    testAge        `qdb:"level;short"`
+		LevelPtr *testAge       `qdb:"level_ptr;short"`
+		Lag      *time.Duration `qdb:"lag;long"`
+	}
+	columns := []string{"sensor", "value", "value_ptr", "count", "count_ptr", "note", "note_ptr", "seen", "seen_ptr", "level", "level_ptr", "lag"}
+
+	t.Run("should scan the null columns of a row written without them", func(t *testing.T) {
+		m, err := NewModel(&reading{Sensor: "s1"})
+		assert.Nil(t, err)
+		assert.Equal(t, "readings,sensor=s1\n", string(m.MarshalLine()))
+
+		stale := 1.5
+		read := &reading{Value: 1, ValuePtr: &stale, Note: "stale"}
+		nulls := make([]driver.Value, len(columns))
+		nulls[0] = "s1"
+		db := newTestDB(t, columns, nulls)
+		assert.Nil(t, ScanInto(db.QueryRow("SELECT * FROM readings"), read))
+		assert.Equal(t, &reading{Sensor: "s1"}, read)
+	})
+
+	t.Run("should scan values into pointer and non pointer fields alike", func(t *testing.T) {
+		seen := time.Unix(1, 0).UTC()
+		db := newTestDB(t, columns, []driver.Value{"s1", 1.5, 2.5, int64(3), int64(4), "a", "b", seen, seen, int64(5), int64(6), int64(7)})
+
+		read := &reading{}
+		assert.Nil(t, ScanInto(db.QueryRow("SELECT * FROM readings"), read))
+		assert.Equal(t, 1.5, read.Value)
+		assert.Equal(t, 2.5, *read.ValuePtr)
+		assert.Equal(t, int32(3), read.Count)
+		assert.Equal(t, int32(4), *read.CountPtr)
+		assert.Equal(t, "a", read.Note)
+		assert.Equal(t, "b", *read.NotePtr)
+		assert.Equal(t, seen, read.Seen)
+		assert.Equal(t, seen, *read.SeenPtr)
+		assert.Equal(t, testAge(5), read.Level)
+		assert.Equal(t, testAge(6), *read.LevelPtr)
+		assert.Equal(t, time.Duration(7), *read.Lag)
+	})
+
+	t.Run("should return an error for values overflowing the field", func(t *testing.T) {
+		type small struct {
+			Count int8 `qdb:"count;byte"`
+		}
+		db := newTestDB(t, []string{"count"}, []driver.Value{int64(300)})
+		assert.NotNil(t, ScanInto(db.QueryRow("SELECT count FROM smalls"), &small{}))
+	})
+}
+
+type testReading struct {
+	Device  string    `qdb:"device;symbol"`
+	Sensors []string  `qdb:"sensor;symbol;explode:true"`
+	Unit    string    `qdb:"unit;symbol"`
+	TS      time.Time `qdb:"ts;timestamp;designatedTS:true"`
+}
+
+func TestModel_Explode(t *testing.T) {
+	type reading struct {
+		Device string    `qdb:"device;symbol"`
+		Values []float64 `qdb:"value;double;explode:true"`
+		TS     time.Time `qdb:"ts;timestamp;designatedTS:true"`
+	}
+
+	t.Run("should write a line per element sharing the other fields", func(t *testing.T) {
+		m, err := NewModel(&reading{Device: "d1", Values: []float64{1, 2.5, 3}, TS: time.Unix(1, 0)})
+		assert.Nil(t, err)
+
+		assert.Equal(t, "readings,device=d1 value=1 1000000000\n"+
+			"readings,device=d1 value=2.5 1000000000\n"+
+			"readings,device=d1 value=3 1000000000\n", string(m.MarshalLine()))
+	})
+
+	t.Run("should explode symbols", func(t *testing.T) {
+		line, err := MarshalStruct(testReading{Device: "d1", Sensors: []string{"a", "b"}, Unit: "c", TS: time.Unix(1, 0)})
+		assert.Nil(t, err)
+		assert.Equal(t, "test_readings,device=d1,sensor=a,unit=c 1000000000\ntest_readings,device=d1,sensor=b,unit=c 1000000000\n", string(line))
+	})
+
+	t.Run("should write no lines for an empty slice", func(t *testing.T) {
+		line, err := MarshalStruct(reading{Device: "d1", TS: time.Unix(1, 0)})
+		assert.Nil(t, err)
+		assert.Nil(t, line)
+	})
+
+	t.Run("should declare the column of the element type", func(t *testing.T) {
+		m, err := NewModel(reading{})
+		assert.Nil(t, err)
+		assert.Equal(t, `CREATE TABLE IF NOT EXISTS "readings" ( "device" symbol, "value" double, "ts" timestamp ) timestamp(ts) ;`, m.CreateTableIfNotExistStatement())
+	})
+
+	t.Run("should scan the row's element into a single element slice", func(t *testing.T) {
+		db := newTestDB(t, []string{"device", "value", "ts"},
+			[]driver.Value{"d1", 2.5, time.Unix(1, 0)},
+			[]driver.Value{"d1", nil, time.Unix(1, 0)},
+		)
+
+		rows, err := db.Query("SELECT device, value, ts FROM readings")
+		assert.Nil(t, err)
+		read := []reading{}
+		assert.Nil(t, ScanAll(rows, &read))
+		assert.Equal(t, []float64{2.5}, read[0].Values)
+		assert.Nil(t, read[1].Values)
+	})
+
+	t.Run("should return an error for invalid exploded fields", func(t *testing.T) {
+		_, err := NewModel(struct {
+			Value float64 `qdb:"value;double;explode:true"`
+		}{})
+		assert.NotNil(t, err)
+
+		_, err = NewModel(struct {
+			Values []*float64 `qdb:"value;double;explode:true"`
+		}{})
+		assert.NotNil(t, err)
+
+		_, err = NewModel(struct {
+			TS []time.Time `qdb:"ts;timestamp;designatedTS:true;explode:true"`
+		}{})
+		assert.NotNil(t, err)
+
+		_, err = NewModel(struct {
+			A []string `qdb:"a;symbol;explode:true"`
+			B []string `qdb:"b;symbol;explode:true"`
+		}{})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestScanRows_Columns(t *testing.T) {
+	columns := []string{"pair", "exchange", "price", "ts"}
+	row := []driver.Value{"BTC-USD", "x", 1.5, time.Unix(1, 0)}
+
+	t.Run("should name the unknown and missing columns of a mismatched query", func(t *testing.T) {
+		db := newTestDB(t, columns, row)
+		rows, err := db.Query("SELECT * FROM trades")
+		assert.Nil(t, err)
+		defer rows.Close()
+
+		assert.True(t, rows.Next())
+		err = ScanRows(rows, &testTrade{})
+		assert.EqualError(t, err, "query returned 4 columns for the 3 fields of questdb.testTrade: unknown columns [exchange], missing columns []")
+
+		type other struct {
+			Pair   string  `qdb:"pair;symbol"`
+			Volume float64 `qdb:"volume;double"`
+		}
+		err = ScanRows(rows, &other{})
+		assert.EqualError(t, err, "query returned 4 columns for the 2 fields of questdb.other: unknown columns [exchange, price, ts], missing columns [volume]")
+	})
+
+	t.Run("should scan the known columns by name when ignoring unknown columns", func(t *testing.T) {
+		db := newTestDB(t, []string{"ts", "exchange", "pair", "price"}, []driver.Value{time.Unix(1, 0), "x", "BTC-USD", 1.5})
+		rows, err := db.Query("SELECT * FROM trades")
+		assert.Nil(t, err)
+		defer rows.Close()
+
+		assert.True(t, rows.Next())
+		read := &testTrade{}
+		assert.Nil(t, ScanRows(rows, read, WithIgnoreUnknownColumns()))
+		assert.Equal(t, &testTrade{Pair: "BTC-USD", Price: 1.5, TS: time.Unix(1, 0).UTC()}, read)
+	})
+
+	t.Run("should scan aliased columns by name whatever their order", func(t *testing.T) {
+		db := newTestDB(t, []string{"ts", "price", "pair"},
+			[]driver.Value{time.Unix(1, 0), 1.5, "BTC-USD"}, []driver.Value{time.Unix(2, 0), 2.5, "ETH-USD"})
+		query := "SELECT q.ts AS ts, t.price AS price, q.pair AS pair FROM quotes q ASOF JOIN trades t"
+
+		rows, err := db.Query(query)
+		assert.Nil(t, err)
+		defer rows.Close()
+		assert.True(t, rows.Next())
+		read := &testTrade{}
+		assert.Nil(t, ScanRows(rows, read, WithScanByName()))
+		assert.Equal(t, &testTrade{Pair: "BTC-USD", Price: 1.5, TS: time.Unix(1, 0).UTC()}, read)
+
+		rows, err = db.Query(query)
+		assert.Nil(t, err)
+		defer rows.Close()
+		all := []*testTrade{}
+		assert.Nil(t, ScanAll(rows, &all, WithScanByName()))
+		assert.Equal(t, []*testTrade{
+			{Pair: "BTC-USD", Price: 1.5, TS: time.Unix(1, 0).UTC()},
+			{Pair: "ETH-USD", Price: 2.5, TS: time.Unix(2, 0).UTC()},
+		}, all)
+	})
+
+	t.Run("should name the unknown and missing columns when scanning by name", func(t *testing.T) {
+		db := newTestDB(t, []string{"ts", "price", "bid"}, []driver.Value{time.Unix(1, 0), 1.5, "BTC-USD"})
+		rows, err := db.Query("SELECT q.ts AS ts, t.price AS price, q.pair AS bid FROM quotes q ASOF JOIN trades t")
+		assert.Nil(t, err)
+		defer rows.Close()
+
+		assert.True(t, rows.Next())
+		err = ScanRows(rows, &testTrade{}, WithScanByName())
+		assert.EqualError(t, err, "query returned 3 columns for the 3 fields of questdb.testTrade: unknown columns [bid], missing columns [pair]")
+	})
+
+	t.Run("should ignore unknown columns of every row with ScanAll", func(t *testing.T) {
+		db := newTestDB(t, columns, row, []driver.Value{"ETH-USD", "y", 2.5, time.Unix(2, 0)})
+		rows, err := db.Query("SELECT * FROM trades")
+		assert.Nil(t, err)
+		defer rows.Close()
+
+		read := []testTrade{}
+		assert.Nil(t, ScanAll(rows, &read, WithIgnoreUnknownColumns()))
+		assert.Equal(t, 2, len(read))
+		assert.Equal(t, "ETH-USD", read[1].Pair)
+
+		rows, err = db.Query("SELECT * FROM trades")
+		assert.Nil(t, err)
+		defer rows.Close()
+		assert.NotNil(t, ScanAll(rows, &read))
+	})
+}
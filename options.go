@@ -1,12 +1,219 @@
 package questdb
 
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
 type option struct {
-	tableName string
+	tableName      string
+	batchSize      int
+	flushInterval  time.Duration
+	stampNowIfZero bool
+	columns        []string
+	timestamp      time.Time
+	// designatedTSColumn is the column of the field selected as the designated timestamp
+	designatedTSColumn string
+	// nonBlocking makes BatchWriter.Add return ErrQueueFull rather than block
+	nonBlocking bool
+	fieldFilter func(FieldInfo) bool
+	// sortedColumns writes a model's symbols and columns in alphabetical order
+	sortedColumns bool
+	// ignoreUnknownColumns scans columns into a model's fields by name, ignoring the others
+	ignoreUnknownColumns bool
+	// scanByName scans columns into a model's fields by name rather than position
+	scanByName bool
+	// shardBase and shardColumn shard a model's rows into a table per time bucket
+	shardBase   string
+	shardColumn string
 }
 
-// WithTableName func should allow you to set a model's table name for different client operations
+// WithTableName func should allow you to set a model's table name for different client operations.
+// The name is used exactly, case included: generated sql quotes it (see QuoteIdentifier), so it
+// may be given either bare (ActiveUsers) or already quoted ("ActiveUsers").
 func WithTableName(tableName string) option {
 	return option{
 		tableName: tableName,
 	}
 }
+
+// WithBatchSize func sets the number of rows buffered by streaming writes (i.e. WriteFrom)
+// before they are flushed to QuestDB. Defaults to DefaultBatchSize.
+func WithBatchSize(n int) option {
+	return option{
+		batchSize: n,
+	}
+}
+
+// WithFlushInterval func sets the maximum time rows are buffered by streaming writes
+// (i.e. WriteFrom) before they are flushed to QuestDB. Defaults to DefaultFlushInterval.
+func WithFlushInterval(d time.Duration) option {
+	return option{
+		flushInterval: d,
+	}
+}
+
+// WithStampNowIfZero func makes writes stamp a line with the client's current time when its
+// designated timestamp is zero (or the model has no designated timestamp field), instead of
+// leaving the line without a timestamp for QuestDB to stamp with the server time at ingestion.
+func WithStampNowIfZero() option {
+	return option{
+		stampNowIfZero: true,
+	}
+}
+
+// WithColumns func restricts the fields written by a model's ILP line to those of the named
+// columns, allowing some of a table's columns to be written without defining another struct.
+// The designated timestamp is always written. Writes return an error if a named column is not
+// a column of the model. The create table statement is unaffected.
+func WithColumns(columns ...string) option {
+	return option{
+		columns: columns,
+	}
+}
+
+// WithTimestamp func sets the timestamp ending a model's ILP line, overriding the value of its
+// designated timestamp field (if any), as Model.SetTimestamp does
+func WithTimestamp(t time.Time) option {
+	return option{
+		timestamp: t,
+	}
+}
+
+// WithDesignatedTimestampColumn func selects the time.Time or int64 timestamp field of the named column as the
+// designated timestamp ending a model's ILP line, in place of the field tagged
+// designatedTS:true (if any), which is then written as a regular column. This lets a struct with
+// several timestamp fields choose its designated timestamp per write. Writes return an error
+// if the named column is not a timestamp column of the model.
+func WithDesignatedTimestampColumn(column string) option {
+	return option{
+		designatedTSColumn: column,
+	}
+}
+
+// WithFieldFilter func makes a model's ILP line only write the fields filter returns true for,
+// deciding at runtime which columns are written (e.g. leaving out personal data in some
+// environments). filter is called for each field as a line is marshaled; the designated timestamp
+// is always written and never passed to it. See Model.Fields for the FieldInfo of a model.
+func WithFieldFilter(filter func(FieldInfo) bool) option {
+	return option{
+		fieldFilter: filter,
+	}
+}
+
+// WithSortedColumns func makes writes emit a line's symbols, then its columns, in alphabetical
+// order of their column names rather than in struct field order, so the line of a row stays byte
+// identical when fields are reordered or added to the struct (e.g. for dedup keyed on a hash of
+// the line). The designated timestamp still ends the line.
+func WithSortedColumns() option {
+	return option{
+		sortedColumns: true,
+	}
+}
+
+// WithIgnoreUnknownColumns func makes ScanRows and ScanAll scan each column of the query into
+// the field of the same column name, ignoring columns without one (e.g. for a SELECT * of a table
+// with more columns than the struct) and leaving fields without a column untouched.
+func WithIgnoreUnknownColumns() option {
+	return option{
+		ignoreUnknownColumns: true,
+	}
+}
+
+// WithScanByName func makes ScanRows and ScanAll scan each column of the query into the field of
+// the same column name, whatever the order of the columns, rather than scanning the columns into
+// the fields in order when there are as many of both. This is for queries whose columns are not
+// selected with (Model).Columns(), such as joins aliasing the columns of several tables to the
+// struct's column names:
+//
+//	SELECT q.ts AS ts, t.price AS price, q.pair AS pair FROM quotes q ASOF JOIN trades t
+//
+// Unknown and missing columns are still an error, unless WithIgnoreUnknownColumns is also passed.
+func WithScanByName() option {
+	return option{
+		scanByName: true,
+	}
+}
+
+// WithShardedTable func writes each row to the table of base for the time bucket of its
+// tsColumn timestamp column (see ShardedTableName), such as events_2024_01, instead of to the
+// model's table. Rows are bucketed by the partitions of the model's CreateTableOptions, or by
+// month if it has none. WriteBatchGrouped batches the rows of each shard together, and
+// CreateTableIfNotExists creates the shard of the given row. Writes return an error if tsColumn
+// is not a timestamp column of the model.
+func WithShardedTable(base, tsColumn string) option {
+	return option{
+		shardBase:   base,
+		shardColumn: tsColumn,
+	}
+}
+
+// WithNonBlockingAdd func makes a BatchWriter's Add return ErrQueueFull when its queue is full
+// instead of blocking until there is room, so producers can shed or retry rows themselves
+func WithNonBlockingAdd() option {
+	return option{
+		nonBlocking: true,
+	}
+}
+
+// applyOptions func sets all model related options on m. It returns an error if an option is
+// invalid for m.
+func applyOptions(m *Model, options []option) error {
+	for _, opt := range options {
+		// check and set all options here
+		if opt.tableName != "" {
+			m.tableName = unquoteIdentifier(opt.tableName)
+		}
+		if opt.stampNowIfZero {
+			m.stampNowIfZero = true
+		}
+		if opt.sortedColumns {
+			m.sortedColumns = true
+		}
+		if opt.ignoreUnknownColumns {
+			m.ignoreUnknownColumns = true
+		}
+		if opt.scanByName {
+			m.scanByName = true
+		}
+		if opt.shardBase != "" {
+			f := m.fieldByColumn(opt.shardColumn)
+			if f == nil {
+				return fmt.Errorf("column '%s' is not a column of %s", opt.shardColumn, m.tableName)
+			}
+			if f.qdbType != Timestamp || f.tagOptions.explode {
+				return fmt.Errorf("column '%s' must be a timestamp to shard by", opt.shardColumn)
+			}
+			m.shardBase = unquoteIdentifier(opt.shardBase)
+			m.shardField = f
+			m.applyShard()
+		}
+		if opt.fieldFilter != nil {
+			m.fieldFilter = opt.fieldFilter
+		}
+		if opt.designatedTSColumn != "" {
+			f := m.fieldByColumn(opt.designatedTSColumn)
+			if f == nil {
+				return fmt.Errorf("column '%s' is not a column of %s", opt.designatedTSColumn, m.tableName)
+			}
+			if f.qdbType != Timestamp || (indirectType(f.typ) != reflect.TypeOf(time.Time{}) && !isEpochType(f.typ)) {
+				return fmt.Errorf("column '%s' must be a time.Time or int64 timestamp to be the designated timestamp", opt.designatedTSColumn)
+			}
+			m.designatedTS = f
+		}
+		if !opt.timestamp.IsZero() {
+			m.SetTimestamp(opt.timestamp)
+		}
+		for _, column := range opt.columns {
+			if m.fieldByColumn(column) == nil {
+				return fmt.Errorf("column '%s' is not a column of %s", column, m.tableName)
+			}
+			if m.columnFilter == nil {
+				m.columnFilter = map[string]struct{}{}
+			}
+			m.columnFilter[column] = struct{}{}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package questdb
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lineTimestamp func returns the trailing timestamp of an ILP line as a time.Time
+func lineTimestamp(t *testing.T, line string) time.Time {
+	parts := strings.Split(strings.TrimSuffix(line, "\n"), " ")
+	ns, err := strconv.ParseInt(parts[len(parts)-1], 10, 64)
+	assert.Nil(t, err)
+	return time.Unix(0, ns)
+}
+
+func TestWithStampNowIfZero(t *testing.T) {
+	t.Run("should stamp the current time when the designated timestamp is zero", func(t *testing.T) {
+		m, err := NewModel(&testTrade{Pair: "BTC-USD", Price: 1})
+		assert.Nil(t, err)
+		applyOptions(m, []option{WithStampNowIfZero()})
+		m.clock = func() time.Time { return time.Unix(5, 0) }
+
+		assert.Equal(t, time.Unix(5, 0), lineTimestamp(t, string(m.MarshalLine())))
+	})
+
+	t.Run("should stamp the current time for models without a designated timestamp", func(t *testing.T) {
+		m, err := NewModel(&testRow{Name: "a", Value: 1})
+		assert.Nil(t, err)
+		applyOptions(m, []option{WithStampNowIfZero()})
+
+		assert.Equal(t, 3, len(strings.Split(string(m.MarshalLine()), " ")))
+	})
+
+	t.Run("should keep a set designated timestamp", func(t *testing.T) {
+		m, err := NewModel(&testTrade{Pair: "BTC-USD", Price: 1, TS: time.Unix(1, 0)})
+		assert.Nil(t, err)
+		applyOptions(m, []option{WithStampNowIfZero()})
+
+		assert.Equal(t, time.Unix(1, 0), lineTimestamp(t, string(m.MarshalLine())))
+	})
+
+	t.Run("should not stamp anything without the option", func(t *testing.T) {
+		m, err := NewModel(&testTrade{Pair: "BTC-USD", Price: 1})
+		assert.Nil(t, err)
+
+		assert.Equal(t, "test_trades,pair=BTC-USD price=1\n", string(m.MarshalLine()))
+	})
+}
+
+func TestWithColumns(t *testing.T) {
+	t.Run("should only write the named columns and the designated timestamp", func(t *testing.T) {
+		m, err := NewModel(&testTrade{Pair: "BTC-USD", Price: 1, TS: time.Unix(1, 0)})
+		assert.Nil(t, err)
+		assert.Nil(t, applyOptions(m, []option{WithColumns("price")}))
+
+		assert.Equal(t, "test_trades price=1 1000000000\n", string(m.MarshalLine()))
+	})
+
+	t.Run("should combine the columns of several options", func(t *testing.T) {
+		m, err := NewModel(&testTrade{Pair: "BTC-USD", Price: 1})
+		assert.Nil(t, err)
+		assert.Nil(t, applyOptions(m, []option{WithColumns("price"), WithColumns("pair")}))
+
+		assert.Equal(t, "test_trades,pair=BTC-USD price=1\n", string(m.MarshalLine()))
+	})
+
+	t.Run("should return an error for unknown columns", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+
+		err := client.Write(testTrade{Pair: "BTC-USD", Price: 1}, WithColumns("volume"))
+		assert.NotNil(t, err)
+	})
+}
+
+func TestWithTimestamp(t *testing.T) {
+	t.Run("should override the designated timestamp", func(t *testing.T) {
+		m, err := NewModel(&testTrade{Pair: "BTC-USD", Price: 1, TS: time.Unix(1, 0)})
+		assert.Nil(t, err)
+		assert.Nil(t, applyOptions(m, []option{WithTimestamp(time.Unix(2, 0))}))
+
+		assert.Equal(t, time.Unix(2, 0), lineTimestamp(t, string(m.MarshalLine())))
+	})
+
+	t.Run("should stamp models without a designated timestamp", func(t *testing.T) {
+		m, err := NewModel(&testRow{Name: "a", Value: 1})
+		assert.Nil(t, err)
+		assert.Nil(t, applyOptions(m, []option{WithTimestamp(time.Unix(2, 0))}))
+
+		assert.Equal(t, "test_rows,name=a value=1i 2000000000\n", string(m.MarshalLine()))
+	})
+}
+
+func TestWithDesignatedTimestampColumn(t *testing.T) {
+	type event struct {
+		Name     string    `qdb:"name;symbol"`
+		Received time.Time `qdb:"received;timestamp"`
+		TS       time.Time `qdb:"ts;timestamp;designatedTS:true"`
+		Count    int64     `qdb:"count;long"`
+	}
+	ev := &event{Name: "a", Received: time.Unix(1, 0), TS: time.Unix(2, 0), Count: 3}
+
+	t.Run("should end the line with the selected column and write the tagged one as a column", func(t *testing.T) {
+		m, err := NewModel(ev)
+		assert.Nil(t, err)
+		assert.Nil(t, applyOptions(m, []option{WithTableName("events"), WithDesignatedTimestampColumn("received")}))
+
+		assert.Equal(t, "events,name=a ts=2000000t,count=3i 1000000000\n", string(m.MarshalLine()))
+	})
+
+	t.Run("should leave a zero tagged designated timestamp out of the line", func(t *testing.T) {
+		m, err := NewModel(&testEvent{Name: "a", Received: time.Unix(1, 0)})
+		assert.Nil(t, err)
+		assert.Nil(t, applyOptions(m, []option{WithDesignatedTimestampColumn("received")}))
+
+		assert.Equal(t, "test_events,name=a 1000000000\n", string(m.MarshalLine()))
+	})
+
+	t.Run("should keep the selected column with WithColumns", func(t *testing.T) {
+		m, err := NewModel(ev)
+		assert.Nil(t, err)
+		assert.Nil(t, applyOptions(m, []option{WithTableName("events"), WithColumns("count"), WithDesignatedTimestampColumn("received")}))
+
+		assert.Equal(t, "events count=3i 1000000000\n", string(m.MarshalLine()))
+	})
+
+	t.Run("should select *time.Time and *int64 columns", func(t *testing.T) {
+		received, sent := time.Unix(1, 0), int64(2000000)
+		type ptrEvent struct {
+			Name     string     `qdb:"name;symbol"`
+			Received *time.Time `qdb:"received;timestamp"`
+			Sent     *int64     `qdb:"sent;timestamp"`
+			TS       time.Time  `qdb:"ts;timestamp;designatedTS:true"`
+		}
+		pev := &ptrEvent{Name: "a", Received: &received, Sent: &sent, TS: time.Unix(3, 0)}
+
+		m, err := NewModel(pev)
+		assert.Nil(t, err)
+		assert.Nil(t, applyOptions(m, []option{WithTableName("events"), WithDesignatedTimestampColumn("received")}))
+		assert.Equal(t, "events,name=a sent=2000000t,ts=3000000t 1000000000\n", string(m.MarshalLine()))
+
+		m, err = NewModel(pev)
+		assert.Nil(t, err)
+		assert.Nil(t, applyOptions(m, []option{WithTableName("events"), WithDesignatedTimestampColumn("sent")}))
+		assert.Equal(t, "events,name=a received=1000000t,ts=3000000t 2000000000\n", string(m.MarshalLine()))
+	})
+
+	t.Run("should return an error for unknown or non timestamp columns", func(t *testing.T) {
+		m, err := NewModel(ev)
+		assert.Nil(t, err)
+		assert.NotNil(t, applyOptions(m, []option{WithDesignatedTimestampColumn("missing")}))
+		assert.NotNil(t, applyOptions(m, []option{WithDesignatedTimestampColumn("count")}))
+	})
+}
+
+func TestWithFieldFilter(t *testing.T) {
+	type user struct {
+		Country string    `qdb:"country;symbol"`
+		Email   string    `qdb:"email;string"`
+		Logins  int64     `qdb:"logins;long"`
+		TS      time.Time `qdb:"ts;timestamp;designatedTS:true"`
+	}
+	u := &user{Country: "NZ", Email: "a@example.com", Logins: 3, TS: time.Unix(1, 0)}
+
+	t.Run("should leave out the fields filtered out", func(t *testing.T) {
+		m, err := NewModel(u)
+		assert.Nil(t, err)
+		assert.Nil(t, applyOptions(m, []option{WithFieldFilter(func(f FieldInfo) bool {
+			return f.Column != "email"
+		})}))
+
+		assert.Equal(t, "users,country=NZ logins=3i 1000000000\n", string(m.MarshalLine()))
+	})
+
+	t.Run("should never filter out the designated timestamp", func(t *testing.T) {
+		m, err := NewModel(u)
+		assert.Nil(t, err)
+		filtered := []string{}
+		assert.Nil(t, applyOptions(m, []option{WithFieldFilter(func(f FieldInfo) bool {
+			filtered = append(filtered, f.Column)
+			return f.Column == "logins"
+		})}))
+
+		assert.Equal(t, "users logins=3i 1000000000\n", string(m.MarshalLine()))
+		assert.Equal(t, []string{"country", "email", "logins"}, filtered)
+	})
+}
+
+func TestWithShardedTable(t *testing.T) {
+	t.Run("should write each row to the shard of its timestamp", func(t *testing.T) {
+		ev := &testEvent{Name: "a", Received: time.Date(2024, time.February, 3, 0, 0, 0, 0, time.UTC)}
+		m, err := NewModel(ev)
+		assert.Nil(t, err)
+		assert.Nil(t, applyOptions(m, []option{WithShardedTable("events", "received")}))
+		assert.Equal(t, "events_2024_02", m.tableName)
+
+		ev.Received = time.Date(2024, time.March, 3, 0, 0, 0, 0, time.UTC)
+		assert.Equal(t, "events_2024_03,name=a received=1709424000000000t\n", string(m.MarshalLine()))
+	})
+
+	t.Run("should shard by the partitions of the model", func(t *testing.T) {
+		q := &testQuote{Pair: "BTC-USD", TS: time.Date(2024, time.February, 3, 4, 0, 0, 0, time.UTC)}
+		m, err := NewModel(q)
+		assert.Nil(t, err)
+		assert.Nil(t, applyOptions(m, []option{WithShardedTable("quotes", "ts")}))
+		assert.Equal(t, "quotes_2024_02_03", m.tableName)
+	})
+
+	t.Run("should return an error for unknown or non timestamp columns", func(t *testing.T) {
+		m, err := NewModel(&testEvent{})
+		assert.Nil(t, err)
+		assert.NotNil(t, applyOptions(m, []option{WithShardedTable("events", "missing")}))
+		assert.NotNil(t, applyOptions(m, []option{WithShardedTable("events", "name")}))
+	})
+}
+
+func TestWithSortedColumns(t *testing.T) {
+	type v1 struct {
+		Zone   string    `qdb:"zone;symbol"`
+		Host   string    `qdb:"host;symbol"`
+		Temp   float64   `qdb:"temp;double"`
+		Alerts int64     `qdb:"alerts;long"`
+		TS     time.Time `qdb:"ts;timestamp;designatedTS:true"`
+	}
+	type v2 struct {
+		TS     time.Time `qdb:"ts;timestamp;designatedTS:true"`
+		Alerts int64     `qdb:"alerts;long"`
+		Host   string    `qdb:"host;symbol"`
+		Temp   float64   `qdb:"temp;double"`
+		Zone   string    `qdb:"zone;symbol"`
+	}
+	expected := "readings,host=h1,zone=z1 alerts=2i,temp=1.5 1000000000\n"
+
+	t.Run("should write symbols and columns alphabetically regardless of field order", func(t *testing.T) {
+		line, err := MarshalStruct(v1{Zone: "z1", Host: "h1", Temp: 1.5, Alerts: 2, TS: time.Unix(1, 0)}, WithTableName("readings"), WithSortedColumns())
+		assert.Nil(t, err)
+		assert.Equal(t, expected, string(line))
+
+		line, err = MarshalStruct(v2{Zone: "z1", Host: "h1", Temp: 1.5, Alerts: 2, TS: time.Unix(1, 0)}, WithTableName("readings"), WithSortedColumns())
+		assert.Nil(t, err)
+		assert.Equal(t, expected, string(line))
+	})
+
+	t.Run("should sort default symbols with the fields", func(t *testing.T) {
+		line, err := MarshalStruct(testService{Latency: 5}, WithSortedColumns())
+		assert.Nil(t, err)
+		assert.Equal(t, "test_services,env=prod,service=api\\ gateway latency=5i\n", string(line))
+	})
+}
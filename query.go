@@ -0,0 +1,104 @@
+package questdb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Expr is a QuestDB sql expression, such as a column name, literal or function call, for use
+// in hand written queries. Expr values are built by the funcs below so they are always valid
+// QuestDB sql.
+type Expr string
+
+// String func returns the sql of the Expr
+func (e Expr) String() string {
+	return string(e)
+}
+
+// DatePeriod is the unit of a dateadd() period
+type DatePeriod string
+
+const (
+	PeriodMicrosecond DatePeriod = "u"
+	PeriodMillisecond DatePeriod = "T"
+	PeriodSecond      DatePeriod = "s"
+	PeriodMinute      DatePeriod = "m"
+	PeriodHour        DatePeriod = "h"
+	PeriodDay         DatePeriod = "d"
+	PeriodWeek        DatePeriod = "w"
+	PeriodMonth       DatePeriod = "M"
+	PeriodYear        DatePeriod = "y"
+)
+
+// Column func returns the Expr of the quoted column name
+func Column(name string) Expr {
+	return Expr(QuoteIdentifier(name))
+}
+
+// Now func returns the Expr of QuestDB's current timestamp, now()
+func Now() Expr {
+	return "now()"
+}
+
+// DateAdd func returns the Expr adding n periods to the timestamp e, i.e.
+// dateadd('d', -7, now()) for DateAdd(PeriodDay, -7, Now())
+func DateAdd(period DatePeriod, n int, e Expr) Expr {
+	return Expr(fmt.Sprintf("dateadd(%s, %d, %s)", quoteString(string(period)), n, e))
+}
+
+// ToTimestamp func returns the Expr parsing s into a timestamp with the QuestDB timestamp
+// format (e.g. "yyyy-MM-dd HH:mm:ss", not a Go time layout), i.e. to_timestamp(s, format)
+func ToTimestamp(s, format string) Expr {
+	return Expr(fmt.Sprintf("to_timestamp(%s, %s)", quoteString(s), quoteString(format)))
+}
+
+// TimestampOf func returns the Expr of the timestamp literal of t, which QuestDB compares with
+// timestamp columns at microsecond precision
+func TimestampOf(t time.Time) Expr {
+	// QuoteLiteral cannot fail for a time.Time timestamp
+	lit, _ := QuoteLiteral(t, Timestamp)
+	return Expr(lit)
+}
+
+// Ago func returns the Expr of the timestamp d before now(), rounded down to whole
+// microseconds, i.e. dateadd('u', -1500000, now()) for Ago(1500 * time.Millisecond)
+func Ago(d time.Duration) Expr {
+	return DateAdd(PeriodMicrosecond, -int(d/time.Microsecond), Now())
+}
+
+// maxInClauseArgs is the number of values above which BuildInClause inlines the values as quoted
+// literals rather than binding a parameter for each, as the PG wire protocol limits a statement
+// to 65535 parameters
+const maxInClauseArgs = 1024
+
+// BuildInClause func returns the sql predicate filtering the column to values, e.g. for a symbol
+// column, and its args: "col" IN ($1, $2, $3) for BuildInClause("col", []string{"a", "b", "c"}).
+// An empty values returns the predicate false, which matches no row, as IN () is not valid sql.
+// More than 1024 values are inlined as escaped string literals and return no args, so a list of
+// any length can be filtered on. The placeholders are numbered from $1, use BuildInClauseAt to
+// combine the predicate with other parameters.
+func BuildInClause(column string, values []string) (string, []interface{}) {
+	return BuildInClauseAt(column, values, 1)
+}
+
+// BuildInClauseAt func is like BuildInClause but numbers the placeholders from $firstArg, i.e.
+// after the firstArg-1 parameters of the rest of the query
+func BuildInClauseAt(column string, values []string, firstArg int) (string, []interface{}) {
+	if len(values) == 0 {
+		return "false", nil
+	}
+	items := make([]string, len(values))
+	if len(values) > maxInClauseArgs {
+		for i, value := range values {
+			items[i] = quoteString(value)
+		}
+		return fmt.Sprintf("%s IN (%s)", QuoteIdentifier(column), strings.Join(items, ", ")), nil
+	}
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		items[i] = fmt.Sprintf("$%d", firstArg+i)
+		args[i] = value
+	}
+	return fmt.Sprintf("%s IN (%s)", QuoteIdentifier(column), strings.Join(items, ", ")), args
+}
@@ -0,0 +1,77 @@
+package questdb
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeExpressions(t *testing.T) {
+	tests := []struct {
+		name string
+		expr Expr
+		want string
+	}{
+		{"now", Now(), "now()"},
+		{"dateadd", DateAdd(PeriodDay, -7, Now()), "dateadd('d', -7, now())"},
+		{"nested dateadd", DateAdd(PeriodMonth, 1, DateAdd(PeriodHour, 2, Column("ts"))), `dateadd('M', 1, dateadd('h', 2, "ts"))`},
+		{"to_timestamp", ToTimestamp("2022-01-01 00:00:00", "yyyy-MM-dd HH:mm:ss"), "to_timestamp('2022-01-01 00:00:00', 'yyyy-MM-dd HH:mm:ss')"},
+		{"to_timestamp escapes quotes", ToTimestamp("2022'", "yyyy"), "to_timestamp('2022''', 'yyyy')"},
+		{"timestamp literal", TimestampOf(time.Date(2022, 1, 1, 0, 0, 0, 1000, time.UTC)), "'2022-01-01T00:00:00.000001Z'"},
+		{"ago", Ago(1500 * time.Millisecond), "dateadd('u', -1500000, now())"},
+	}
+	for _, tt := range tests {
+		t.Run("should build "+tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.expr.String())
+		})
+	}
+}
+
+func TestBuildInClause(t *testing.T) {
+	t.Run("should bind a parameter per value", func(t *testing.T) {
+		where, args := BuildInClause("pair", []string{"BTC-USD", "it's"})
+		assert.Equal(t, `"pair" IN ($1, $2)`, where)
+		assert.Equal(t, []interface{}{"BTC-USD", "it's"}, args)
+	})
+
+	t.Run("should number the parameters from firstArg", func(t *testing.T) {
+		where, args := BuildInClauseAt("pair", []string{"BTC-USD"}, 3)
+		assert.Equal(t, `"pair" IN ($3)`, where)
+		assert.Equal(t, []interface{}{"BTC-USD"}, args)
+	})
+
+	t.Run("should match no row for no values", func(t *testing.T) {
+		where, args := BuildInClause("pair", nil)
+		assert.Equal(t, "false", where)
+		assert.Nil(t, args)
+	})
+
+	t.Run("should inline the escaped values of large lists", func(t *testing.T) {
+		values := make([]string, maxInClauseArgs+1)
+		for i := range values {
+			values[i] = "a"
+		}
+		values[0] = "x'; DROP TABLE trades; --"
+		where, args := BuildInClause("pair", values)
+		assert.Nil(t, args)
+		assert.True(t, strings.HasPrefix(where, `"pair" IN ('x''; DROP TABLE trades; --', 'a', `))
+		assert.Equal(t, maxInClauseArgs+1, strings.Count(where, "'a'")+1)
+	})
+
+	t.Run("should only filter the Model's symbol and string columns", func(t *testing.T) {
+		m, err := NewModel(&testTrade{})
+		assert.Nil(t, err)
+
+		where, args, err := m.InClause("pair", []string{"BTC-USD"})
+		assert.Nil(t, err)
+		assert.Equal(t, `"pair" IN ($1)`, where)
+		assert.Equal(t, []interface{}{"BTC-USD"}, args)
+
+		_, _, err = m.InClause("price", []string{"1"})
+		assert.NotNil(t, err)
+		_, _, err = m.InClause("unknown", []string{"a"})
+		assert.NotNil(t, err)
+	})
+}
@@ -1,21 +1,33 @@
 package questdb
 
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
 // SerializableValue is a value that is one of the following types:
 //
-//  int
-//  uint
-//  int16
-//  uint16
-//  int32
-//  uint32
-//  int64
-//  float64
-//  float32
-//  bool
-//  string
-//  time.Time
-//  Bytes
-//
+//	int
+//	uint
+//	int16
+//	uint16
+//	int32
+//	uint32
+//	int64
+//	float64
+//	float32
+//	bool
+//	string
+//	time.Time
+//	Bytes
 type Value interface{}
 
 // QBDValuer is the interface providing the QDBValue method.
@@ -29,7 +41,9 @@ type QBDValuer interface {
 }
 
 // Scanner interface has one method QDBScan which scans a value from
-// QuestDB into the type implementing Scanner
+// QuestDB into the type implementing Scanner. ScanInto, ScanRows and QueryScalar scan into any
+// field or destination whose pointer implements Scanner, taking precedence over sql.Scanner, via
+// the intermediate below; Long256Value and RawJSON implement it.
 type Scanner interface {
 	QDBScan(src interface{}) error
 }
@@ -53,3 +67,576 @@ func newIntermediate(v Scanner) *intermediate {
 func (i *intermediate) Scan(src interface{}) error {
 	return i.v.QDBScan(src)
 }
+
+// jsonIntermediate struct is a struct which implements the sql.Scanner interface for fields of
+// json type which do not implement a scanner themselves. json values are stored in QuestDB as
+// base64 encoded strings, so jsonIntermediate decodes src before json unmarshalling it into v.
+type jsonIntermediate struct {
+	v interface{}
+}
+
+// newJSONIntermediate func returns *jsonIntermediate given a pointer v to unmarshal into
+func newJSONIntermediate(v interface{}) *jsonIntermediate {
+	return &jsonIntermediate{
+		v: v,
+	}
+}
+
+// Scan func is implementation of the sql.Scanner's Scan method which base64 decodes src and
+// json unmarshals the result into jsonIntermediate's (v) underlying value.
+func (j *jsonIntermediate) Scan(src interface{}) error {
+	var encoded string
+	switch val := src.(type) {
+	case nil:
+		return nil
+	case string:
+		encoded = val
+	case []byte:
+		encoded = string(val)
+	default:
+		return fmt.Errorf("%T cannot be scanned into json field", val)
+	}
+	by, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("could not base64 decode src: %w", err)
+	}
+	if err := json.Unmarshal(by, j.v); err != nil {
+		return fmt.Errorf("could not json unmarshal into %T: %w", j.v, err)
+	}
+	return nil
+}
+
+// durationIntermediate struct is a struct which implements the sql.Scanner interface for
+// time.Duration fields. Durations are stored in QuestDB as an integer count of unit.
+type durationIntermediate struct {
+	v    *time.Duration
+	unit time.Duration
+}
+
+// newDurationIntermediate func returns *durationIntermediate given a *time.Duration to scan into
+// and the unit the stored value is counted in. A unit of 0 means nanoseconds.
+func newDurationIntermediate(v *time.Duration, unit time.Duration) *durationIntermediate {
+	if unit <= 0 {
+		unit = time.Nanosecond
+	}
+	return &durationIntermediate{
+		v:    v,
+		unit: unit,
+	}
+}
+
+// Scan func is implementation of the sql.Scanner's Scan method which converts the stored
+// integer count src back into a time.Duration.
+func (d *durationIntermediate) Scan(src interface{}) error {
+	var n int64
+	switch val := src.(type) {
+	case nil:
+		*d.v = 0
+		return nil
+	case int64:
+		n = val
+	case []byte:
+		parsed, err := strconv.ParseInt(string(val), 10, 64)
+		if err != nil {
+			return fmt.Errorf("could not parse duration: %w", err)
+		}
+		n = parsed
+	case string:
+		parsed, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return fmt.Errorf("could not parse duration: %w", err)
+		}
+		n = parsed
+	default:
+		return fmt.Errorf("%T cannot be scanned into time.Duration", val)
+	}
+	*d.v = time.Duration(n) * d.unit
+	return nil
+}
+
+// epochIntermediate struct is a struct which implements the sql.Scanner interface for int64
+// fields of timestamp type, which hold a count of a unit since the Unix epoch
+type epochIntermediate struct {
+	v    *int64
+	unit time.Duration
+}
+
+// newEpochIntermediate func returns *epochIntermediate given a *int64 to scan into and the unit
+// it counts. A unit of 0 means microseconds.
+func newEpochIntermediate(v *int64, unit time.Duration) *epochIntermediate {
+	if unit <= 0 {
+		unit = time.Microsecond
+	}
+	return &epochIntermediate{
+		v:    v,
+		unit: unit,
+	}
+}
+
+// Scan func is implementation of the sql.Scanner's Scan method which converts the timestamp src
+// into a count of the unit since the Unix epoch
+func (e *epochIntermediate) Scan(src interface{}) error {
+	t, ok, err := scannedTime(src)
+	if err != nil {
+		return fmt.Errorf("%w into an epoch timestamp", err)
+	}
+	if !ok {
+		*e.v = 0
+		return nil
+	}
+	switch e.unit {
+	case time.Nanosecond:
+		*e.v = t.UnixNano()
+	case time.Millisecond:
+		*e.v = t.UnixMilli()
+	default:
+		*e.v = t.UnixMicro()
+	}
+	return nil
+}
+
+// timestampIntermediate struct is a struct which implements the sql.Scanner interface for
+// time.Time fields. Depending on the driver and its settings, QuestDB timestamps are returned as
+// time.Time, int64 microseconds or formatted strings, which timestampIntermediate all scans.
+type timestampIntermediate struct {
+	v *time.Time
+}
+
+// newTimestampIntermediate func returns *timestampIntermediate given a *time.Time to scan into
+func newTimestampIntermediate(v *time.Time) *timestampIntermediate {
+	return &timestampIntermediate{
+		v: v,
+	}
+}
+
+// Scan func is implementation of the sql.Scanner's Scan method which sets timestampIntermediate's
+// (v) underlying time.Time to the time src in UTC, or the zero time.Time for NULL.
+func (t *timestampIntermediate) Scan(src interface{}) error {
+	scanned, ok, err := scannedTime(src)
+	if err != nil {
+		return fmt.Errorf("%w into time.Time", err)
+	}
+	if !ok {
+		*t.v = time.Time{}
+		return nil
+	}
+	*t.v = scanned
+	return nil
+}
+
+// scannedTimeLayouts are the layouts of the timestamps drivers return as strings, tried in order.
+// Layouts without a zone are taken to be UTC, as QuestDB timestamps are.
+var scannedTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// scannedTime func returns the timestamp src, a time.Time, an int64 count of microseconds since
+// the Unix epoch or a string (or []byte) in one of scannedTimeLayouts, in UTC. It returns false
+// if src is NULL.
+func scannedTime(src interface{}) (time.Time, bool, error) {
+	switch val := src.(type) {
+	case nil:
+		return time.Time{}, false, nil
+	case time.Time:
+		return val.UTC(), true, nil
+	case int64:
+		return time.UnixMicro(val).UTC(), true, nil
+	case []byte:
+		return parseScannedTime(string(val))
+	case string:
+		return parseScannedTime(val)
+	default:
+		return time.Time{}, false, fmt.Errorf("%T cannot be scanned", val)
+	}
+}
+
+// parseScannedTime func parses the timestamp s in the first of scannedTimeLayouts which fits it
+func parseScannedTime(s string) (time.Time, bool, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range scannedTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), true, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("timestamp '%s' cannot be scanned", s)
+}
+
+// charIntermediate struct is a struct which implements the sql.Scanner interface for rune fields
+// of char type. QuestDB returns char columns as a single character string.
+type charIntermediate struct {
+	v *rune
+}
+
+// newCharIntermediate func returns *charIntermediate given a *rune to scan into
+func newCharIntermediate(v *rune) *charIntermediate {
+	return &charIntermediate{
+		v: v,
+	}
+}
+
+// Scan func is implementation of the sql.Scanner's Scan method which scans the single character
+// string src into charIntermediate's (v) underlying rune.
+func (c *charIntermediate) Scan(src interface{}) error {
+	var str string
+	switch val := src.(type) {
+	case nil:
+		*c.v = 0
+		return nil
+	case string:
+		str = val
+	case []byte:
+		str = string(val)
+	case int64:
+		*c.v = rune(val)
+		return nil
+	default:
+		return fmt.Errorf("%T cannot be scanned into rune", val)
+	}
+	if utf8.RuneCountInString(str) != 1 {
+		return fmt.Errorf("'%s' cannot be scanned into rune: must be exactly one character", str)
+	}
+	r, _ := utf8.DecodeRuneInString(str)
+	*c.v = r
+	return nil
+}
+
+// boolIntIntermediate struct is a struct which implements the sql.Scanner interface for bool
+// fields stored in an int column ('boolAs:int' tag option).
+type boolIntIntermediate struct {
+	v *bool
+}
+
+// newBoolIntIntermediate func returns *boolIntIntermediate given a *bool to scan into
+func newBoolIntIntermediate(v *bool) *boolIntIntermediate {
+	return &boolIntIntermediate{
+		v: v,
+	}
+}
+
+// Scan func is implementation of the sql.Scanner's Scan method which scans the stored integer
+// src into boolIntIntermediate's (v) underlying bool. Any non zero value is true.
+func (b *boolIntIntermediate) Scan(src interface{}) error {
+	switch val := src.(type) {
+	case nil:
+		*b.v = false
+	case int64:
+		*b.v = val != 0
+	case bool:
+		*b.v = val
+	case []byte:
+		n, err := strconv.ParseInt(string(val), 10, 64)
+		if err != nil {
+			return fmt.Errorf("could not parse bool stored as int: %w", err)
+		}
+		*b.v = n != 0
+	case string:
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return fmt.Errorf("could not parse bool stored as int: %w", err)
+		}
+		*b.v = n != 0
+	default:
+		return fmt.Errorf("%T cannot be scanned into bool", val)
+	}
+	return nil
+}
+
+// timeFormatIntermediate struct is a struct which implements the sql.Scanner interface for
+// string fields stored in a date or timestamp column ('timeFormat' tag option).
+type timeFormatIntermediate struct {
+	v      *string
+	layout string
+}
+
+// newTimeFormatIntermediate func returns *timeFormatIntermediate given a *string to scan into
+// and the layout to format the scanned time with
+func newTimeFormatIntermediate(v *string, layout string) *timeFormatIntermediate {
+	return &timeFormatIntermediate{
+		v:      v,
+		layout: layout,
+	}
+}
+
+// Scan func is implementation of the sql.Scanner's Scan method which formats the time src
+// with timeFormatIntermediate's layout into its (v) underlying string.
+func (t *timeFormatIntermediate) Scan(src interface{}) error {
+	scanned, ok, err := scannedTime(src)
+	if err != nil {
+		return fmt.Errorf("%w into formatted time string", err)
+	}
+	if !ok {
+		*t.v = ""
+		return nil
+	}
+	*t.v = scanned.Format(t.layout)
+	return nil
+}
+
+// nullIntermediate struct is a struct which implements the sql.Scanner interface for fields of
+// a basic type through the sql.Null* type of their kind, so that a NULL column
+// scans as the zero value rather than failing
+type nullIntermediate struct {
+	v reflect.Value
+}
+
+// newNullIntermediate func returns *nullIntermediate given a pointer v to a value of a basic kind,
+// and whether v is one
+func newNullIntermediate(v interface{}) (*nullIntermediate, bool) {
+	rv := reflect.ValueOf(v).Elem()
+	switch rv.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return nil, false
+	}
+	return &nullIntermediate{
+		v: rv,
+	}, true
+}
+
+// Scan func is implementation of the sql.Scanner's Scan method which scans src through the
+// sql.Null* type of nullIntermediate's (v) kind and sets v to the scanned value, or its zero
+// value for NULL.
+func (n *nullIntermediate) Scan(src interface{}) error {
+	switch n.v.Kind() {
+	case reflect.String:
+		var s sql.NullString
+		if err := s.Scan(src); err != nil {
+			return err
+		}
+		n.v.SetString(s.String)
+	case reflect.Bool:
+		var b sql.NullBool
+		if err := b.Scan(src); err != nil {
+			return err
+		}
+		n.v.SetBool(b.Bool)
+	case reflect.Float32, reflect.Float64:
+		var f sql.NullFloat64
+		if err := f.Scan(src); err != nil {
+			return err
+		}
+		n.v.SetFloat(f.Float64)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i sql.NullInt64
+		if err := i.Scan(src); err != nil {
+			return err
+		}
+		if n.v.OverflowInt(i.Int64) {
+			return fmt.Errorf("%d overflows %s", i.Int64, n.v.Type())
+		}
+		n.v.SetInt(i.Int64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var i sql.NullInt64
+		if err := i.Scan(src); err != nil {
+			return err
+		}
+		if i.Int64 < 0 || n.v.OverflowUint(uint64(i.Int64)) {
+			return fmt.Errorf("%d overflows %s", i.Int64, n.v.Type())
+		}
+		n.v.SetUint(uint64(i.Int64))
+	}
+	return nil
+}
+
+// pointerIntermediate struct is a struct which implements the sql.Scanner interface for pointer
+// fields. A NULL column sets the field to nil, any other value is scanned into a newly allocated
+// value the field is then set to point to.
+type pointerIntermediate struct {
+	v    reflect.Value
+	dest func(v interface{}) interface{}
+}
+
+// newPointerIntermediate func returns *pointerIntermediate given the pointer field v and dest,
+// which returns the sql.Scanner a pointer to a new value of v's element type is scanned through
+func newPointerIntermediate(v reflect.Value, dest func(v interface{}) interface{}) *pointerIntermediate {
+	return &pointerIntermediate{
+		v:    v,
+		dest: dest,
+	}
+}
+
+// Scan func is implementation of the sql.Scanner's Scan method which sets pointerIntermediate's
+// (v) underlying pointer to nil for NULL, or to a new value src is scanned into.
+func (p *pointerIntermediate) Scan(src interface{}) error {
+	if src == nil {
+		p.v.Set(reflect.Zero(p.v.Type()))
+		return nil
+	}
+	elem := reflect.New(p.v.Type().Elem())
+	scanner, ok := p.dest(elem.Interface()).(sql.Scanner)
+	if !ok {
+		return fmt.Errorf("%T cannot be scanned into %s", src, p.v.Type())
+	}
+	if err := scanner.Scan(src); err != nil {
+		return err
+	}
+	p.v.Set(elem)
+	return nil
+}
+
+// explodedIntermediate struct is a struct which implements the sql.Scanner interface for
+// exploded fields (see the 'explode' tag option). A row holds a single element of the field,
+// which is scanned into a new element the field is then set to a slice of.
+type explodedIntermediate struct {
+	v    reflect.Value
+	dest func(v interface{}) interface{}
+}
+
+// newExplodedIntermediate func returns *explodedIntermediate given the slice field v and dest,
+// which returns the sql.Scanner a pointer to a new element of v is scanned through
+func newExplodedIntermediate(v reflect.Value, dest func(v interface{}) interface{}) *explodedIntermediate {
+	return &explodedIntermediate{
+		v:    v,
+		dest: dest,
+	}
+}
+
+// Scan func is implementation of the sql.Scanner's Scan method which sets explodedIntermediate's
+// (v) underlying slice to nil for NULL, or to a slice of the single element src is scanned into.
+func (e *explodedIntermediate) Scan(src interface{}) error {
+	if src == nil {
+		e.v.Set(reflect.Zero(e.v.Type()))
+		return nil
+	}
+	elem := reflect.New(e.v.Type().Elem())
+	scanner, ok := e.dest(elem.Interface()).(sql.Scanner)
+	if !ok {
+		return fmt.Errorf("%T cannot be scanned into %s", src, e.v.Type())
+	}
+	if err := scanner.Scan(src); err != nil {
+		return err
+	}
+	e.v.Set(reflect.Append(reflect.MakeSlice(e.v.Type(), 0, 1), elem.Elem()))
+	return nil
+}
+
+// QuoteIdentifier func returns name quoted as a QuestDB sql identifier (table or column name),
+// the same way CreateTableIfNotExistStatement quotes them. Double quotes within name are
+// escaped by doubling them.
+func QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// unquoteIdentifier func returns name without its surrounding double quotes, if it is a quoted
+// sql identifier such as `"ActiveUsers"`, so that names given either way refer to the same table
+func unquoteIdentifier(name string) string {
+	if len(name) >= 2 && strings.HasPrefix(name, `"`) && strings.HasSuffix(name, `"`) {
+		return strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
+	}
+	return name
+}
+
+// quoteString func returns s as a single quoted sql string literal
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// QuoteLiteral func returns v as a QuestDB sql literal of type qdbType, for comparing against
+// a column of that type in hand written sql. It accepts exactly the Go types, and checks the same
+// ranges, as writing v to a qdbType field does, and quotes values the way they are stored: binary
+// and json values are compared as the base64 encoded strings they are ingested as. A nil v is
+// returned as NULL. An error is returned if v is not compatible with qdbType or does not fit in it.
+//
+// Prefer query arguments where possible; QuoteLiteral is for sql which cannot use them.
+func QuoteLiteral(v interface{}, qdbType QuestDBType) (string, error) {
+	if v == nil {
+		return "NULL", nil
+	}
+
+	// the ILP serialization validates v, integers are written as is without their type suffix
+	v, out, err := serializeValueOf(v, qdbType, lineFormat{legacyIntFormat: true})
+	if err != nil {
+		return "", err
+	}
+
+	switch qdbType {
+	case Boolean, Byte, Short, Int, Long:
+		return out, nil
+	case Float, Double:
+		f, bitSize := 0.0, 64
+		switch val := v.(type) {
+		case float32:
+			f, bitSize = float64(val), 32
+		case float64:
+			f = val
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", fmt.Errorf("value %v has no %s literal", f, qdbType)
+		}
+		return strconv.FormatFloat(f, 'g', -1, bitSize), nil
+	case Char:
+		if val, ok := v.(rune); ok {
+			return quoteString(string(val)), nil
+		}
+		return quoteString(v.(string)), nil
+	case Symbol, String:
+		return quoteString(v.(string)), nil
+	case UUID:
+		// serialized as the quoted, lowercased, hyphenated uuid
+		return quoteString(strings.Trim(out, `"`)), nil
+	case Date, Timestamp:
+		switch val := v.(type) {
+		case int64:
+			return strconv.FormatInt(val, 10), nil
+		case time.Time:
+			if qdbType == Date {
+				return quoteString(val.UTC().Format("2006-01-02T15:04:05.000Z")), nil
+			}
+			return quoteString(val.UTC().Format("2006-01-02T15:04:05.000000Z")), nil
+		}
+	case Binary, JSON:
+		// serialized as the quoted base64 string
+		return quoteString(strings.Trim(out, `"`)), nil
+	case Long256:
+		return v.(Long256Value).String(), nil
+	case DoubleArray, DoubleArray2D:
+		shape, values, err := flattenDoubleArray(v, qdbType)
+		if err != nil {
+			return "", err
+		}
+		for _, f := range values {
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				return "", fmt.Errorf("value %v has no %s literal", f, qdbType)
+			}
+		}
+		return doubleArrayLiteral(shape, values), nil
+	}
+	return "", fmt.Errorf("type %T is not compatible with %s", v, qdbType)
+}
+
+// doubleArrayLiteral func returns the ARRAY literal of the double array of shape holding the row
+// major values, e.g. ARRAY[[1.0,2.0],[3.0,4.0]]. Every element is written with a decimal point
+// or exponent so the literal is a double array.
+func doubleArrayLiteral(shape []int, values []float64) string {
+	var sb strings.Builder
+	sb.WriteString("ARRAY")
+	var write func(dim int)
+	write = func(dim int) {
+		sb.WriteByte('[')
+		for i := 0; i < shape[dim]; i++ {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			if dim == len(shape)-1 {
+				f := strconv.FormatFloat(values[0], 'g', -1, 64)
+				if !strings.ContainsAny(f, ".e") {
+					f += ".0"
+				}
+				sb.WriteString(f)
+				values = values[1:]
+				continue
+			}
+			write(dim + 1)
+		}
+		sb.WriteByte(']')
+	}
+	write(0)
+	return sb.String()
+}
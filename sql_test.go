@@ -0,0 +1,315 @@
+package questdb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testDriver is an in-memory database/sql driver which answers every query with a fixed
+// set of columns and rows. It lets the scanning helpers be exercised end to end without a
+// running QuestDB instance.
+type testDriver struct{}
+
+type testResult struct {
+	columns []string
+	rows    [][]driver.Value
+	// execErr, if set, is called with every executed statement and fails it with its error
+	execErr func(query string, args []driver.Value) error
+	// queryErr, if set, is called with every query and fails it with its error
+	queryErr func(query string) error
+
+	mu sync.Mutex
+	// execs holds the executed statements, including transaction control as BEGIN, COMMIT
+	// and ROLLBACK
+	execs []string
+}
+
+// exec func records query and returns its execErr error
+func (r *testResult) exec(query string, args []driver.Value) error {
+	r.mu.Lock()
+	r.execs = append(r.execs, query)
+	r.mu.Unlock()
+	if r.execErr != nil {
+		return r.execErr(query, args)
+	}
+	return nil
+}
+
+// executed func returns the statements executed so far
+func (r *testResult) executed() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.execs...)
+}
+
+var (
+	testDriverResults sync.Map
+	testDriverDSNs    int64
+)
+
+func init() {
+	sql.Register("questdb-test", testDriver{})
+}
+
+// newTestDB func returns a *sql.DB whose queries all return columns and rows
+func newTestDB(t testing.TB, columns []string, rows ...[]driver.Value) *sql.DB {
+	return openTestDB(t, &testResult{columns: columns, rows: rows})
+}
+
+// newTestExecDB func returns a *sql.DB which records the statements it executes, failing those
+// execErr returns an error for
+func newTestExecDB(t testing.TB, execErr func(query string, args []driver.Value) error) (*sql.DB, *testResult) {
+	result := &testResult{execErr: execErr}
+	return openTestDB(t, result), result
+}
+
+// openTestDB func returns a *sql.DB answering with result
+func openTestDB(t testing.TB, result *testResult) *sql.DB {
+	dsn := fmt.Sprintf("%s-%d", t.Name(), atomic.AddInt64(&testDriverDSNs, 1))
+	testDriverResults.Store(dsn, result)
+	db, err := sql.Open("questdb-test", dsn)
+	if err != nil {
+		t.Fatalf("could not open test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		testDriverResults.Delete(dsn)
+	})
+	return db
+}
+
+func (testDriver) Open(dsn string) (driver.Conn, error) {
+	result, ok := testDriverResults.Load(dsn)
+	if !ok {
+		return nil, fmt.Errorf("unknown test dsn %s", dsn)
+	}
+	return &testConn{result: result.(*testResult)}, nil
+}
+
+type testConn struct {
+	result *testResult
+}
+
+func (c *testConn) Prepare(query string) (driver.Stmt, error) {
+	return &testStmt{result: c.result, query: query}, nil
+}
+
+func (c *testConn) Close() error { return nil }
+
+func (c *testConn) Begin() (driver.Tx, error) {
+	return &testTx{result: c.result}, c.result.exec("BEGIN", nil)
+}
+
+type testTx struct {
+	result *testResult
+}
+
+func (tx *testTx) Commit() error   { return tx.result.exec("COMMIT", nil) }
+func (tx *testTx) Rollback() error { return tx.result.exec("ROLLBACK", nil) }
+
+type testStmt struct {
+	result *testResult
+	query  string
+}
+
+func (s *testStmt) Close() error  { return nil }
+func (s *testStmt) NumInput() int { return -1 }
+
+func (s *testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := s.result.exec(s.query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (s *testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.result.queryErr != nil {
+		if err := s.result.queryErr(s.query); err != nil {
+			return nil, err
+		}
+	}
+	return &testRows{result: s.result}, nil
+}
+
+type testRows struct {
+	result *testResult
+	i      int
+}
+
+func (r *testRows) Columns() []string { return r.result.columns }
+func (r *testRows) Close() error      { return nil }
+
+func (r *testRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.result.rows) {
+		return io.EOF
+	}
+	copy(dest, r.result.rows[r.i])
+	r.i++
+	return nil
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	assert.Equal(t, `"trades"`, QuoteIdentifier("trades"))
+	assert.Equal(t, `"my ""odd"" table"`, QuoteIdentifier(`my "odd" table`))
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	ts := time.Date(2022, 1, 2, 3, 4, 5, 6000, time.UTC)
+	tests := []struct {
+		name    string
+		v       interface{}
+		qdbType QuestDBType
+		want    string
+	}{
+		{"nil", nil, String, "NULL"},
+		{"boolean", true, Boolean, "true"},
+		{"byte", int8(-128), Byte, "-128"},
+		{"int", uint32(7), Int, "7"},
+		{"long", int64(-9), Long, "-9"},
+		{"double", 1.5, Double, "1.5"},
+		{"float", float32(0.1), Float, "0.1"},
+		{"char", 'x', Char, "'x'"},
+		{"symbol", "BTC-USD", Symbol, "'BTC-USD'"},
+		{"string with quote", "it's", String, "'it''s'"},
+		{"injection", "x'; DROP TABLE trades; --", String, "'x''; DROP TABLE trades; --'"},
+		{"timestamp", ts, Timestamp, "'2022-01-02T03:04:05.000006Z'"},
+		{"date", ts, Date, "'2022-01-02T03:04:05.000Z'"},
+		{"binary", []byte("hi"), Binary, "'aGk='"},
+	}
+	for _, tt := range tests {
+		t.Run("should quote "+tt.name, func(t *testing.T) {
+			out, err := QuoteLiteral(tt.v, tt.qdbType)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	t.Run("should return an error for incompatible or overflowing values", func(t *testing.T) {
+		_, err := QuoteLiteral("1", Int)
+		assert.NotNil(t, err)
+
+		_, err = QuoteLiteral(int64(1)<<31, Int)
+		assert.NotNil(t, err)
+
+		_, err = QuoteLiteral(uint8(200), Byte)
+		assert.NotNil(t, err)
+
+		_, err = QuoteLiteral("ab", Char)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestQuoteLiteral_SerializeValue(t *testing.T) {
+	ts := time.Date(2022, 1, 2, 3, 4, 5, 6000, time.UTC)
+	// the values each QuestDBType accepts and rejects, which both paths must agree on
+	tests := []struct {
+		qdbType  QuestDBType
+		accepted []interface{}
+		rejected []interface{}
+		literal  string
+	}{
+		{Boolean, []interface{}{true, testFlag(false)}, []interface{}{1, "true"}, "true"},
+		{Byte, []interface{}{int8(-128)}, []interface{}{uint8(200), 1, int16(1)}, "-128"},
+		{Short, []interface{}{int16(-7), uint8(255), testAge(1)}, []interface{}{int32(1), uint16(1)}, "-7"},
+		{Char, []interface{}{'x', "x", testInitial('x')}, []interface{}{"xy", 1}, "'x'"},
+		{Int, []interface{}{int32(7), uint32(1), int64(math.MinInt32), time.Millisecond}, []interface{}{uint32(math.MaxInt32 + 1), int64(math.MaxInt32 + 1), "1"}, "7"},
+		{Float, []interface{}{float32(0.1)}, []interface{}{0.1, 1}, "0.1"},
+		{Symbol, []interface{}{"BTC-USD", testSymbol("a")}, []interface{}{1, []byte("a")}, "'BTC-USD'"},
+		{String, []interface{}{"it's"}, []interface{}{1, true}, "'it''s'"},
+		{Long, []interface{}{int64(-9), 7, uint32(1), testCount(1), time.Second}, []interface{}{uint64(1), 1.5}, "-9"},
+		{Date, []interface{}{ts, int64(1)}, []interface{}{"2022-01-02", 1}, "'2022-01-02T03:04:05.000Z'"},
+		{Timestamp, []interface{}{ts, int64(1)}, []interface{}{"2022-01-02", 1}, "'2022-01-02T03:04:05.000006Z'"},
+		{Double, []interface{}{1.5, float32(1), testScore(1)}, []interface{}{1, "1.5"}, "1.5"},
+		{Binary, []interface{}{[]byte("hi"), Bytes("hi"), "hi", testPayload("hi")}, []interface{}{1}, "'aGk='"},
+		{JSON, []interface{}{map[string]int{"a": 1}, RawJSON(`{"a":1}`)}, []interface{}{func() {}}, "'eyJhIjoxfQ=='"},
+		{UUID, []interface{}{"A0EEBC99-9C0B-4EF8-BB6D-6BB9BD380A11", [16]byte{}, testUUID{}}, []interface{}{"not a uuid", 1}, "'a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11'"},
+		{Long256, []interface{}{Long256Value{31: 0x1f}}, []interface{}{"0x1f", 1}, "0x1f"},
+		{DoubleArray, []interface{}{[]float64{1, 2.5}, []float32{1}}, []interface{}{[]int64{1}, [][]float64{{1}}}, "ARRAY[1.0,2.5]"},
+		{DoubleArray2D, []interface{}{[][]float64{{1}, {2}}}, []interface{}{[]float64{1}, [][]float64{{1, 2}, {3}}}, "ARRAY[[1.0],[2.0]]"},
+	}
+
+	covered := map[QuestDBType]bool{}
+	for _, tt := range tests {
+		covered[tt.qdbType] = true
+		t.Run("should agree on the values "+string(tt.qdbType)+" accepts", func(t *testing.T) {
+			for _, v := range tt.accepted {
+				_, err := serializeValue(v, tt.qdbType, lineFormat{})
+				assert.Nil(t, err, "%T %v", v, v)
+				_, err = QuoteLiteral(v, tt.qdbType)
+				assert.Nil(t, err, "%T %v", v, v)
+			}
+			for _, v := range tt.rejected {
+				_, err := serializeValue(v, tt.qdbType, lineFormat{})
+				assert.NotNil(t, err, "%T %v", v, v)
+				_, err = QuoteLiteral(v, tt.qdbType)
+				assert.NotNil(t, err, "%T %v", v, v)
+			}
+
+			lit, err := QuoteLiteral(tt.accepted[0], tt.qdbType)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.literal, lit)
+		})
+	}
+	for _, qdbType := range supportedQDBTypes {
+		assert.True(t, covered[qdbType], "%s is not covered", qdbType)
+	}
+}
+
+func TestTimestampIntermediate(t *testing.T) {
+	expected := time.Date(2024, time.January, 2, 3, 4, 5, 678901000, time.UTC)
+	tests := []struct {
+		name string
+		src  interface{}
+	}{
+		{"time.Time", expected.In(time.FixedZone("UTC+2", 2*60*60))},
+		{"int64 microseconds", expected.UnixMicro()},
+		{"RFC 3339", "2024-01-02T03:04:05.678901Z"},
+		{"RFC 3339 with offset", "2024-01-02T05:04:05.678901+02:00"},
+		{"PG text", "2024-01-02 03:04:05.678901"},
+		{"PG text with offset", "2024-01-02 03:04:05.678901+00"},
+		{"ISO without zone", []byte("2024-01-02T03:04:05.678901")},
+	}
+
+	for _, tt := range tests {
+		t.Run("should scan "+tt.name, func(t *testing.T) {
+			var v time.Time
+			assert.Nil(t, newTimestampIntermediate(&v).Scan(tt.src))
+			assert.Equal(t, expected, v)
+		})
+	}
+
+	t.Run("should scan a date", func(t *testing.T) {
+		var v time.Time
+		assert.Nil(t, newTimestampIntermediate(&v).Scan("2024-01-02"))
+		assert.Equal(t, time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC), v)
+	})
+
+	t.Run("should scan NULL as the zero time", func(t *testing.T) {
+		v := expected
+		assert.Nil(t, newTimestampIntermediate(&v).Scan(nil))
+		assert.True(t, v.IsZero())
+	})
+
+	t.Run("should return an error for other values", func(t *testing.T) {
+		var v time.Time
+		assert.NotNil(t, newTimestampIntermediate(&v).Scan("yesterday"))
+		assert.NotNil(t, newTimestampIntermediate(&v).Scan(1.5))
+	})
+
+	t.Run("should scan string timestamps into structs", func(t *testing.T) {
+		db := newTestDB(t, []string{"pair", "price", "ts"}, []driver.Value{"BTC-USD", 1.5, "2024-01-02 03:04:05.678901"})
+
+		read := &testTrade{}
+		assert.Nil(t, ScanInto(db.QueryRow("SELECT * FROM test_trades"), read))
+		assert.Equal(t, expected, read.TS)
+	})
+}
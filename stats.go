@@ -0,0 +1,76 @@
+package questdb
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats struct is a snapshot of a Client's Influx Line Protocol connection statistics
+type Stats struct {
+	// LinesWritten is the total number of ILP lines successfully written
+	LinesWritten int64
+	// BytesWritten is the total number of bytes successfully written
+	BytesWritten int64
+	// Reconnects is the number of times the ILP connection was re-established after the
+	// initial Connect
+	Reconnects int64
+	// LastWriteError is the error returned by the most recent failed write, or nil if no
+	// write has failed
+	LastWriteError error
+	// LastWriteTime is the time of the most recent successful write, or the zero time.Time
+	// if nothing has been written yet
+	LastWriteTime time.Time
+	// QueueDepth is the number of rows waiting in the queues of the Client's running
+	// BatchWriters
+	QueueDepth int64
+	// ILPConnClosed is set once the server has closed the ILP connection, after which writes
+	// fail with ErrILPConnClosed until the Client is connected again
+	ILPConnClosed bool
+}
+
+// stats struct holds a Client's live connection statistics. Counters are updated atomically
+// so they can be read while writes are in flight.
+type stats struct {
+	linesWritten int64
+	bytesWritten int64
+	reconnects   int64
+
+	mu             sync.Mutex
+	lastWriteError error
+	lastWriteTime  time.Time
+}
+
+// recordWrite func records a successful write of lines lines and n bytes at t
+func (s *stats) recordWrite(lines, n int, t time.Time) {
+	atomic.AddInt64(&s.linesWritten, int64(lines))
+	atomic.AddInt64(&s.bytesWritten, int64(n))
+	s.mu.Lock()
+	s.lastWriteTime = t
+	s.mu.Unlock()
+}
+
+// recordWriteError func records a failed write
+func (s *stats) recordWriteError(err error) {
+	s.mu.Lock()
+	s.lastWriteError = err
+	s.mu.Unlock()
+}
+
+// recordReconnect func records that the ILP connection was re-established
+func (s *stats) recordReconnect() {
+	atomic.AddInt64(&s.reconnects, 1)
+}
+
+// snapshot func returns the current statistics as a Stats struct
+func (s *stats) snapshot() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{
+		LinesWritten:   atomic.LoadInt64(&s.linesWritten),
+		BytesWritten:   atomic.LoadInt64(&s.bytesWritten),
+		Reconnects:     atomic.LoadInt64(&s.reconnects),
+		LastWriteError: s.lastWriteError,
+		LastWriteTime:  s.lastWriteTime,
+	}
+}
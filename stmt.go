@@ -0,0 +1,79 @@
+package questdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Stmt struct is a prepared statement over the Postgres wire protocol. Statements are
+// parsed once by QuestDB and can be executed many times with different arguments.
+// A Stmt is closed automatically when the Client which prepared it is closed.
+type Stmt struct {
+	client *Client
+	stmt   *sql.Stmt
+}
+
+// Prepare func creates a prepared statement for query over the PG wire. The returned *Stmt
+// should be closed with Close once it is no longer needed.
+func (c *Client) Prepare(ctx context.Context, query string) (*Stmt, error) {
+	stmt, err := c.db().PrepareContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("could not prepare statement: %w", err)
+	}
+
+	s := &Stmt{
+		client: c,
+		stmt:   stmt,
+	}
+
+	c.stmtsMu.Lock()
+	if c.stmts == nil {
+		c.stmts = map[*Stmt]struct{}{}
+	}
+	c.stmts[s] = struct{}{}
+	c.stmtsMu.Unlock()
+
+	return s, nil
+}
+
+// QueryRow func executes the prepared statement with args and returns at most one row
+func (s *Stmt) QueryRow(ctx context.Context, args ...interface{}) *sql.Row {
+	return s.stmt.QueryRowContext(ctx, args...)
+}
+
+// Query func executes the prepared statement with args and returns the resulting rows
+func (s *Stmt) Query(ctx context.Context, args ...interface{}) (*sql.Rows, error) {
+	return s.stmt.QueryContext(ctx, args...)
+}
+
+// ScanInto func executes the prepared statement with args and scans the first row into
+// dest (a valid qdb model struct). See ScanInto.
+func (s *Stmt) ScanInto(ctx context.Context, dest interface{}, args ...interface{}) error {
+	return ScanInto(s.QueryRow(ctx, args...), dest)
+}
+
+// Close func closes the prepared statement
+func (s *Stmt) Close() error {
+	s.client.stmtsMu.Lock()
+	delete(s.client.stmts, s)
+	s.client.stmtsMu.Unlock()
+	return s.stmt.Close()
+}
+
+// closeStmts func closes every statement prepared by c which is still open, returning the
+// errors of any which could not be closed
+func (c *Client) closeStmts() error {
+	c.stmtsMu.Lock()
+	stmts := c.stmts
+	c.stmts = nil
+	c.stmtsMu.Unlock()
+
+	errs := []error{}
+	for s := range stmts {
+		if err := s.stmt.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
@@ -0,0 +1,66 @@
+package questdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Prepare(t *testing.T) {
+	t.Run("should scan prepared statement results into a model", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+		client.pgSqlDB = newTestDB(t, []string{"name", "value"}, []driver.Value{"a", int64(42)})
+
+		stmt, err := client.Prepare(context.Background(), "SELECT name, value FROM test_rows WHERE name = $1")
+		assert.Nil(t, err)
+
+		for i := 0; i < 3; i++ {
+			row := &testRow{}
+			err = stmt.ScanInto(context.Background(), row, "a")
+			assert.Nil(t, err)
+			assert.Equal(t, testRow{Name: "a", Value: 42}, *row)
+		}
+
+		assert.Nil(t, stmt.Close())
+		assert.Len(t, client.stmts, 0)
+	})
+
+	t.Run("should close open statements when the client is closed", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+		client.pgSqlDB = newTestDB(t, []string{"name", "value"}, []driver.Value{"a", int64(42)})
+
+		stmt, err := client.Prepare(context.Background(), "SELECT name, value FROM test_rows")
+		assert.Nil(t, err)
+
+		assert.Nil(t, client.Close())
+
+		err = stmt.QueryRow(context.Background()).Err()
+		assert.EqualError(t, err, "sql: statement is closed")
+		assert.Len(t, client.stmts, 0)
+	})
+
+	t.Run("should close every open statement when the client is closed", func(t *testing.T) {
+		server := newTestILPServer(t)
+		client := server.client(t)
+		client.pgSqlDB = newTestDB(t, []string{"name", "value"}, []driver.Value{"a", int64(42)})
+
+		stmts := []*Stmt{}
+		for i := 0; i < 3; i++ {
+			stmt, err := client.Prepare(context.Background(), "SELECT name, value FROM test_rows")
+			assert.Nil(t, err)
+			stmts = append(stmts, stmt)
+		}
+
+		assert.Nil(t, client.Close())
+
+		for _, stmt := range stmts {
+			err := stmt.QueryRow(context.Background()).Err()
+			assert.EqualError(t, err, "sql: statement is closed")
+		}
+		assert.Len(t, client.stmts, 0)
+	})
+}
@@ -2,7 +2,10 @@ package questdb
 
 import (
 	"fmt"
+	"reflect"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const tagName = "qdb"
@@ -11,7 +14,8 @@ const tagName = "qdb"
 // each one being set is valid. If not, it will return an error.
 func ensureOptionsAreValid(opts []string) error {
 	for _, v := range opts {
-		vSplit := strings.Split(v, ":")
+		// option values may themselves contain ':' (e.g. 'timeFormat:15:04')
+		vSplit := strings.SplitN(v, ":", 2)
 		if len(vSplit) != 2 {
 			return fmt.Errorf("'%s' is not valid option", v)
 		}
@@ -25,7 +29,7 @@ func ensureOptionsAreValid(opts []string) error {
 // If that option is not set in the struct field, it will return an empty string ("").
 func getOption(opts []string, option string) string {
 	for _, v := range opts {
-		vSplit := strings.Split(v, ":")
+		vSplit := strings.SplitN(v, ":", 2)
 		optName := vSplit[0]
 		optVal := vSplit[1]
 		if option == optName {
@@ -41,12 +45,59 @@ type tagOptions struct {
 	designatedTS    bool
 	commitZeroValue bool
 	index           bool
+	// durationUnit is the unit time.Duration values are counted in when serialized
+	durationUnit time.Duration
+	// boolAsInt stores a boolean field in an int column as 1 or 0
+	boolAsInt bool
+	// symbolOrdered is set if the 'symbolOrder' option is, in which case symbolOrder is the
+	// position of the symbol within the ILP message
+	symbolOrdered bool
+	symbolOrder   int
+	// timeFormat is the time.Parse layout of a string field stored in a date or timestamp column
+	timeFormat string
+	// emitEmptySymbol writes an empty symbol value rather than omitting it
+	emitEmptySymbol bool
+	// tsUnit is the unit an int64 timestamp field counts since the Unix epoch
+	tsUnit time.Duration
+	// explode writes a line per element of a slice field
+	explode bool
+	// floatFormat is set if the 'floatFmt' option is, in which case float values are formatted by
+	// strconv.FormatFloat with floatVerb and floatPrec
+	floatFormat bool
+	floatVerb   byte
+	floatPrec   int
 }
 
+// durationUnits maps the valid 'durationUnit' option values to their time.Duration
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
 // makeTagOptions func takes a tagOpts []string and returns a tagOptions struct
 func makeTagOptions(f *field, tagsOpts []string) (tagOptions, error) {
 	opts := tagOptions{}
 
+	// explode. A slice field tagged 'explode:true' is written as one line per element, each with
+	// the element as the field's value and every other field's value, so the other fields
+	// (symbols, columns and designated timestamp) are shared by all the lines. The column holds
+	// a single element, so the other options and the type apply to the element type. An empty
+	// slice writes no lines.
+	typ := f.typ
+	if getOption(tagsOpts, "explode") == "true" {
+		if f.typ.Kind() != reflect.Slice || f.typ.Elem().Kind() == reflect.Ptr {
+			return opts, fmt.Errorf("'explode:true' option can only be set on slices of non pointers not %s", f.typ)
+		}
+		if getOption(tagsOpts, "designatedTS") == "true" {
+			return opts, fmt.Errorf("the designated timestamp cannot be exploded")
+		}
+		opts.explode = true
+		typ = f.typ.Elem()
+	}
+
 	// embeddedPrefix
 	embeddedPrefix := getOption(tagsOpts, "embeddedPrefix")
 	if embeddedPrefix != "" {
@@ -77,5 +128,167 @@ func makeTagOptions(f *field, tagsOpts []string) (tagOptions, error) {
 		opts.index = true
 	}
 
+	// duration unit
+	durationUnit := getOption(tagsOpts, "durationUnit")
+	if durationUnit != "" {
+		unit, ok := durationUnits[durationUnit]
+		if !ok {
+			return opts, fmt.Errorf("'durationUnit' must be one of ns, us or ms not '%s'", durationUnit)
+		}
+		if f.qdbType != Long && f.qdbType != Int {
+			return opts, fmt.Errorf("type must be long or int not %s if 'durationUnit' option set", f.qdbType)
+		}
+		if indirectType(typ) != durationType {
+			return opts, fmt.Errorf("'durationUnit' option can only be set on time.Duration fields not %s", typ)
+		}
+		opts.durationUnit = unit
+	}
+
+	// boolean as int. A boolean field tagged 'boolAs:int' is stored in an int column rather than
+	// a boolean one: the create table statement declares the column as int and values are sent
+	// as 1i/0i. This suits tooling which aggregates flags numerically (e.g. sum() of the column
+	// counts the true rows), at the cost of QuestDB no longer knowing the column is a boolean:
+	// queries must compare against 1/0 and nothing stops other writers storing other integers.
+	// Scanning converts the stored integer back into a Go bool (non zero is true). As with any
+	// zero value, false is only written if 'commitZeroValue:true' is also set.
+	boolAs := getOption(tagsOpts, "boolAs")
+	if boolAs != "" {
+		if boolAs != "int" {
+			return opts, fmt.Errorf("'boolAs' must be int not '%s'", boolAs)
+		}
+		if f.qdbType != Boolean {
+			return opts, fmt.Errorf("type must be boolean not %s if 'boolAs' option set", f.qdbType)
+		}
+		opts.boolAsInt = true
+	}
+
+	// symbol order. Symbols with a 'symbolOrder' option are written in ascending order before
+	// symbols without one, which keep their field order.
+	symbolOrder := getOption(tagsOpts, "symbolOrder")
+	if symbolOrder != "" {
+		if f.qdbType != Symbol {
+			return opts, fmt.Errorf("type must be symbol not %s if 'symbolOrder' option set", f.qdbType)
+		}
+		order, err := strconv.Atoi(symbolOrder)
+		if err != nil || order < 0 {
+			return opts, fmt.Errorf("'symbolOrder' must be a non negative integer not '%s'", symbolOrder)
+		}
+		opts.symbolOrdered = true
+		opts.symbolOrder = order
+	}
+
+	// time format. A string field tagged 'timeFormat:<layout>' is parsed with the layout and
+	// stored as a date or timestamp. Scanning formats the column value back with the layout.
+	timeFormat := getOption(tagsOpts, "timeFormat")
+	if timeFormat != "" {
+		if f.qdbType != Date && f.qdbType != Timestamp {
+			return opts, fmt.Errorf("type must be date or timestamp not %s if 'timeFormat' option set", f.qdbType)
+		}
+		if indirectType(typ).Kind() != reflect.String {
+			return opts, fmt.Errorf("'timeFormat' option can only be set on string fields not %s", typ)
+		}
+		opts.timeFormat = timeFormat
+	}
+
+	// emit empty symbol. Omitting a symbol from a line stores null, so by default an empty symbol
+	// field is stored as null. A symbol field tagged 'emitEmptySymbol:true' is written as 'name='
+	// when empty, storing an empty symbol distinct from null, while a nil *string field is still
+	// omitted (null). 'commitZeroValue:true' also writes empty symbols, but cannot tell a nil
+	// pointer apart. String columns have no such option: with 'commitZeroValue:true' an empty
+	// string is written as "" and is likewise distinct from null.
+	emitEmptySymbol := getOption(tagsOpts, "emitEmptySymbol")
+	if emitEmptySymbol == "true" {
+		if f.qdbType != Symbol {
+			return opts, fmt.Errorf("type must be symbol not %s if 'emitEmptySymbol:true' option set", f.qdbType)
+		}
+		opts.emitEmptySymbol = true
+	}
+
+	// timestamp unit. An int64 field stored in a timestamp column holds a count of microseconds
+	// since the Unix epoch, QuestDB's timestamp resolution. A field tagged 'tsUnit:<unit>' holds a
+	// count of the unit (ns, us or ms) instead, and is converted when written (including as the
+	// designated timestamp) and scanned.
+	tsUnit := getOption(tagsOpts, "tsUnit")
+	if tsUnit != "" {
+		unit, ok := durationUnits[tsUnit]
+		if !ok {
+			return opts, fmt.Errorf("'tsUnit' must be one of ns, us or ms not '%s'", tsUnit)
+		}
+		if f.qdbType != Timestamp {
+			return opts, fmt.Errorf("type must be timestamp not %s if 'tsUnit' option set", f.qdbType)
+		}
+		if !isEpochType(typ) {
+			return opts, fmt.Errorf("'tsUnit' option can only be set on int64 fields not %s", typ)
+		}
+		opts.tsUnit = unit
+	}
+
+	// float format. Floats are written at full precision with the 'g' verb by default, the
+	// shortest representation which reads back as the same value. A double or float field tagged
+	// 'floatFmt:<verb>[:<precision>]' is formatted by strconv.FormatFloat with the verb (e, E, f,
+	// g or G) and precision instead, e.g. 'floatFmt:f:2' for money. Without a precision, the value
+	// is written at full precision.
+	floatFmt := getOption(tagsOpts, "floatFmt")
+	if floatFmt != "" {
+		verb, prec, err := parseFloatFormat(floatFmt)
+		if err != nil {
+			return opts, err
+		}
+		if f.qdbType != Double && f.qdbType != Float {
+			return opts, fmt.Errorf("type must be double or float not %s if 'floatFmt' option set", f.qdbType)
+		}
+		if kind := indirectType(typ).Kind(); kind != reflect.Float32 && kind != reflect.Float64 {
+			return opts, fmt.Errorf("'floatFmt' option can only be set on float fields not %s", typ)
+		}
+		opts.floatFormat = true
+		opts.floatVerb = verb
+		opts.floatPrec = prec
+	}
+
 	return opts, nil
 }
+
+// parseFloatFormat func parses a 'floatFmt' option value, <verb>[:<precision>], into the verb and
+// precision of strconv.FormatFloat. The precision is -1 (full precision) if it is not set.
+func parseFloatFormat(spec string) (byte, int, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts[0]) != 1 || !strings.Contains("eEfgG", parts[0]) {
+		return 0, 0, fmt.Errorf("'floatFmt' verb must be one of e, E, f, g or G not '%s'", parts[0])
+	}
+	prec := -1
+	if len(parts) == 2 {
+		var err error
+		prec, err = strconv.Atoi(parts[1])
+		if err != nil || prec < 0 {
+			return 0, 0, fmt.Errorf("'floatFmt' precision must be a non negative integer not '%s'", parts[1])
+		}
+	}
+	return parts[0][0], prec, nil
+}
+
+// isEpochType func returns whether t (or the type it points to) is an int64 which can hold a
+// count of time since the Unix epoch
+func isEpochType(t reflect.Type) bool {
+	t = indirectType(t)
+	return t.Kind() == reflect.Int64 && t != durationType
+}
+
+// epochTime func returns the time n units after the Unix epoch. A unit of 0 means microseconds.
+func epochTime(n int64, unit time.Duration) time.Time {
+	switch unit {
+	case time.Nanosecond:
+		return time.Unix(0, n)
+	case time.Millisecond:
+		return time.UnixMilli(n)
+	default:
+		return time.UnixMicro(n)
+	}
+}
+
+// indirectType func returns the type pointed to by t if t is a pointer, else t
+func indirectType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,71 @@
+package questdb
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// Tracer is the interface Client uses to trace ILP writes and PG queries. It lets users bridge
+// to the tracing library of their choice (i.e. OpenTelemetry) without this package depending on
+// it. StartSpan starts a span called name with attrs attached and returns the context carrying
+// the span along with a func which ends the span, recording err if it is not nil.
+type Tracer interface {
+	StartSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, func(err error))
+}
+
+// Attribute struct is a key/value pair recorded on a span started by a Tracer
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// span attribute keys recorded by Client
+const (
+	AttributeTable     = "questdb.table"
+	AttributeLines     = "questdb.lines"
+	AttributeBytes     = "questdb.bytes"
+	AttributeStatement = "db.statement"
+)
+
+// noopTracer struct is the Tracer used when Config.Tracer is not set
+type noopTracer struct{}
+
+// StartSpan func implements the Tracer interface and does nothing
+func (noopTracer) StartSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, func(err error)) {
+	return ctx, func(error) {}
+}
+
+// tracer func returns the client's configured Tracer or a no-op Tracer
+func (c *Client) tracer() Tracer {
+	if c.config.Tracer != nil {
+		return c.config.Tracer
+	}
+	return noopTracer{}
+}
+
+// traceWrite func writes b (holding lines for tables) to the ILP connection within a span called name
+func (c *Client) traceWrite(ctx context.Context, name string, tables []string, b []byte, lines int) error {
+	ctx, finish := c.tracer().StartSpan(ctx, name,
+		Attribute{Key: AttributeTable, Value: strings.Join(uniqueSorted(tables), ",")},
+		Attribute{Key: AttributeLines, Value: lines},
+		Attribute{Key: AttributeBytes, Value: len(b)},
+	)
+	err := c.write(ctx, b, lines)
+	finish(err)
+	return err
+}
+
+// uniqueSorted func returns the sorted unique strings of s
+func uniqueSorted(s []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, v := range s {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,130 @@
+package questdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testSpan is a span recorded by testTracer
+type testSpan struct {
+	name  string
+	attrs map[string]interface{}
+	err   error
+	ended bool
+}
+
+// testTracer is a Tracer which records every span started
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (tr *testTracer) StartSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, func(err error)) {
+	span := &testSpan{name: name, attrs: map[string]interface{}{}}
+	for _, attr := range attrs {
+		span.attrs[attr.Key] = attr.Value
+	}
+	tr.mu.Lock()
+	tr.spans = append(tr.spans, span)
+	tr.mu.Unlock()
+	return ctx, func(err error) {
+		span.err = err
+		span.ended = true
+	}
+}
+
+func TestClient_Tracer(t *testing.T) {
+	t.Run("should record a span around batch writes", func(t *testing.T) {
+		server := newTestILPServer(t)
+		tracer := &testTracer{}
+		client, err := New(Config{ILPHost: server.ln.Addr().String(), Tracer: tracer})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+
+		rows := []interface{}{testRow{Name: "a", Value: 1}, testTrade{Pair: "BTC-USD", Price: 1}}
+		assert.Nil(t, client.WriteBatch(rows))
+
+		assert.Len(t, tracer.spans, 1)
+		span := tracer.spans[0]
+		assert.Equal(t, "questdb.WriteBatch", span.name)
+		assert.Equal(t, "test_rows,test_trades", span.attrs[AttributeTable])
+		assert.Equal(t, 2, span.attrs[AttributeLines])
+		assert.Equal(t, len(server.waitFor(span.attrs[AttributeBytes].(int))), span.attrs[AttributeBytes])
+		assert.True(t, span.ended)
+		assert.Nil(t, span.err)
+	})
+
+	t.Run("should record a span around each flush of WriteFrom and BatchWriters", func(t *testing.T) {
+		server := newTestILPServer(t)
+		tracer := &testTracer{}
+		client, err := New(Config{ILPHost: server.ln.Addr().String(), Tracer: tracer})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+
+		ch := make(chan interface{}, 2)
+		ch <- testRow{Name: "a", Value: 1}
+		ch <- testTrade{Pair: "BTC-USD", Price: 1}
+		close(ch)
+		assert.Nil(t, client.WriteFrom(context.Background(), ch))
+
+		w := client.NewBatchWriter(context.Background())
+		assert.Nil(t, w.Add(testRow{Name: "b", Value: 2}))
+		assert.Nil(t, w.Close())
+
+		assert.Len(t, tracer.spans, 2)
+		assert.Equal(t, "questdb.WriteFrom", tracer.spans[0].name)
+		assert.Equal(t, "test_rows,test_trades", tracer.spans[0].attrs[AttributeTable])
+		assert.Equal(t, 2, tracer.spans[0].attrs[AttributeLines])
+		assert.Equal(t, "questdb.WriteFrom", tracer.spans[1].name)
+		assert.Equal(t, "test_rows", tracer.spans[1].attrs[AttributeTable])
+		assert.Equal(t, 1, tracer.spans[1].attrs[AttributeLines])
+		assert.True(t, tracer.spans[1].ended)
+	})
+
+	t.Run("should record write errors on the span", func(t *testing.T) {
+		server := newTestILPServer(t)
+		tracer := &testTracer{}
+		client, err := New(Config{ILPHost: server.ln.Addr().String(), Tracer: tracer})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+		client.ilpConn.Close()
+
+		err = client.Write(testRow{Name: "a", Value: 1})
+		assert.NotNil(t, err)
+
+		assert.Len(t, tracer.spans, 1)
+		assert.Equal(t, "questdb.Write", tracer.spans[0].name)
+		assert.Equal(t, "test_rows", tracer.spans[0].attrs[AttributeTable])
+		assert.Equal(t, err, tracer.spans[0].err)
+	})
+
+	t.Run("should record a span around queries", func(t *testing.T) {
+		server := newTestILPServer(t)
+		tracer := &testTracer{}
+		client, err := New(Config{ILPHost: server.ln.Addr().String(), Tracer: tracer})
+		assert.Nil(t, err)
+		assert.Nil(t, client.Connect())
+		client.pgSqlDB = newTestDB(t, []string{"count"}, []driver.Value{int64(1)})
+
+		count := 0
+		assert.Nil(t, client.QueryRow("SELECT count() FROM test_rows").Scan(&count))
+
+		assert.Len(t, tracer.spans, 1)
+		assert.Equal(t, "questdb.QueryRow", tracer.spans[0].name)
+		assert.Equal(t, "SELECT count() FROM test_rows", tracer.spans[0].attrs[AttributeStatement])
+		assert.True(t, tracer.spans[0].ended)
+	})
+
+	t.Run("should use a no-op tracer by default", func(t *testing.T) {
+		client, err := New(Config{})
+		assert.Nil(t, err)
+
+		_, finish := client.tracer().StartSpan(context.Background(), "noop")
+		finish(errors.New("ignored"))
+	})
+}
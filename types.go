@@ -3,9 +3,14 @@ package questdb
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"reflect"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // QuestDBType is string which represents a type in the QuestDb world
@@ -36,25 +41,174 @@ var (
 	Long QuestDBType = "long"
 	// 64-bit signed offset in milliseconds from Unix Epoch
 	Date QuestDBType = "date"
-	// 64-bit signed offset in microseconds from Unix Epoch
+	// 64-bit signed offset in microseconds from Unix Epoch. QuestDB stores timestamps at
+	// microsecond resolution, so any finer precision written to a timestamp column (see
+	// TimestampResolution) is truncated by the server.
 	Timestamp QuestDBType = "timestamp"
 	// 64-bit float (float64 - double precision IEEE 754)
 	Double QuestDBType = "double"
 	// byte array
 	Binary QuestDBType = "binary"
-	// hyphenated uuid string
+	// 128-bit uuid, for hyphenated uuid strings or 16 byte arrays such as uuid.UUID
 	UUID QuestDBType = "uuid"
-	// 256-bit unsigned integer
-	//		unsupported
+	// 256-bit unsigned integer (see Long256Value)
 	Long256 QuestDBType = "long256"
+	// 1-dimensional array of 64-bit floats, for []float64 or []float32 fields (e.g. embedding
+	// vectors). Arrays are written in the ILP binary format, which needs QuestDB 9.0 or later.
+	DoubleArray QuestDBType = "double[]"
+	// 2-dimensional array of 64-bit floats, for rectangular [][]float64 or [][]float32 fields
+	DoubleArray2D QuestDBType = "double[][]"
 	// Geohash
 	// 		unsupported
 	Geohash QuestDBType = "geohash"
 )
 
-// serializeValue func takes a value interface{} and a QuestDBType and returns the
-// serialized string of that value according to the provided QuestDBType.
-func serializeValue(v interface{}, qdbType QuestDBType) (string, error) {
+// TimestampResolution is the resolution timestamp column values are written to the ILP port
+// at. It does not affect the designated timestamp ending each line, which is always written in
+// nanoseconds.
+type TimestampResolution int
+
+const (
+	// MicrosecondResolution writes timestamp columns as microseconds with the `t` suffix,
+	// matching QuestDB's storage resolution. This is the default.
+	MicrosecondResolution TimestampResolution = iota
+	// NanosecondResolution writes timestamp columns as nanoseconds with the `n` suffix. QuestDB
+	// still stores the column at microsecond resolution, truncating the extra precision, and
+	// times outside the range of an int64 count of nanoseconds (years 1678 to 2262) cannot be
+	// written.
+	NanosecondResolution
+)
+
+// lineFormat struct holds settings which control how values are serialized into an
+// Influx Line Protocol message. The zero value is the standard QuestDB format.
+type lineFormat struct {
+	// legacyIntFormat omits the `i` suffix of integer values and the `t` suffix of
+	// timestamp values.
+	legacyIntFormat bool
+	// timestampResolution is the resolution timestamp column values are written at
+	timestampResolution TimestampResolution
+	// dialect is the ILP dialect of the line, StandardILPDialect if nil
+	dialect *ILPDialect
+}
+
+// ilpDialect func returns the ILP dialect the format writes lines in
+func (f lineFormat) ilpDialect() ILPDialect {
+	if f.dialect != nil {
+		return *f.dialect
+	}
+	return StandardILPDialect
+}
+
+// intSuffix func returns the suffix appended to integer values
+func (f lineFormat) intSuffix() string {
+	if f.legacyIntFormat {
+		return ""
+	}
+	return f.ilpDialect().IntSuffix
+}
+
+// timestampSuffix func returns the suffix appended to timestamp column values
+func (f lineFormat) timestampSuffix() string {
+	if f.legacyIntFormat {
+		return ""
+	}
+	if f.timestampResolution == NanosecondResolution {
+		return f.ilpDialect().NanosecondTimestampSuffix
+	}
+	return f.ilpDialect().TimestampSuffix
+}
+
+// formatTimestamp func returns t as a count of the format's timestamp resolution since the Unix
+// epoch
+func (f lineFormat) formatTimestamp(t time.Time) (string, error) {
+	if f.timestampResolution == NanosecondResolution {
+		if t.Before(minLineTimestamp) || t.After(maxLineTimestamp) {
+			return "", fmt.Errorf("timestamp %s is outside the range of nanosecond timestamps", t.Format(time.RFC3339))
+		}
+		return fmt.Sprintf("%d%s", t.UnixNano(), f.timestampSuffix()), nil
+	}
+	return fmt.Sprintf("%d%s", t.UnixMicro(), f.timestampSuffix()), nil
+}
+
+// basicTypes maps the kinds of the basic types to the types themselves
+var basicTypes = map[reflect.Kind]reflect.Type{
+	reflect.Bool:    reflect.TypeOf(false),
+	reflect.Int:     reflect.TypeOf(int(0)),
+	reflect.Int8:    reflect.TypeOf(int8(0)),
+	reflect.Int16:   reflect.TypeOf(int16(0)),
+	reflect.Int32:   reflect.TypeOf(int32(0)),
+	reflect.Int64:   reflect.TypeOf(int64(0)),
+	reflect.Uint:    reflect.TypeOf(uint(0)),
+	reflect.Uint8:   reflect.TypeOf(uint8(0)),
+	reflect.Uint16:  reflect.TypeOf(uint16(0)),
+	reflect.Uint32:  reflect.TypeOf(uint32(0)),
+	reflect.Uint64:  reflect.TypeOf(uint64(0)),
+	reflect.Float32: reflect.TypeOf(float32(0)),
+	reflect.Float64: reflect.TypeOf(float64(0)),
+	reflect.String:  reflect.TypeOf(""),
+}
+
+// underlyingValue func returns v converted to its underlying basic type (or []byte, or [16]byte
+// for uuids) if v is of a named type such as `type Age int16` or uuid.UUID, and whether it was
+// converted
+func underlyingValue(v interface{}) (interface{}, bool) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return nil, false
+	}
+	t, ok := basicTypes[rv.Kind()]
+	if !ok && rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+		t, ok = reflect.TypeOf([]byte{}), true
+	}
+	if !ok && isUUIDType(rv.Type()) {
+		t, ok = uuidType, true
+	}
+	if !ok || rv.Type() == t {
+		return nil, false
+	}
+	return rv.Convert(t).Interface(), true
+}
+
+// serializeValue func takes a value interface{}, a QuestDBType and a lineFormat and returns the
+// serialized string of that value according to the provided QuestDBType. A value of a named type
+// which is not itself supported is serialized as its underlying basic type.
+func serializeValue(v interface{}, qdbType QuestDBType, format lineFormat) (string, error) {
+	_, out, err := serializeValueOf(v, qdbType, format)
+	return out, err
+}
+
+// serializeValueOf func is serializeValue which also returns the value which was serialized: v,
+// or v converted to its underlying basic type if only that is compatible with qdbType. It is the
+// one place the Go types each QuestDBType accepts are checked, for ILP lines and sql literals alike.
+func serializeValueOf(v interface{}, qdbType QuestDBType, format lineFormat) (interface{}, string, error) {
+	out, err := serializeTypedValue(v, qdbType, format)
+	var incompatible *incompatibleTypeError
+	if errors.As(err, &incompatible) {
+		if base, ok := underlyingValue(v); ok {
+			baseOut, baseErr := serializeTypedValue(base, qdbType, format)
+			// report the named type rather than its underlying type if neither is compatible
+			if !errors.As(baseErr, &incompatible) {
+				return base, baseOut, baseErr
+			}
+		}
+	}
+	return v, out, err
+}
+
+// incompatibleTypeError struct is the error serializeTypedValue returns when the type of a value
+// is not compatible with its QuestDBType
+type incompatibleTypeError struct {
+	v       interface{}
+	qdbType QuestDBType
+}
+
+// Error func implements the error interface
+func (e *incompatibleTypeError) Error() string {
+	return fmt.Sprintf("type %T is not compatible with %s", e.v, e.qdbType)
+}
+
+// serializeTypedValue func is serializeValue for the exact types of v each QuestDBType accepts
+func serializeTypedValue(v interface{}, qdbType QuestDBType, format lineFormat) (string, error) {
 	switch qdbType {
 	case Boolean:
 		switch val := v.(type) {
@@ -62,29 +216,58 @@ func serializeValue(v interface{}, qdbType QuestDBType) (string, error) {
 			return fmt.Sprintf("%t", val), nil
 		}
 	case Byte:
+		// QuestDB reads an unsuffixed number as a double, which it does not cast to a byte
+		// column, so bytes take the integer suffix like the other integer types
 		switch val := v.(type) {
 		case int8:
-			return fmt.Sprintf("%d", val), nil
+			return fmt.Sprintf("%d%s", val, format.intSuffix()), nil
 		}
 	case Short:
 		switch val := v.(type) {
 		case uint8, int8, int16:
-			return fmt.Sprintf("%di", val), nil
+			return fmt.Sprintf("%d%s", val, format.intSuffix()), nil
 		}
 	case Char:
+		// sent as a one character string field, the only ILP value QuestDB writes to a char column
 		switch val := v.(type) {
 		case rune:
-			return fmt.Sprintf("%c", val), nil
+			return quoteEscape(string(val), needsEscapeForStr, quoteStringFn), nil
+		case string:
+			if utf8.RuneCountInString(val) != 1 {
+				return "", fmt.Errorf("string '%s' must be exactly one character long to be a %s", val, qdbType)
+			}
+			return quoteEscape(val, needsEscapeForStr, quoteStringFn), nil
 		}
 	case Int:
 		switch val := v.(type) {
 		case uint8, int8, uint16, int16, int32:
-			return fmt.Sprintf("%di", val), nil
+			return fmt.Sprintf("%d%s", val, format.intSuffix()), nil
+		case uint32:
+			if val > math.MaxInt32 {
+				return "", fmt.Errorf("value %d overflows %s", val, qdbType)
+			}
+			return fmt.Sprintf("%d%s", val, format.intSuffix()), nil
+		case uint:
+			if val > math.MaxInt32 {
+				return "", fmt.Errorf("value %d overflows %s", val, qdbType)
+			}
+			return fmt.Sprintf("%d%s", val, format.intSuffix()), nil
+		case int64:
+			if val > math.MaxInt32 || val < math.MinInt32 {
+				return "", fmt.Errorf("value %d overflows %s", val, qdbType)
+			}
+			return fmt.Sprintf("%d%s", val, format.intSuffix()), nil
+		case time.Duration:
+			// durations are sent as their nanosecond count
+			if val > math.MaxInt32 || val < math.MinInt32 {
+				return "", fmt.Errorf("value %d overflows %s", val, qdbType)
+			}
+			return fmt.Sprintf("%d%s", int64(val), format.intSuffix()), nil
 		}
 	case Float:
 		switch val := v.(type) {
 		case float32:
-			return fmt.Sprintf("%f", val), nil
+			return strconv.FormatFloat(float64(val), 'g', -1, 32), nil
 		}
 	case Symbol:
 		switch val := v.(type) {
@@ -99,26 +282,32 @@ func serializeValue(v interface{}, qdbType QuestDBType) (string, error) {
 	case Long:
 		switch val := v.(type) {
 		case uint8, int8, uint16, int16, uint32, int32, int64, int:
-			return fmt.Sprintf("%di", val), nil
+			return fmt.Sprintf("%d%s", val, format.intSuffix()), nil
+		case time.Duration:
+			// durations are sent as their nanosecond count
+			return fmt.Sprintf("%d%s", int64(val), format.intSuffix()), nil
 		}
 	case Date:
+		// a millisecond count, which like a byte must be an integer to be cast to a date column
 		switch val := v.(type) {
 		case int64:
-			return fmt.Sprintf("%d", val), nil
+			return fmt.Sprintf("%d%s", val, format.intSuffix()), nil
 		case time.Time:
-			return fmt.Sprintf("%d", val.UnixMilli()), nil
+			return fmt.Sprintf("%d%s", val.UnixMilli(), format.intSuffix()), nil
 		}
 	case Timestamp:
 		switch val := v.(type) {
 		case int64:
-			return fmt.Sprintf("%dt", val), nil
+			return fmt.Sprintf("%d%s", val, format.timestampSuffix()), nil
 		case time.Time:
-			return fmt.Sprintf("%dt", val.UnixMicro()), nil
+			return format.formatTimestamp(val)
 		}
 	case Double:
 		switch val := v.(type) {
-		case float32, float64:
-			return fmt.Sprintf("%f", val), nil
+		case float32:
+			return strconv.FormatFloat(float64(val), 'g', -1, 32), nil
+		case float64:
+			return strconv.FormatFloat(val, 'g', -1, 64), nil
 		}
 	case Binary:
 		switch val := v.(type) {
@@ -136,16 +325,35 @@ func serializeValue(v interface{}, qdbType QuestDBType) (string, error) {
 		}
 		return fmt.Sprintf("\"%s\"", base64.StdEncoding.EncodeToString(by)), nil
 	case UUID:
-		// sent in as a hyphenated uuid string
+		// sent in as a hyphenated uuid string, validated (and lowercased) by parsing it
 		switch val := v.(type) {
 		case string:
-			return fmt.Sprintf("\"%s\"", val), nil
+			u, err := parseUUID(val)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("\"%s\"", formatUUID(u)), nil
+		case [16]byte:
+			return fmt.Sprintf("\"%s\"", formatUUID(val)), nil
+		}
+	case DoubleArray, DoubleArray2D:
+		shape, values, err := flattenDoubleArray(v, qdbType)
+		if err != nil {
+			return "", err
+		}
+		return encodeDoubleArray(shape, values), nil
+	case Long256:
+		// sent as hex with the 'i' suffix, which is part of the long256 syntax rather than an
+		// integer suffix so it is kept in the legacy format
+		switch val := v.(type) {
+		case Long256Value:
+			return fmt.Sprintf("%si", val), nil
 		}
 
 	default:
-		return "", fmt.Errorf("type %T is not compatible with %s", v, qdbType)
+		return "", &incompatibleTypeError{v: v, qdbType: qdbType}
 	}
-	return "", fmt.Errorf("type %T is not compatible with %s", v, qdbType)
+	return "", &incompatibleTypeError{v: v, qdbType: qdbType}
 }
 
 // Quote and escape an ILP input value, returns new string that is properly quoted and escaped.
@@ -195,11 +403,14 @@ var supportedQDBTypes = []QuestDBType{
 	Binary,
 	JSON,
 	UUID,
-	// Long256,
+	Long256,
+	DoubleArray,
+	DoubleArray2D,
 }
 
 // TableNamer is an interface which has a single method, TableName, which
-// returns a string representing the struct's table name in QuestDB.
+// returns a string representing the struct's table name in QuestDB. As with WithTableName, the
+// name keeps its case and may be given bare or quoted.
 type TableNamer interface {
 	TableName() string
 }
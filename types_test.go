@@ -0,0 +1,199 @@
+package questdb
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSerializeValue_Int(t *testing.T) {
+	t.Run("should serialize unsigned values which fit in an int", func(t *testing.T) {
+		out, err := serializeValue(uint32(math.MaxInt32), Int, lineFormat{})
+		assert.Nil(t, err)
+		assert.Equal(t, "2147483647i", out)
+
+		out, err = serializeValue(uint(math.MaxInt32), Int, lineFormat{})
+		assert.Nil(t, err)
+		assert.Equal(t, "2147483647i", out)
+
+		out, err = serializeValue(uint32(0), Int, lineFormat{})
+		assert.Nil(t, err)
+		assert.Equal(t, "0i", out)
+	})
+
+	t.Run("should return an error for unsigned values which overflow an int", func(t *testing.T) {
+		_, err := serializeValue(uint32(math.MaxInt32+1), Int, lineFormat{})
+		assert.NotNil(t, err)
+
+		_, err = serializeValue(uint(math.MaxInt32+1), Int, lineFormat{})
+		assert.NotNil(t, err)
+
+		_, err = serializeValue(uint32(math.MaxUint32), Int, lineFormat{})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestSerializeValue_LegacyIntFormat(t *testing.T) {
+	ts := time.Unix(1, 0)
+	tests := []struct {
+		name     string
+		value    interface{}
+		qdbType  QuestDBType
+		standard string
+		legacy   string
+	}{
+		{"short", int16(7), Short, "7i", "7"},
+		{"int", int32(7), Int, "7i", "7"},
+		{"long", int64(7), Long, "7i", "7"},
+		{"byte", int8(7), Byte, "7i", "7"},
+		{"date", int64(7), Date, "7i", "7"},
+		{"timestamp from time.Time", ts, Timestamp, "1000000t", "1000000"},
+		{"timestamp from int64", int64(1000000), Timestamp, "1000000t", "1000000"},
+		{"double", 1.5, Double, "1.5", "1.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := serializeValue(tt.value, tt.qdbType, lineFormat{})
+			assert.Nil(t, err)
+			assert.Equal(t, tt.standard, out)
+
+			out, err = serializeValue(tt.value, tt.qdbType, lineFormat{legacyIntFormat: true})
+			assert.Nil(t, err)
+			assert.Equal(t, tt.legacy, out)
+		})
+	}
+}
+
+func TestSerializeValue_ILPTokens(t *testing.T) {
+	ts := time.Unix(1, 2000)
+	tests := []struct {
+		name    string
+		value   interface{}
+		qdbType QuestDBType
+		want    string
+	}{
+		{"boolean", true, Boolean, "true"},
+		{"byte", int8(-128), Byte, "-128i"},
+		{"short from uint8", uint8(255), Short, "255i"},
+		{"short from int16", int16(math.MinInt16), Short, "-32768i"},
+		{"char from rune", 'x', Char, `"x"`},
+		{"char from string", "é", Char, `"é"`},
+		{"char needing an escape", '"', Char, `"\""`},
+		{"int from int32", int32(math.MaxInt32), Int, "2147483647i"},
+		{"int from int64", int64(math.MinInt32), Int, "-2147483648i"},
+		{"int from duration", time.Microsecond, Int, "1000i"},
+		{"long from int", 7, Long, "7i"},
+		{"long from int64", int64(math.MaxInt64), Long, "9223372036854775807i"},
+		{"long from duration", time.Second, Long, "1000000000i"},
+		{"float", float32(1.5), Float, "1.5"},
+		{"double", 1.5, Double, "1.5"},
+		{"float at full precision", float32(0.1), Float, "0.1"},
+		{"small double at full precision", 1e-9, Double, "1e-09"},
+		{"large double at full precision", 1e300, Double, "1e+300"},
+		{"double of a whole number", 2.0, Double, "2"},
+		{"symbol", "a b", Symbol, `a\ b`},
+		{"string", `say "hi"`, String, `"say \"hi\""`},
+		{"date from time.Time", ts, Date, "1000i"},
+		{"date from int64", int64(1000), Date, "1000i"},
+		{"timestamp from time.Time", ts, Timestamp, "1000002t"},
+		{"timestamp from int64", int64(1000002), Timestamp, "1000002t"},
+		{"binary", []byte("hi"), Binary, `"aGk="`},
+		{"uuid", "A0EEBC99-9C0B-4EF8-BB6D-6BB9BD380A11", UUID, `"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"`},
+		{"long256", Long256Value{31: 0x1f}, Long256, "0x1fi"},
+	}
+
+	for _, tt := range tests {
+		t.Run("should serialize a "+tt.name, func(t *testing.T) {
+			out, err := serializeValue(tt.value, tt.qdbType, lineFormat{})
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+}
+
+func TestSerializeValue_TimestampResolution(t *testing.T) {
+	// 1ns past a whole microsecond, which is truncated at microsecond resolution
+	ts := time.Unix(1, 1001)
+	nanos := lineFormat{timestampResolution: NanosecondResolution}
+
+	t.Run("should write microseconds with the t suffix by default", func(t *testing.T) {
+		out, err := serializeValue(ts, Timestamp, lineFormat{})
+		assert.Nil(t, err)
+		assert.Equal(t, "1000001t", out)
+	})
+
+	t.Run("should write nanoseconds with the n suffix at nanosecond resolution", func(t *testing.T) {
+		out, err := serializeValue(ts, Timestamp, nanos)
+		assert.Nil(t, err)
+		assert.Equal(t, "1000001001n", out)
+	})
+
+	t.Run("should write int64 values as is with the resolution's suffix", func(t *testing.T) {
+		out, err := serializeValue(int64(1000001001), Timestamp, nanos)
+		assert.Nil(t, err)
+		assert.Equal(t, "1000001001n", out)
+	})
+
+	t.Run("should error on times outside the nanosecond range at nanosecond resolution", func(t *testing.T) {
+		_, err := serializeValue(time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC), Timestamp, nanos)
+		assert.NotNil(t, err)
+
+		out, err := serializeValue(time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC), Timestamp, lineFormat{})
+		assert.Nil(t, err)
+		assert.Equal(t, "10413792000000000t", out)
+	})
+
+	t.Run("should not change date columns", func(t *testing.T) {
+		out, err := serializeValue(ts, Date, nanos)
+		assert.Nil(t, err)
+		assert.Equal(t, "1000i", out)
+	})
+}
+
+type (
+	testAge      int16
+	testScore    float64
+	testSymbol   string
+	testFlag     bool
+	testCount    int64
+	testPayload  []byte
+	testInitial  rune
+	testJSONCode int
+)
+
+func (c testJSONCode) MarshalJSON() ([]byte, error) {
+	return []byte(`"code"`), nil
+}
+
+func TestSerializeValue_NamedTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		qdbType QuestDBType
+		want    string
+	}{
+		{"int16", testAge(42), Short, "42i"},
+		{"float64", testScore(1.5), Double, "1.5"},
+		{"string", testSymbol("a b"), String, `"a b"`},
+		{"bool", testFlag(true), Boolean, "true"},
+		{"int64", testCount(7), Long, "7i"},
+		{"[]byte", testPayload("hi"), Binary, `"aGk="`},
+		{"rune", testInitial('A'), Char, `"A"`},
+		{"json marshaler", testJSONCode(1), JSON, `"ImNvZGUi"`},
+	}
+	for _, tt := range tests {
+		t.Run("should serialize a named "+tt.name, func(t *testing.T) {
+			out, err := serializeValue(tt.value, tt.qdbType, lineFormat{})
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	t.Run("should still return an error for incompatible named types", func(t *testing.T) {
+		_, err := serializeValue(testSymbol("a"), Long, lineFormat{})
+		assert.EqualError(t, err, "type questdb.testSymbol is not compatible with long")
+	})
+}
@@ -0,0 +1,79 @@
+package questdb
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+)
+
+// uuidType is the type of the 16 bytes of a uuid, the underlying type of uuid.UUID and most other
+// Go uuid types
+var uuidType = reflect.TypeOf([16]byte{})
+
+// isUUIDType func returns whether values of ty, i.e. [16]byte or a type defined on it such as
+// uuid.UUID, hold the 16 bytes of a uuid
+func isUUIDType(ty reflect.Type) bool {
+	return ty.Kind() == reflect.Array && ty.Len() == 16 && ty.Elem().Kind() == reflect.Uint8
+}
+
+// parseUUID func parses s, a uuid in its canonical hyphenated form (e.g.
+// "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"), into its 16 bytes
+func parseUUID(s string) ([16]byte, error) {
+	var u [16]byte
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, fmt.Errorf("'%s' is not a uuid in its hyphenated 8-4-4-4-12 hex digit form", s)
+	}
+	digits := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:36]
+	if _, err := hex.Decode(u[:], []byte(digits)); err != nil {
+		return u, fmt.Errorf("could not hex decode uuid '%s': %w", s, err)
+	}
+	return u, nil
+}
+
+// formatUUID func returns u in its canonical lowercase hyphenated form
+func formatUUID(u [16]byte) string {
+	s := hex.EncodeToString(u[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
+
+// uuidIntermediate struct is a struct which implements the sql.Scanner interface for fields of a
+// 16 byte array type (see isUUIDType) which do not scan themselves. QuestDB returns uuid columns
+// in their hyphenated form, which is parsed into the field's bytes; a NULL column scans as the
+// zero uuid.
+type uuidIntermediate struct {
+	v reflect.Value
+}
+
+// newUUIDIntermediate func returns *uuidIntermediate given v, the 16 byte array field to scan into
+func newUUIDIntermediate(v reflect.Value) *uuidIntermediate {
+	return &uuidIntermediate{
+		v: v,
+	}
+}
+
+// Scan func is implementation of the sql.Scanner's Scan method which sets uuidIntermediate's (v)
+// underlying bytes to the uuid src
+func (u *uuidIntermediate) Scan(src interface{}) error {
+	var parsed [16]byte
+	switch val := src.(type) {
+	case nil:
+	case string:
+		var err error
+		if parsed, err = parseUUID(val); err != nil {
+			return err
+		}
+	case []byte:
+		if len(val) == 16 {
+			copy(parsed[:], val)
+			break
+		}
+		var err error
+		if parsed, err = parseUUID(string(val)); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%T cannot be scanned into %s", src, u.v.Type())
+	}
+	u.v.Set(reflect.ValueOf(parsed).Convert(u.v.Type()))
+	return nil
+}
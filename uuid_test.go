@@ -0,0 +1,74 @@
+package questdb
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testUUID is defined on [16]byte like uuid.UUID
+type testUUID [16]byte
+
+func TestUUID(t *testing.T) {
+	const canonical = "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"
+
+	t.Run("should parse and format the hyphenated form", func(t *testing.T) {
+		u, err := parseUUID("A0EEBC99-9C0B-4EF8-BB6D-6BB9BD380A11")
+		assert.Nil(t, err)
+		assert.Equal(t, byte(0xa0), u[0])
+		assert.Equal(t, byte(0x11), u[15])
+		assert.Equal(t, canonical, formatUUID(u))
+	})
+
+	t.Run("should return an error for malformed uuids", func(t *testing.T) {
+		for _, s := range []string{"", "a0eebc999c0b4ef8bb6d6bb9bd380a11", "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a1", "z0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"} {
+			_, err := parseUUID(s)
+			assert.NotNil(t, err, s)
+		}
+
+		type session struct {
+			ID string `qdb:"id;uuid"`
+		}
+		_, err := NewModel(&session{ID: "not a uuid"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("should round trip uuids through ingestion and scanning", func(t *testing.T) {
+		type session struct {
+			Name string   `qdb:"name;symbol"`
+			ID   testUUID `qdb:"id;uuid"`
+			Raw  [16]byte `qdb:"raw;uuid"`
+			Text string   `qdb:"text;uuid"`
+		}
+
+		written, err := parseUUID(canonical)
+		assert.Nil(t, err)
+		m, err := NewModel(&session{Name: "a", ID: written, Raw: written, Text: canonical})
+		assert.Nil(t, err)
+		line, err := m.marshalLine()
+		assert.Nil(t, err)
+		quoted := `"` + canonical + `"`
+		assert.Equal(t, "sessions,name=a id="+quoted+",raw="+quoted+",text="+quoted+"\n", string(line))
+		assert.Equal(t, `CREATE TABLE IF NOT EXISTS "sessions" ( "name" symbol, "id" uuid, "raw" uuid, "text" uuid, "timestamp" timestamp ) timestamp(timestamp) ;`,
+			m.CreateTableIfNotExistStatement())
+
+		// QuestDB returns uuids in their hyphenated form
+		db := newTestDB(t, []string{"name", "id", "raw", "text"}, []driver.Value{"a", canonical, []byte(canonical), canonical})
+		read := &session{}
+		assert.Nil(t, ScanInto(db.QueryRow("SELECT name, id, raw, text FROM sessions"), read))
+		assert.Equal(t, &session{Name: "a", ID: written, Raw: written, Text: canonical}, read)
+	})
+
+	t.Run("should quote uuid literals", func(t *testing.T) {
+		u, err := parseUUID(canonical)
+		assert.Nil(t, err)
+		for _, v := range []interface{}{canonical, u, testUUID(u)} {
+			lit, err := QuoteLiteral(v, UUID)
+			assert.Nil(t, err)
+			assert.Equal(t, "'"+canonical+"'", lit)
+		}
+		_, err = QuoteLiteral("x'; DROP TABLE sessions; --", UUID)
+		assert.NotNil(t, err)
+	})
+}